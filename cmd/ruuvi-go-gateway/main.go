@@ -1,34 +1,116 @@
 ﻿package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/Saavuori/ruuvi-go-gateway/common/logging"
 	"github.com/Saavuori/ruuvi-go-gateway/common/version"
 	"github.com/Saavuori/ruuvi-go-gateway/config"
 	"github.com/Saavuori/ruuvi-go-gateway/gateway"
+	"github.com/Saavuori/ruuvi-go-gateway/server"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// hashPassword prints the bcrypt hash of the password read from stdin, for the auth users
+func hashPassword() {
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.WithError(err).Fatal("No password given")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to hash password")
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Println(string(hash))
+}
+
+// generateToken prints a new API token and the SHA-256 hash to put in the auth tokens config
+func generateToken() {
+	token := server.GenerateToken()
+	fmt.Println("token:        " + token)
+	fmt.Println("token_sha256: " + server.HashToken(token))
+}
+
+// validateConfig checks the config file and prints every invalid value, the exit status is 1 when
+// the config is invalid so that it can be used in CI
+func validateConfig(configPath string) {
+	err := config.ValidateFile(configPath)
+	if err == nil {
+		fmt.Printf("%s is valid\n", configPath)
+		return
+	}
+	var invalid config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, fieldErr := range invalid {
+			fmt.Fprintln(os.Stderr, fieldErr.Error())
+		}
+		fmt.Fprintf(os.Stderr, "%s is invalid: %d error(s)\n", configPath, len(invalid))
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(1)
+}
+
 func main() {
 	configPath := flag.String("config", "./config.yml", "The path to the configuration")
-	strictConfig := flag.Bool("strict-config", false, "Use strict parsing for the config file; will throw errors for invalid fields")
+	strictConfig := flag.Bool("strict-config", false, "Use strict parsing for the config file; will throw errors for unknown fields and invalid values")
 	versionFlag := flag.Bool("version", false, "Prints the version and exits")
+	var overrides config.Overrides
+	flag.Var(&overrides, "set", "Override a config value, eg. -set mqtt_publisher.broker_url=tcp://broker:1883; can be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [hash-password | generate-token | validate-config [file]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "hash-password":
+		hashPassword()
+		return
+	case "generate-token":
+		generateToken()
+		return
+	case "validate-config":
+		if flag.Arg(1) != "" {
+			*configPath = flag.Arg(1)
+		}
+		validateConfig(*configPath)
+		return
+	}
 	version.Print()
 
 	if *versionFlag {
 		return
 	}
 
-	conf, err := config.ReadConfig(*configPath, *strictConfig)
+	// Defaults, config file, RUUVI_ environment variables and -set flags, each overriding the previous
+	layers := config.Layers{Path: *configPath, Strict: *strictConfig, Overrides: overrides}
+	conf, sources, err := layers.Load()
 	logging.Setup(conf.Logging) // logging should be set up with logging config before logging a possible error in the config, weird, I know
 	if err != nil {
 		log.WithError(err).Fatal("Failed to load config")
 	}
+	if err := config.Validate(conf); err != nil {
+		if *strictConfig {
+			log.WithError(err).Fatal("Invalid config")
+		}
+		for _, fieldErr := range err.(config.ValidationError) {
+			log.WithFields(log.Fields{"field": fieldErr.Path}).Warn("Invalid config value: " + fieldErr.Message)
+		}
+	}
 	log.WithFields(log.Fields{
 		"configfile": *configPath,
 	}).Debug("Config loaded")
 
+	server.SetConfigLayers(layers, conf, sources)
 	gateway.Run(conf, *configPath)
 }
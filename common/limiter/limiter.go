@@ -1,29 +1,106 @@
 ﻿package limiter
 
 import (
+	"math"
+	"sync"
 	"time"
 
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
 )
 
+// Options of a Limiter. MinInterval alone limits the rate per tag, with Deadbands a measurement is
+// only published when a field has changed enough since the last published measurement of the tag,
+// or when Heartbeat has passed.
+type Options struct {
+	MinInterval time.Duration
+	// Publish unchanged values at least this often, 0 publishes only the changes
+	Heartbeat time.Duration
+	// Minimum change of a field by its JSON name, eg. temperature: 0.1, 0 for any change
+	Deadbands map[string]float64
+}
+
+type deadband struct {
+	field parser.Field
+	delta float64
+}
+
+type published struct {
+	time int64
+	// Values of the deadband fields, nil when the field was missing
+	values []*float64
+}
+
+// Limiter decides which measurements a sink publishes, it is safe for concurrent use
 type Limiter struct {
-	interval time.Duration
-	macs     map[string]int64
+	interval  time.Duration
+	heartbeat time.Duration
+	deadbands []deadband
+
+	mu   sync.Mutex
+	macs map[string]published
+	// Current time in nanoseconds, replaced in the tests
+	now func() int64
+}
+
+func New(minInterval time.Duration) *Limiter {
+	return NewWithOptions(Options{MinInterval: minInterval})
 }
 
-func New(minInterval time.Duration) Limiter {
-	return Limiter{
-		interval: minInterval,
-		macs:     make(map[string]int64),
+func NewWithOptions(o Options) *Limiter {
+	l := &Limiter{
+		interval:  o.MinInterval,
+		heartbeat: o.Heartbeat,
+		macs:      make(map[string]published),
+		now:       func() int64 { return time.Now().UnixNano() },
+	}
+	for name, delta := range o.Deadbands {
+		field, ok := parser.FieldByName(name)
+		if !ok {
+			log.WithField("field", name).Warn("Ignoring the deadband of an unknown field")
+			continue
+		}
+		l.deadbands = append(l.deadbands, deadband{field: field, delta: math.Abs(delta)})
 	}
+	return l
 }
 
-func (l Limiter) Check(m parser.Measurement) bool {
-	now := time.Now().UnixNano()
-	t := l.macs[m.Mac]
-	if t+l.interval.Nanoseconds() > now {
+// Check returns whether the measurement is published, and records it as published if so
+func (l *Limiter) Check(m parser.Measurement) bool {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last, seen := l.macs[m.Mac]
+	if seen && last.time+l.interval.Nanoseconds() > now {
+		return false
+	}
+	values := make([]*float64, len(l.deadbands))
+	for i, d := range l.deadbands {
+		if v, ok := d.field.Float(m); ok {
+			values[i] = &v
+		}
+	}
+	if seen && len(l.deadbands) > 0 && !l.changed(last.values, values) &&
+		(l.heartbeat <= 0 || last.time+l.heartbeat.Nanoseconds() > now) {
 		return false
 	}
-	l.macs[m.Mac] = now
+	l.macs[m.Mac] = published{time: now, values: values}
 	return true
 }
+
+// changed returns whether a deadband field has changed enough, or appeared or disappeared
+func (l *Limiter) changed(last []*float64, values []*float64) bool {
+	for i, d := range l.deadbands {
+		switch {
+		case last[i] == nil && values[i] == nil:
+		case last[i] == nil || values[i] == nil:
+			return true
+		case d.delta == 0 && *values[i] != *last[i]:
+			return true
+		// The epsilon keeps eg. 0.3 - 0.2 from falling short of a 0.1 deadband
+		case d.delta > 0 && math.Abs(*values[i]-*last[i]) >= d.delta-1e-9:
+			return true
+		}
+	}
+	return false
+}
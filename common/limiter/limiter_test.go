@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+func measurement(mac string, temperature float64, humidity float64) parser.Measurement {
+	m := parser.Measurement{}
+	m.Mac = mac
+	m.Temperature = &temperature
+	m.Humidity = &humidity
+	return m
+}
+
+// clock advances the time of the limiter by hand
+type clock struct{ t int64 }
+
+func (c *clock) now() int64          { return c.t }
+func (c *clock) add(d time.Duration) { c.t += d.Nanoseconds() }
+func withClock(l *Limiter) (*Limiter, *clock) {
+	c := &clock{t: time.Hour.Nanoseconds()}
+	l.now = c.now
+	return l, c
+}
+
+func TestLimiter_MinInterval(t *testing.T) {
+	l, c := withClock(New(time.Second))
+	if !l.Check(measurement("A", 20, 40)) {
+		t.Error("first measurement was limited")
+	}
+	c.add(500 * time.Millisecond)
+	if l.Check(measurement("A", 20, 40)) {
+		t.Error("measurement within the interval was published")
+	}
+	if !l.Check(measurement("B", 20, 40)) {
+		t.Error("other tag was limited")
+	}
+	c.add(500 * time.Millisecond)
+	if !l.Check(measurement("A", 20, 40)) {
+		t.Error("measurement after the interval was limited")
+	}
+}
+
+func TestLimiter_Deadbands(t *testing.T) {
+	l, c := withClock(NewWithOptions(Options{
+		MinInterval: time.Second,
+		Heartbeat:   time.Minute,
+		Deadbands:   map[string]float64{"temperature": 0.1, "humidity": 1},
+	}))
+	steps := []struct {
+		after       time.Duration
+		temperature float64
+		humidity    float64
+		want        bool
+	}{
+		{0, 20.2, 40, true},
+		{10 * time.Second, 20.25, 40.5, false},
+		// Changes are compared to the last published values, not to the last received ones
+		{10 * time.Second, 20.3, 40.5, true},
+		{10 * time.Second, 20.3, 41.5, true},
+		// Within the minimum interval even a large change waits
+		{500 * time.Millisecond, 25, 41.5, false},
+		{time.Second, 25, 41.5, true},
+		{30 * time.Second, 25, 41.5, false},
+		// Heartbeat
+		{31 * time.Second, 25, 41.5, true},
+	}
+	for i, step := range steps {
+		c.add(step.after)
+		if got := l.Check(measurement("A", step.temperature, step.humidity)); got != step.want {
+			t.Errorf("step %d: got %v, want %v", i, got, step.want)
+		}
+	}
+
+	// A field which disappears is a change
+	m := measurement("A", 25, 41.5)
+	m.Humidity = nil
+	c.add(time.Second)
+	if !l.Check(m) {
+		t.Error("missing field was not a change")
+	}
+}
+
+func TestLimiter_Concurrent(t *testing.T) {
+	l := NewWithOptions(Options{Deadbands: map[string]float64{"temperature": 0}})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				l.Check(measurement(string(rune('A'+i%3)), float64(j), 40))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
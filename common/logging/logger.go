@@ -23,10 +23,9 @@ func Setup(conf config.Logging) {
 		log.SetLevel(log.FatalLevel)
 	case "panic":
 		log.SetLevel(log.PanicLevel)
-	case "":
-		log.SetLevel(log.InfoLevel)
 	default:
-		log.WithField("configured_level", conf.Level).Fatal("Invalid logging level")
+		// Invalid levels are reported by the config validation, log at the default level meanwhile
+		log.SetLevel(log.InfoLevel)
 	}
 
 	switch conf.Type {
@@ -34,13 +33,11 @@ func Setup(conf config.Logging) {
 		log.SetFormatter(&log.JSONFormatter{
 			TimestampFormat: "2006-01-02 15:04:05",
 		})
-	case "structured", "simple", "":
+	default:
 		log.SetFormatter(&log.TextFormatter{
 			FullTimestamp:   true,
 			TimestampFormat: "2006-01-02 15:04:05",
 		})
-	default:
-		log.WithField("configured_type", conf.Type).Fatal("Invalid logging type")
 	}
 
 	if conf.Timestamps != nil && !*conf.Timestamps {
@@ -0,0 +1,84 @@
+// Package metrics holds the gateway self-monitoring metrics. They are registered to the
+// default Prometheus registry and exposed by the Prometheus sink.
+package metrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const prefix = "ruuvibridge_"
+
+var (
+	AdvertisementsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: prefix + "advertisements_received_total",
+		Help: "Number of BLE advertisements received",
+	})
+	ParseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: prefix + "parse_failures_total",
+		Help: "Number of Ruuvi advertisements which could not be parsed, by data format",
+	}, []string{"data_format"})
+	SinkDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: prefix + "sink_dropped_total",
+		Help: "Number of measurements dropped because the sink queue was full",
+	}, []string{"sink"})
+	ScanRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: prefix + "ble_scan_restarts_total",
+		Help: "Number of times the BLE scan was restarted after a failure",
+	})
+	StreamClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: prefix + "stream_clients",
+		Help: "Number of connected live stream clients, by transport",
+	}, []string{"transport"})
+	StreamCoalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: prefix + "stream_coalesced_total",
+		Help: "Number of tag updates replaced by a newer update before a slow live stream client received them",
+	}, []string{"transport"})
+)
+
+var queueDepth = &queueCollector{
+	desc: prometheus.NewDesc(
+		prefix+"sink_queue_depth",
+		"Number of measurements waiting in the sink queue",
+		[]string{"sink"}, nil,
+	),
+	queues: make(map[string]func() int),
+}
+
+func init() {
+	prometheus.MustRegister(queueDepth)
+}
+
+type queueCollector struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	queues map[string]func() int
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.queues))
+	for name := range c.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.queues[name]()), name)
+	}
+}
+
+// RegisterSinkQueue reports the queue depth of a sink, depth is called on every scrape
+func RegisterSinkQueue(sink string, depth func() int) {
+	queueDepth.mu.Lock()
+	defer queueDepth.mu.Unlock()
+	queueDepth.queues[sink] = depth
+}
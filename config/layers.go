@@ -0,0 +1,359 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables which override config values. The rest of
+// the name is the path of the value with "__" between the levels, eg. RUUVI_MQTT_PUBLISHER__BROKER_URL.
+const EnvPrefix = "RUUVI_"
+
+// Layers of the config, each overrides the values of the previous ones
+const (
+	LayerDefault = "default"
+	LayerFile    = "file"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+var errUnknownPath = errors.New("unknown config field")
+
+// Source is where a config value came from, Name is the file, the environment variable or the flag
+type Source struct {
+	Layer string `json:"layer"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Sources maps the paths of the config values to their sources, a value without an own source
+// comes from the closest parent, eg. a list set by one environment variable
+type Sources map[string]Source
+
+// Lookup returns the source of the value at path
+func (s Sources) Lookup(path string) Source {
+	for {
+		if source, ok := s[path]; ok {
+			return source
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i <= 0 {
+			return Source{Layer: LayerDefault}
+		}
+		path = path[:i]
+	}
+}
+
+// set records the source of a value and drops the sources of the values it replaced
+func (s Sources) set(path string, source Source) {
+	for p := range s {
+		if strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			delete(s, p)
+		}
+	}
+	s[path] = source
+}
+
+// Overrides are the path=value pairs of the -set flag, eg. -set mqtt_publisher.broker_url=tcp://broker:1883
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ", ")
+}
+
+func (o *Overrides) Set(value string) error {
+	if path, _, ok := strings.Cut(value, "="); !ok || path == "" {
+		return errors.New("expected path=value")
+	}
+	*o = append(*o, value)
+	return nil
+}
+
+// Layers loads the config from the defaults, the YAML file, the RUUVI_ environment variables and the
+// -set flags, in this order
+type Layers struct {
+	Path string
+	// Reject unknown fields in the file and unknown RUUVI_ environment variables
+	Strict bool
+	// Environment as KEY=value, os.Environ() when nil
+	Environ   []string
+	Overrides Overrides
+}
+
+// Defaults returns the values used when neither the file nor the overrides set them
+func Defaults() Config {
+	return Config{
+		GwMac:        "00:00:00:00:00:00",
+		HTTPListener: &HTTPListener{Port: 8080},
+		Logging:      Logging{Type: "simple", Level: "info"},
+	}
+}
+
+// Load merges the layers and resolves the secrets. The file may be missing when the config is
+// given with environment variables or flags only.
+func (l Layers) Load() (Config, Sources, error) {
+	var c Config
+	sources := make(Sources)
+	var root yaml.Node
+	if err := root.Encode(Defaults()); err != nil {
+		return c, nil, err
+	}
+	recordSources(&root, "", Source{Layer: LayerDefault}, sources)
+
+	environ := l.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	var env []string
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, EnvPrefix) {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+
+	data, err := os.ReadFile(l.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && len(env) == 0 && len(l.Overrides) == 0:
+		return c, nil, fmt.Errorf("no config found! Tried to open \"%s\"", l.Path)
+	case errors.Is(err, os.ErrNotExist):
+		log.WithField("configfile", l.Path).Info("Config file not found, using the environment variables and flags")
+	case err != nil:
+		return c, nil, err
+	default:
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return c, nil, err
+		}
+		if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			if l.Strict {
+				v := &validator{}
+				v.unknownFields(doc.Content[0], reflect.TypeOf(c), "", make(map[int]string))
+				if len(v.errors) > 0 {
+					return c, nil, v.errors
+				}
+			}
+			mergeNodes(&root, doc.Content[0])
+			recordSources(doc.Content[0], "", Source{Layer: LayerFile, Name: l.Path}, sources)
+		}
+	}
+
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		// Field names match case-insensitively, map keys are used as they are
+		segments := strings.Split(strings.TrimPrefix(name, EnvPrefix), "__")
+		path, err := setPath(&root, reflect.TypeOf(c), segments, value, "")
+		if errors.Is(err, errUnknownPath) && !l.Strict {
+			log.WithField("env", name).Warn("Ignoring an environment variable which does not match a config field")
+			continue
+		}
+		if err != nil {
+			return c, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		sources.set(path, Source{Layer: LayerEnv, Name: name})
+	}
+
+	for _, override := range l.Overrides {
+		key, value, _ := strings.Cut(override, "=")
+		segments := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(key), ".")
+		path, err := setPath(&root, reflect.TypeOf(c), segments, value, "")
+		if err != nil {
+			return c, nil, fmt.Errorf("-set %s: %w", key, err)
+		}
+		sources.set(path, Source{Layer: LayerFlag, Name: "-set " + key})
+	}
+
+	if err := root.Decode(&c); err != nil {
+		return c, nil, err
+	}
+	normalizeSinks(&c)
+	if err := ResolveSecrets(&c); err != nil {
+		return c, nil, err
+	}
+	return c, sources, nil
+}
+
+// mergeNodes overrides the values of dst with the values of src, mappings are merged by key
+func mergeNodes(dst *yaml.Node, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		mergeNodes(mappingValue(dst, src.Content[i].Value), src.Content[i+1])
+	}
+}
+
+// mappingValue returns the value of the key, it is added when missing
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	value := &yaml.Node{}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
+
+// recordSources sets the source of every value in the node, lists of scalars are one value
+func recordSources(node *yaml.Node, path string, source Source, sources Sources) {
+	switch {
+	case node.Kind == yaml.MappingNode && len(node.Content) > 0:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			recordSources(node.Content[i+1], fieldPath(path, node.Content[i].Value), source, sources)
+		}
+	case node.Kind == yaml.SequenceNode && len(node.Content) > 0 && node.Content[0].Kind != yaml.ScalarNode:
+		for i, item := range node.Content {
+			recordSources(item, fmt.Sprintf("%s[%d]", path, i), source, sources)
+		}
+	default:
+		sources.set(path, source)
+	}
+}
+
+func scalarType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// setPath sets the value at the path given as segments and returns the path in the YAML
+// names. Scalars are set as such, lists of scalars may be comma separated, and anything else is
+// parsed as YAML or JSON.
+func setPath(node *yaml.Node, t reflect.Type, segments []string, value string, path string) (string, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(segments) == 0 {
+		return path, setValue(node, t, value)
+	}
+	segment := segments[0]
+	switch t.Kind() {
+	case reflect.Struct:
+		for _, field := range yamlFields(t) {
+			name := yamlName(field)
+			if strings.EqualFold(name, segment) {
+				return setPath(mappingValue(node, name), field.Type, segments[1:], value, fieldPath(path, name))
+			}
+		}
+	case reflect.Map:
+		return setPath(mappingValue(node, segment), t.Elem(), segments[1:], value, fieldPath(path, segment))
+	case reflect.Slice:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 {
+			break
+		}
+		if node.Kind != yaml.SequenceNode {
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		if index > len(node.Content) {
+			return "", fmt.Errorf("%s: index %d skips elements, the next index is %d", path, index, len(node.Content))
+		}
+		if index == len(node.Content) {
+			node.Content = append(node.Content, &yaml.Node{})
+		}
+		return setPath(node.Content[index], t.Elem(), segments[1:], value, fmt.Sprintf("%s[%d]", path, index))
+	}
+	return "", fmt.Errorf("%w: %s", errUnknownPath, fieldPath(path, segment))
+}
+
+func setValue(node *yaml.Node, t reflect.Type, value string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case scalarType(t):
+		*node = yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		// Strings are not resolved, eg. a password "123" stays a string
+		if t.Kind() == reflect.String {
+			node.Tag = "!!str"
+		}
+	case t.Kind() == reflect.Slice && scalarType(t.Elem()) && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := &yaml.Node{Kind: yaml.ScalarNode, Value: item}
+			if t.Elem().Kind() == reflect.String {
+				elem.Tag = "!!str"
+			}
+			node.Content = append(node.Content, elem)
+		}
+	default:
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			return fmt.Errorf("invalid YAML value: %w", err)
+		}
+		if len(doc.Content) == 0 {
+			*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		} else {
+			*node = *doc.Content[0]
+		}
+	}
+	return nil
+}
+
+// EffectiveValue is a value of the loaded config and the layer it came from
+type EffectiveValue struct {
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value"`
+	Source Source      `json:"source"`
+}
+
+// Effective lists the values of the loaded config with their sources, the secrets are masked
+func Effective(c Config, sources Sources) ([]EffectiveValue, error) {
+	// Mask a copy, the config shares the sections with the running gateway
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var masked Config
+	if err := yaml.Unmarshal(data, &masked); err != nil {
+		return nil, err
+	}
+	MaskSecrets(&masked)
+	var root yaml.Node
+	if err := root.Encode(masked); err != nil {
+		return nil, err
+	}
+	values := []EffectiveValue{}
+	var walk func(node *yaml.Node, path string) error
+	walk = func(node *yaml.Node, path string) error {
+		switch {
+		case node.Kind == yaml.MappingNode && len(node.Content) > 0:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if err := walk(node.Content[i+1], fieldPath(path, node.Content[i].Value)); err != nil {
+					return err
+				}
+			}
+		case node.Kind == yaml.SequenceNode && len(node.Content) > 0 && node.Content[0].Kind != yaml.ScalarNode:
+			for i, item := range node.Content {
+				if err := walk(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			var value interface{}
+			if err := node.Decode(&value); err != nil {
+				return err
+			}
+			values = append(values, EffectiveValue{Path: path, Value: value, Source: sources.Lookup(path)})
+		}
+		return nil
+	}
+	return values, walk(&root, "")
+}
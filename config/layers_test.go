@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayers_Load(t *testing.T) {
+	path := writeTestConfig(t, `gw_mac: AA:BB:CC:DD:EE:FF
+mqtt_publisher:
+  broker_url: tcp://localhost:1883
+  topic_prefix: ruuvi
+  minimum_interval: 1s
+tag_names:
+  AA:BB:CC:DD:EE:01: Sauna
+`)
+	layers := Layers{
+		Path: path,
+		Environ: []string{
+			"HOME=/root",
+			"RUUVI_MQTT_PUBLISHER__BROKER_URL=tcp://broker:1883",
+			"RUUVI_MQTT_PUBLISHER__PASSWORD=123",
+			"RUUVI_MQTT_PUBLISHER__MINIMUM_INTERVAL=5s",
+			"RUUVI_MQTT_PUBLISHER__RETAIN_MESSAGES=true",
+			"RUUVI_KAFKA_PUBLISHER__BROKERS=kafka1:9092, kafka2:9092",
+			"RUUVI_AUTH__USERS__0__USERNAME=admin",
+			"RUUVI_AUTH__USERS__0__ROLE=admin",
+			"RUUVI_TAG_NAMES__AA:BB:CC:DD:EE:02=Garage",
+			"RUUVI_INFLUXDB_PUBLISHER__ADDITIONAL_TAGS={location: home}",
+			"RUUVI_TEST_SOMETHING=ignored",
+		},
+		Overrides: Overrides{"mqtt_publisher.topic_prefix=home", "auth.users[0].role=read-only"},
+	}
+	c, sources, err := layers.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := c.MQTTPublisher
+	if p.BrokerUrl != "tcp://broker:1883" || p.Password != "123" || p.TopicPrefix != "home" ||
+		time.Duration(p.MinimumInterval) != 5*time.Second || !p.RetainMessages {
+		t.Errorf("mqtt_publisher: %+v", p)
+	}
+	if c.GwMac != "AA:BB:CC:DD:EE:FF" || c.HTTPListener == nil || c.HTTPListener.Port != 8080 || c.Logging.Level != "info" {
+		t.Errorf("file and defaults: %+v %+v %+v", c.GwMac, c.HTTPListener, c.Logging)
+	}
+	if strings.Join(c.KafkaPublisher.Brokers, ",") != "kafka1:9092,kafka2:9092" {
+		t.Errorf("kafka brokers: %v", c.KafkaPublisher.Brokers)
+	}
+	if len(c.Auth.Users) != 1 || c.Auth.Users[0].Username != "admin" || c.Auth.Users[0].Role != "read-only" {
+		t.Errorf("auth users: %+v", c.Auth.Users)
+	}
+	if c.TagNames["AA:BB:CC:DD:EE:01"] != "Sauna" || c.TagNames["AA:BB:CC:DD:EE:02"] != "Garage" {
+		t.Errorf("tag names: %v", c.TagNames)
+	}
+	if c.InfluxDBPublisher.AdditionalTags["location"] != "home" {
+		t.Errorf("additional tags: %v", c.InfluxDBPublisher.AdditionalTags)
+	}
+
+	want := map[string]Source{
+		"gw_mac":                                      {Layer: LayerFile, Name: path},
+		"http_listener.port":                          {Layer: LayerDefault},
+		"mqtt_publisher.broker_url":                   {Layer: LayerEnv, Name: "RUUVI_MQTT_PUBLISHER__BROKER_URL"},
+		"mqtt_publisher.topic_prefix":                 {Layer: LayerFlag, Name: "-set mqtt_publisher.topic_prefix"},
+		"kafka_publisher.brokers":                     {Layer: LayerEnv, Name: "RUUVI_KAFKA_PUBLISHER__BROKERS"},
+		"auth.users[0].role":                          {Layer: LayerFlag, Name: "-set auth.users[0].role"},
+		"tag_names.AA:BB:CC:DD:EE:01":                 {Layer: LayerFile, Name: path},
+		"influxdb_publisher.additional_tags.location": {Layer: LayerEnv, Name: "RUUVI_INFLUXDB_PUBLISHER__ADDITIONAL_TAGS"},
+		// Values which are not set anywhere are defaults
+		"mqtt_publisher.client_id": {Layer: LayerDefault},
+	}
+	for path, source := range want {
+		if got := sources.Lookup(path); got != source {
+			t.Errorf("%s: got %+v, want %+v", path, got, source)
+		}
+	}
+}
+
+func TestLayers_Errors(t *testing.T) {
+	path := writeTestConfig(t, "gw_mac: AA:BB:CC:DD:EE:FF\n")
+	missing := filepath.Join(t.TempDir(), "missing.yml")
+
+	// Unknown RUUVI_ variables are only rejected in strict mode
+	env := []string{"RUUVI_MQTT_PUBLISHER__BROKER_ULR=tcp://broker:1883"}
+	if _, _, err := (Layers{Path: path, Environ: env}).Load(); err != nil {
+		t.Errorf("not strict: %v", err)
+	}
+	if _, _, err := (Layers{Path: path, Environ: env, Strict: true}).Load(); err == nil || !strings.Contains(err.Error(), "RUUVI_MQTT_PUBLISHER__BROKER_ULR") {
+		t.Errorf("strict: got %v", err)
+	}
+	if _, _, err := (Layers{Path: path, Environ: []string{}, Overrides: Overrides{"mqtt_publisher.unknown=1"}}).Load(); err == nil {
+		t.Error("unknown -set path was accepted")
+	}
+	if _, _, err := (Layers{Path: path, Environ: []string{"RUUVI_HTTP_LISTENER__PORT=http"}}).Load(); err == nil {
+		t.Error("invalid number was accepted")
+	}
+	if _, _, err := (Layers{Path: path, Environ: []string{"RUUVI_AUTH__USERS__1__USERNAME=admin"}}).Load(); err == nil {
+		t.Error("index skipping elements was accepted")
+	}
+
+	// Without the file the config may come from the environment only
+	if _, _, err := (Layers{Path: missing, Environ: []string{}}).Load(); err == nil {
+		t.Error("missing file without overrides was accepted")
+	}
+	c, _, err := (Layers{Path: missing, Environ: []string{"RUUVI_GW_MAC=AA:BB:CC:DD:EE:FF"}}).Load()
+	if err != nil || c.GwMac != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("environment only: %v %v", c.GwMac, err)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	path := writeTestConfig(t, "mqtt_publisher:\n  broker_url: tcp://localhost:1883\n  password: file-secret\n")
+	c, sources, err := (Layers{Path: path, Environ: []string{"RUUVI_MQTT_PUBLISHER__USERNAME=ruuvi"}}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := Effective(c, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]EffectiveValue)
+	for _, v := range values {
+		found[v.Path] = v
+	}
+	if v := found["mqtt_publisher.password"]; v.Value != SecretMask || v.Source.Layer != LayerFile {
+		t.Errorf("password: %+v", v)
+	}
+	if v := found["mqtt_publisher.username"]; v.Value != "ruuvi" || v.Source.Layer != LayerEnv {
+		t.Errorf("username: %+v", v)
+	}
+	if v := found["http_listener.port"]; v.Value != 8080 || v.Source.Layer != LayerDefault {
+		t.Errorf("port: %+v", v)
+	}
+	if c.MQTTPublisher.Password != "file-secret" {
+		t.Error("the loaded config was masked")
+	}
+}
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SecretMask replaces the stored secrets in the config returned by the API. Sending it back,
+// or 0 for numeric secrets, keeps the stored secret unchanged.
+const SecretMask = "********"
+
+// Secret fields are tagged with `secret:"true"`. A secret can be read from a file named in a
+// sibling field with the same YAML name and a "_file" suffix, eg. password_file, and secret strings
+// may reference environment variables as ${NAME}. Elements of slices with secrets are matched
+// by the field tagged `secret:"key"` when secrets are restored.
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isEnvReference returns whether the value only references an environment variable, such values
+// are not masked because they show where the secret comes from
+func isEnvReference(value string) bool {
+	match := envReference.FindStringIndex(value)
+	return match != nil && match[0] == 0 && match[1] == len(value)
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// isInline returns whether the field is an embedded struct whose fields are in the YAML mapping of the parent
+func isInline(field reflect.StructField) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return field.Anonymous && strings.Contains(","+options+",", ",inline,")
+}
+
+// yamlFields returns the fields of a struct as they appear in YAML, the fields of the inline
+// structs, eg. SinkOptions, are listed in their place with the index path from t
+func yamlFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !isInline(field) {
+			fields = append(fields, field)
+			continue
+		}
+		for _, inner := range yamlFields(field.Type) {
+			inner.Index = append([]int{i}, inner.Index...)
+			fields = append(fields, inner)
+		}
+	}
+	return fields
+}
+
+func fieldPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// MaskSecrets replaces the secrets with SecretMask, numeric secrets with 0
+func MaskSecrets(c *Config) {
+	maskValue(reflect.ValueOf(c).Elem())
+}
+
+func maskValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			maskValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			maskValue(v.Index(i))
+		}
+	case reflect.Struct:
+		for _, field := range yamlFields(v.Type()) {
+			if field.Tag.Get("secret") == "true" {
+				maskSecret(v.FieldByIndex(field.Index))
+			} else {
+				maskValue(v.FieldByIndex(field.Index))
+			}
+		}
+	}
+}
+
+func maskSecret(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() != "" && !isEnvReference(v.String()) {
+			v.SetString(SecretMask)
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.Set(reflect.Zero(v.Type()))
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		// Copy so that the map of the caller is not modified
+		masked := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if value.Kind() == reflect.String && !isEnvReference(value.String()) {
+				value = reflect.ValueOf(SecretMask).Convert(value.Type())
+			}
+			masked.SetMapIndex(iter.Key(), value)
+		}
+		v.Set(masked)
+	}
+}
+
+// RestoreSecrets replaces the masked secrets of a config sent by the API with the secrets of the stored config
+func RestoreSecrets(c *Config, stored Config) error {
+	return restoreValue(reflect.ValueOf(c).Elem(), reflect.ValueOf(stored), "")
+}
+
+func restoreValue(v reflect.Value, stored reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if !stored.IsValid() || stored.IsNil() {
+			return restoreValue(v.Elem(), reflect.Value{}, path)
+		}
+		return restoreValue(v.Elem(), stored.Elem(), path)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elem, elemPath := v.Index(i), fmt.Sprintf("%s[%d]", path, i)
+			if err := restoreValue(elem, matchElement(elem, stored, i), elemPath); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range yamlFields(v.Type()) {
+			var storedField reflect.Value
+			if stored.IsValid() {
+				storedField = stored.FieldByIndex(field.Index)
+			}
+			p := fieldPath(path, yamlName(field))
+			var err error
+			if field.Tag.Get("secret") == "true" {
+				err = restoreSecret(v.FieldByIndex(field.Index), storedField, p)
+			} else {
+				err = restoreValue(v.FieldByIndex(field.Index), storedField, p)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchElement returns the stored slice element with the same key, or with the same index when the elements have no key
+func matchElement(elem reflect.Value, stored reflect.Value, index int) reflect.Value {
+	if !stored.IsValid() {
+		return reflect.Value{}
+	}
+	if elem.Kind() == reflect.Struct {
+		for _, field := range yamlFields(elem.Type()) {
+			if field.Tag.Get("secret") != "key" {
+				continue
+			}
+			for j := 0; j < stored.Len(); j++ {
+				if stored.Index(j).FieldByIndex(field.Index).Interface() == elem.FieldByIndex(field.Index).Interface() {
+					return stored.Index(j)
+				}
+			}
+			return reflect.Value{}
+		}
+	}
+	if index < stored.Len() {
+		return stored.Index(index)
+	}
+	return reflect.Value{}
+}
+
+func restoreSecret(v reflect.Value, stored reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() != SecretMask {
+			return nil
+		}
+		if !stored.IsValid() || stored.String() == "" {
+			return FieldError{Path: path, Message: "the secret is masked but there is no stored value"}
+		}
+		v.SetString(stored.String())
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.IsZero() && stored.IsValid() {
+			v.Set(stored)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if iter.Value().Kind() != reflect.String || iter.Value().String() != SecretMask {
+				continue
+			}
+			var value reflect.Value
+			if stored.IsValid() && !stored.IsNil() {
+				value = stored.MapIndex(iter.Key())
+			}
+			if !value.IsValid() {
+				return FieldError{Path: fmt.Sprintf("%s.%v", path, iter.Key()), Message: "the secret is masked but there is no stored value"}
+			}
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return nil
+}
+
+// ResolveSecrets reads the secrets from the *_file fields and expands the ${NAME} environment variable references
+func ResolveSecrets(c *Config) error {
+	return resolveValue(reflect.ValueOf(c).Elem(), "")
+}
+
+func resolveValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return resolveValue(v.Elem(), path)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range yamlFields(v.Type()) {
+			var err error
+			if field.Tag.Get("secret") == "true" {
+				err = resolveSecret(v, field, path)
+			} else {
+				err = resolveValue(v.FieldByIndex(field.Index), fieldPath(path, yamlName(field)))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// secretFile returns the value of the *_file field of a secret
+func secretFile(parent reflect.Value, field reflect.StructField) (string, string) {
+	name := yamlName(field) + "_file"
+	for _, sibling := range yamlFields(parent.Type()) {
+		if yamlName(sibling) == name {
+			return name, parent.FieldByIndex(sibling.Index).String()
+		}
+	}
+	return name, ""
+}
+
+func resolveSecret(parent reflect.Value, field reflect.StructField, parentPath string) error {
+	v := parent.FieldByIndex(field.Index)
+	path := fieldPath(parentPath, yamlName(field))
+	if fileField, file := secretFile(parent, field); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fieldPath(parentPath, fileField), err)
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(value)
+		case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, v.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("%s: invalid number in %s", path, file)
+			}
+			v.SetUint(n)
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := expandEnv(v.String(), path)
+		if err != nil {
+			return err
+		}
+		v.SetString(expanded)
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if iter.Value().Kind() != reflect.String {
+				continue
+			}
+			expanded, err := expandEnv(iter.Value().String(), fmt.Sprintf("%s.%v", path, iter.Key()))
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(expanded).Convert(iter.Value().Type()))
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces the ${NAME} references, other $ characters are kept as they may be part of the secret
+func expandEnv(value string, path string) (string, error) {
+	var missing string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return env
+	})
+	if missing != "" {
+		return "", fmt.Errorf("%s: environment variable %s is not set", path, missing)
+	}
+	return expanded, nil
+}
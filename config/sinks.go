@@ -0,0 +1,113 @@
+package config
+
+// SinkFilter selects the tags and the fields sent to a sink, on top of the enabled tags. A tag is
+// sent when it is in tags or in one of the groups, or when both are empty, and it is not excluded.
+type SinkFilter struct {
+	// MAC addresses of the tags, empty for all enabled tags
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Names of tag_groups whose tags are sent
+	Groups        []string `yaml:"groups,omitempty" json:"groups,omitempty"`
+	ExcludeTags   []string `yaml:"exclude_tags,omitempty" json:"exclude_tags,omitempty"`
+	ExcludeGroups []string `yaml:"exclude_groups,omitempty" json:"exclude_groups,omitempty"`
+	// Measurement fields by their JSON names, eg. temperature, empty for all fields. The name,
+	// MAC, timestamp and data format are always sent.
+	Fields        []string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	ExcludeFields []string `yaml:"exclude_fields,omitempty" json:"exclude_fields,omitempty"`
+}
+
+// SinkOptions are the options shared by the sinks with named instances, they are inlined in the
+// YAML and JSON of each sink
+type SinkOptions struct {
+	// Name of the instance, required in the lists of instances
+	Name            string      `yaml:"name,omitempty" json:"name,omitempty" secret:"key"`
+	Filter          *SinkFilter `yaml:"filter,omitempty" json:"filter,omitempty"`
+	MinimumInterval Duration    `yaml:"minimum_interval,omitempty" json:"minimum_interval,omitempty"`
+	// Publish a tag only when a field changes by at least its deadband, eg. temperature: 0.1
+	Deadbands map[string]float64 `yaml:"deadbands,omitempty" json:"deadbands,omitempty"`
+	// With deadbands, publish unchanged values at least this often
+	Heartbeat Duration `yaml:"heartbeat,omitempty" json:"heartbeat,omitempty"`
+	// Send the mean, min, max and count of each field per tag once per window instead of every measurement
+	AggregationWindow Duration `yaml:"aggregation_window,omitempty" json:"aggregation_window,omitempty"`
+}
+
+// normalizeSinks maps the older sink specific options onto the shared sink options
+func normalizeSinks(c *Config) {
+	if c.MQTTPublisher != nil {
+		mqttFieldsFilter(c.MQTTPublisher)
+	}
+	for i := range c.MQTTPublishers {
+		mqttFieldsFilter(&c.MQTTPublishers[i])
+	}
+}
+
+// mqttFieldsFilter moves the MQTT field allowlist into filter.fields, unless filter.fields is set
+// too, which the validation reports
+func mqttFieldsFilter(p *MQTTPublisher) {
+	if len(p.Fields) == 0 || (p.Filter != nil && len(p.Filter.Fields) > 0) {
+		return
+	}
+	filter := SinkFilter{}
+	if p.Filter != nil {
+		filter = *p.Filter
+	}
+	filter.Fields, p.Fields = p.Fields, nil
+	p.Filter = &filter
+}
+
+// SinkName is the name of a sink instance in the logs and metrics, eg. "mqtt" for the single
+// object form and "mqtt:cloud" for the instance named cloud
+func SinkName(kind string, name string) string {
+	if name == "" {
+		return kind
+	}
+	return kind + ":" + name
+}
+
+// instances returns the single object form of a sink followed by the named instances
+func instances[T any](single *T, list []T) []T {
+	var all []T
+	if single != nil {
+		all = append(all, *single)
+	}
+	return append(all, list...)
+}
+
+func (c Config) InfluxDBPublisherInstances() []InfluxDBPublisher {
+	return instances(c.InfluxDBPublisher, c.InfluxDBPublishers)
+}
+
+func (c Config) InfluxDB3PublisherInstances() []InfluxDB3Publisher {
+	return instances(c.InfluxDB3Publisher, c.InfluxDB3Publishers)
+}
+
+func (c Config) InfluxDB1PublisherInstances() []InfluxDB1Publisher {
+	return instances(c.InfluxDB1Publisher, c.InfluxDB1Publishers)
+}
+
+func (c Config) PostgresPublisherInstances() []PostgresPublisher {
+	return instances(c.PostgresPublisher, c.PostgresPublishers)
+}
+
+func (c Config) SQLitePublisherInstances() []SQLitePublisher {
+	return instances(c.SQLitePublisher, c.SQLitePublishers)
+}
+
+func (c Config) PrometheusRemoteWriteInstances() []PrometheusRemoteWrite {
+	return instances(c.PrometheusRemoteWrite, c.PrometheusRemoteWrites)
+}
+
+func (c Config) OTLPInstances() []OTLP {
+	return instances(c.OTLP, c.OTLPExporters)
+}
+
+func (c Config) MQTTPublisherInstances() []MQTTPublisher {
+	return instances(c.MQTTPublisher, c.MQTTPublishers)
+}
+
+func (c Config) KafkaPublisherInstances() []KafkaPublisher {
+	return instances(c.KafkaPublisher, c.KafkaPublishers)
+}
+
+func (c Config) NATSPublisherInstances() []NATSPublisher {
+	return instances(c.NATSPublisher, c.NATSPublishers)
+}
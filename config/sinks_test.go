@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinkInstances(t *testing.T) {
+	path := writeTestConfig(t, `mqtt_publisher:
+  broker_url: tcp://localhost:1883
+  fields: [temperature, humidity]
+mqtt_publishers:
+  - name: cloud
+    broker_url: ssl://broker.example.com:8883
+    filter:
+      tags: [AA:BB:CC:DD:EE:01]
+  - name: backup
+    enabled: false
+    broker_url: tcp://backup:1883
+influxdb_publishers:
+  - name: fast
+    url: http://localhost:8086
+    bucket: fast
+  - name: slow
+    url: http://localhost:8086
+    bucket: slow
+    minimum_interval: 5m
+`)
+	// Strict loading checks that the inline SinkOptions fields are known
+	c, _, err := (Layers{
+		Path:      path,
+		Environ:   []string{"RUUVI_MQTT_PUBLISHERS__1__ENABLED=true"},
+		Overrides: Overrides{"mqtt_publishers[0].minimum_interval=30s"},
+		Strict:    true,
+	}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(c); err != nil {
+		t.Fatal(err)
+	}
+	mqtt := c.MQTTPublisherInstances()
+	if len(mqtt) != 3 || mqtt[0].Name != "" || mqtt[1].Name != "cloud" || mqtt[2].Name != "backup" {
+		t.Fatalf("mqtt instances: %+v", mqtt)
+	}
+	if mqtt[0].Filter == nil || strings.Join(mqtt[0].Filter.Fields, ",") != "temperature,humidity" || mqtt[0].Fields != nil {
+		t.Errorf("fields were not moved to the filter: %+v %v", mqtt[0].Filter, mqtt[0].Fields)
+	}
+	if mqtt[1].Filter == nil || len(mqtt[1].Filter.Tags) != 1 {
+		t.Errorf("cloud filter: %+v", mqtt[1].Filter)
+	}
+	if mqtt[1].MinimumInterval != Duration(30*time.Second) {
+		t.Errorf("cloud minimum interval: %v", mqtt[1].MinimumInterval)
+	}
+	if mqtt[2].Enabled == nil || !*mqtt[2].Enabled {
+		t.Error("the environment did not enable the backup instance")
+	}
+	influx := c.InfluxDBPublisherInstances()
+	if len(influx) != 2 || influx[1].Bucket != "slow" {
+		t.Errorf("influxdb instances: %+v", influx)
+	}
+	// The shared options are inlined in the JSON of the API too
+	data, err := json.Marshal(mqtt[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name":"cloud"`) || !strings.Contains(string(data), `"filter":{`) {
+		t.Errorf("json: %s", data)
+	}
+	if len(c.KafkaPublisherInstances()) != 0 {
+		t.Error("unexpected kafka instances")
+	}
+	if SinkName("mqtt", "") != "mqtt" || SinkName("mqtt", "cloud") != "mqtt:cloud" {
+		t.Error("unexpected sink names")
+	}
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultBackupCount = 10
+	backupTimeFormat   = "20060102T150405.000000Z"
+)
+
+// ErrBackupNotFound is returned when rolling back to a backup which does not exist
+var ErrBackupNotFound = errors.New("config backup not found")
+
+var backupIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{6}Z$`)
+
+// Backup is a copy of the config file from before it was changed
+type Backup struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// Store reads and writes the config file. Writes are serialized, validated and atomic, the
+// previous versions are kept as timestamped backups and the comments of the file are preserved.
+type Store struct {
+	path      string
+	backupDir string
+	backups   int
+
+	mu sync.Mutex
+}
+
+func NewStore(path string, conf *ConfigBackups) *Store {
+	s := &Store{path: path, backups: defaultBackupCount}
+	if conf != nil {
+		if conf.Count != 0 {
+			s.backups = conf.Count
+		}
+		s.backupDir = conf.Dir
+	}
+	if s.backupDir == "" {
+		s.backupDir = filepath.Join(filepath.Dir(path), "config_backups")
+	}
+	return s
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Read returns the config file as it is, the ${NAME} references and *_file secrets are not resolved
+func (s *Store) Read() (Config, error) {
+	_, c, err := s.read()
+	return c, err
+}
+
+func (s *Store) read() ([]byte, Config, error) {
+	var c Config
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// The config may be given with environment variables only, the first change creates the file
+		return nil, c, nil
+	}
+	if err != nil {
+		return nil, c, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, c, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return data, c, nil
+}
+
+// Update applies modify to the config and writes it unless modify made it invalid. Values which
+// were already invalid in the file are logged but do not block the change. The config is not
+// written when modify returns an error.
+func (s *Store) Update(modify func(c *Config) error) (Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, c, err := s.read()
+	if err != nil {
+		return c, err
+	}
+	// A separate copy, modify may change the maps and slices of c in place
+	var before Config
+	if err := yaml.Unmarshal(old, &before); err != nil {
+		return c, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := modify(&c); err != nil {
+		return c, err
+	}
+	if err := ValidateChange(before, c); err != nil {
+		return c, err
+	}
+	data, err := mergeYAML(old, &c)
+	if err != nil {
+		return c, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := s.write(old, data); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// ValidateChange returns the validation errors of the changed config which the config did not
+// have before the change, eg. a bad URL in a disabled sink does not block renaming a tag
+func ValidateChange(before Config, after Config) error {
+	err := Validate(after)
+	var afterErrors ValidationError
+	if !errors.As(err, &afterErrors) {
+		return err
+	}
+	existing := make(map[FieldError]bool)
+	var beforeErrors ValidationError
+	if errors.As(Validate(before), &beforeErrors) {
+		for _, e := range beforeErrors {
+			existing[e] = true
+		}
+	}
+	var added ValidationError
+	for _, e := range afterErrors {
+		if existing[e] {
+			log.WithField("path", e.Path).Warn("Config has an invalid value: " + e.Message)
+			continue
+		}
+		added = append(added, e)
+	}
+	if len(added) > 0 {
+		return added
+	}
+	return nil
+}
+
+// write backs up the current content and replaces the file
+func (s *Store) write(old []byte, data []byte) error {
+	if bytes.Equal(old, data) {
+		return nil
+	}
+	if len(old) > 0 {
+		if err := s.backup(old); err != nil {
+			return fmt.Errorf("failed to back up config: %w", err)
+		}
+	}
+	if err := writeAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// writeAtomic writes the data to a temporary file and renames it over the file, so that a crash
+// leaves either the old or the new content
+func writeAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		// A file bind mounted into a container cannot be replaced, write it in place instead
+		return writeInPlace(path, data)
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func writeInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// backupName returns the file name of a backup, eg. config-20240102T150405.000000Z.yml
+func (s *Store) backupName(id string) string {
+	base := filepath.Base(s.path)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-" + id + ext
+}
+
+func (s *Store) backup(data []byte) error {
+	if s.backups < 0 {
+		return nil
+	}
+	if err := os.MkdirAll(s.backupDir, 0700); err != nil {
+		return err
+	}
+	id := time.Now().UTC().Format(backupTimeFormat)
+	// Backups contain the secrets, so they are only readable by the owner
+	if err := os.WriteFile(filepath.Join(s.backupDir, s.backupName(id)), data, 0600); err != nil {
+		return err
+	}
+	backups, err := s.history()
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(len(backups), s.backups):] {
+		os.Remove(filepath.Join(s.backupDir, s.backupName(b.ID)))
+	}
+	return nil
+}
+
+// History returns the backups, newest first
+func (s *Store) History() ([]Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history()
+}
+
+func (s *Store) history() ([]Backup, error) {
+	entries, err := os.ReadDir(s.backupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(s.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	backups := []Backup{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, err := time.Parse(backupTimeFormat, id)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{ID: id, Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// Rollback restores a backup, the current config is backed up first so that the rollback can be undone.
+// Like with Update, the values which are invalid in the current config too do not block the rollback.
+func (s *Store) Rollback(id string) (Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var c Config
+	if !backupIDPattern.MatchString(id) {
+		return c, ErrBackupNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.backupDir, s.backupName(id)))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, ErrBackupNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("failed to parse backup: %w", err)
+	}
+	old, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return c, fmt.Errorf("failed to read config: %w", err)
+	}
+	// A current file which does not parse is compared as empty, the backup must then be valid
+	var current Config
+	if err := yaml.Unmarshal(old, &current); err != nil {
+		current = Config{}
+	}
+	if err := ValidateChange(current, c); err != nil {
+		return c, err
+	}
+	return c, s.write(old, data)
+}
+
+// mergeYAML returns the config as YAML in the layout of the old file: the comments and the order of
+// the existing keys are kept, new keys are added after them and removed keys are dropped
+func mergeYAML(old []byte, c *Config) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(old, &doc); err != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}
+	} else {
+		doc.Content[0] = mergeNode(doc.Content[0], &node)
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mergeNode(old *yaml.Node, node *yaml.Node) *yaml.Node {
+	if node.HeadComment == "" {
+		node.HeadComment = old.HeadComment
+	}
+	if node.LineComment == "" {
+		node.LineComment = old.LineComment
+	}
+	if node.FootComment == "" {
+		node.FootComment = old.FootComment
+	}
+	switch {
+	case old.Kind == yaml.MappingNode && node.Kind == yaml.MappingNode:
+		values := make(map[string]*yaml.Node, len(node.Content)/2)
+		var order []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			values[node.Content[i].Value] = node.Content[i+1]
+			order = append(order, node.Content[i].Value)
+		}
+		content := make([]*yaml.Node, 0, len(node.Content))
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			key := old.Content[i]
+			value, ok := values[key.Value]
+			if !ok {
+				continue
+			}
+			content = append(content, key, mergeNode(old.Content[i+1], value))
+			delete(values, key.Value)
+		}
+		for _, key := range order {
+			if value, ok := values[key]; ok {
+				content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+			}
+		}
+		node.Content = content
+	case old.Kind == yaml.SequenceNode && node.Kind == yaml.SequenceNode:
+		for i := range node.Content {
+			if i < len(old.Content) {
+				node.Content[i] = mergeNode(old.Content[i], node.Content[i])
+			}
+		}
+	}
+	return node
+}
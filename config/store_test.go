@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testStoreConfig = `# Gateway config
+gw_mac: 00:00:00:00:00:00
+
+# Publish to MQTT
+mqtt_publisher:
+  enabled: true
+  broker_url: tcp://localhost:1883 # local broker
+  # Leave empty for anonymous access
+  username: ""
+  password: ""
+  topic_prefix: ruuvi
+
+tag_names:
+  AA:BB:CC:DD:EE:FF: Sauna
+`
+
+func newTestStore(t *testing.T, content string, backups int) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(path, &ConfigBackups{Count: backups})
+}
+
+func TestStore_PreservesComments(t *testing.T) {
+	s := newTestStore(t, testStoreConfig, 0)
+	_, err := s.Update(func(c *Config) error {
+		c.TagNames["11:22:33:44:55:66"] = "Garage"
+		c.MQTTPublisher.TopicPrefix = "home"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{"# Gateway config", "# Publish to MQTT", "# local broker", "# Leave empty for anonymous access", "topic_prefix: home", "11:22:33:44:55:66: Garage"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("%q missing from:\n%s", want, text)
+		}
+	}
+	// The existing keys keep their order
+	if strings.Index(text, "gw_mac") > strings.Index(text, "mqtt_publisher") || strings.Index(text, "mqtt_publisher") > strings.Index(text, "tag_names") {
+		t.Errorf("key order changed:\n%s", text)
+	}
+	if info, _ := os.Stat(s.Path()); info.Mode().Perm() != 0640 {
+		t.Errorf("file mode changed to %v", info.Mode())
+	}
+}
+
+func TestStore_Validation(t *testing.T) {
+	s := newTestStore(t, testStoreConfig, 0)
+	_, err := s.Update(func(c *Config) error {
+		c.HTTPListener = &HTTPListener{Port: 70000}
+		c.TagNames["not-a-mac"] = "Broken"
+		return nil
+	})
+	var invalid ValidationError
+	if !errors.As(err, &invalid) || len(invalid) != 2 {
+		t.Fatalf("got %v", err)
+	}
+	if invalid[0].Path != "tag_names.not-a-mac" && invalid[1].Path != "tag_names.not-a-mac" {
+		t.Errorf("got %v", invalid)
+	}
+	data, _ := os.ReadFile(s.Path())
+	if string(data) != testStoreConfig {
+		t.Error("invalid config was written")
+	}
+}
+
+func TestStore_PreExistingErrors(t *testing.T) {
+	// A bad URL in a disabled sink is already in the file
+	s := newTestStore(t, testStoreConfig+"influxdb_publisher:\n  enabled: false\n  url: localhost:8086\n", 0)
+	_, err := s.Update(func(c *Config) error {
+		c.TagNames["11:22:33:44:55:66"] = "Garage"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unrelated change was rejected: %v", err)
+	}
+
+	// New invalid values are still rejected, the old ones are not reported again
+	_, err = s.Update(func(c *Config) error {
+		c.TagNames["not-a-mac"] = "Broken"
+		return nil
+	})
+	var invalid ValidationError
+	if !errors.As(err, &invalid) || len(invalid) != 1 || invalid[0].Path != "tag_names.not-a-mac" {
+		t.Fatalf("got %v", err)
+	}
+
+	// The backup of the first version has the same bad URL, it can be restored
+	history, err := s.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d backups", len(history))
+	}
+	c, err := s.Rollback(history[0].ID)
+	if err != nil {
+		t.Fatalf("rollback was rejected: %v", err)
+	}
+	if _, ok := c.TagNames["11:22:33:44:55:66"]; ok {
+		t.Error("rollback did not restore the backup")
+	}
+}
+
+func TestStore_BackupsAndRollback(t *testing.T) {
+	s := newTestStore(t, testStoreConfig, 3)
+	for i := 0; i < 5; i++ {
+		_, err := s.Update(func(c *Config) error {
+			c.MQTTPublisher.TopicPrefix = fmt.Sprintf("prefix%d", i)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := s.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d backups", len(history))
+	}
+	if !history[0].Time.After(history[2].Time) {
+		t.Error("history is not sorted newest first")
+	}
+	if info, _ := os.Stat(filepath.Join(s.backupDir, s.backupName(history[0].ID))); info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode %v", info.Mode())
+	}
+
+	// The newest backup is the version before the last update
+	c, err := s.Rollback(history[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MQTTPublisher.TopicPrefix != "prefix3" {
+		t.Errorf("got %s", c.MQTTPublisher.TopicPrefix)
+	}
+	current, _ := s.Read()
+	if current.MQTTPublisher.TopicPrefix != "prefix3" {
+		t.Errorf("after rollback: %s", current.MQTTPublisher.TopicPrefix)
+	}
+
+	if _, err := s.Rollback("../config"); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("invalid id: got %v", err)
+	}
+	if _, err := s.Rollback("20000101T000000.000000Z"); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("unknown id: got %v", err)
+	}
+}
+
+func TestStore_ConcurrentUpdates(t *testing.T) {
+	s := newTestStore(t, testStoreConfig, -1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Update(func(c *Config) error {
+				c.TagNames[fmt.Sprintf("AA:BB:CC:DD:EE:%02d", i)] = fmt.Sprintf("Tag %d", i)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	c, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.TagNames) != 21 {
+		t.Errorf("lost updates, got %d tag names", len(c.TagNames))
+	}
+	if _, err := os.Stat(s.backupDir); !os.IsNotExist(err) {
+		t.Error("backups were written although they are disabled")
+	}
+}
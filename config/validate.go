@@ -0,0 +1,725 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/Saavuori/ruuvi-go-gateway/value_calculator"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	macPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
+	// Line prefix of the YAML decoding errors, eg. "line 3: cannot unmarshal !!str `abc` into int"
+	yamlLinePattern = regexp.MustCompile(`^line (\d+): (.*)$`)
+)
+
+// FieldError is an invalid config value, Path is the YAML path of the value, eg. mqtt_publisher.broker_port
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists all invalid values of a config
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+type validator struct {
+	errors ValidationError
+	// Names of the sink instances, see SinkName
+	sinks map[string]bool
+	// tag_groups, referenced by the sink filters
+	groups map[string][]string
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func enabled(e *bool) bool {
+	return e == nil || *e
+}
+
+// required checks that a value of an enabled section is set, or read from a *_file
+func (v *validator) required(path string, value string, file string) {
+	if value == "" && file == "" {
+		v.fail(path, "required")
+	}
+}
+
+// port checks an optional port, 0 means the default
+func (v *validator) port(path string, port int) {
+	if port < 0 || port > 65535 {
+		v.fail(path, "port %d is not between 1 and 65535", port)
+	}
+}
+
+// url checks an optional URL, the scheme must be one of schemes when given
+func (v *validator) url(path string, value string, schemes ...string) {
+	if value == "" || strings.Contains(value, "${") {
+		return
+	}
+	if !strings.Contains(value, "://") {
+		v.fail(path, "missing scheme, eg. %s://%s", firstOr(schemes, "tcp"), value)
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.fail(path, "invalid URL: %v", err)
+		return
+	}
+	if u.Host == "" {
+		v.fail(path, "missing host")
+		return
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			v.fail(path, "invalid port %q", port)
+			return
+		}
+	}
+	if len(schemes) > 0 {
+		for _, scheme := range schemes {
+			if strings.EqualFold(u.Scheme, scheme) {
+				return
+			}
+		}
+		v.fail(path, "scheme %q is not one of %s", u.Scheme, strings.Join(schemes, ", "))
+	}
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return fallback
+}
+
+// hostPort checks an address without a scheme, eg. localhost:9092
+func (v *validator) hostPort(path string, value string) {
+	if strings.Contains(value, "${") {
+		return
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.fail(path, "expected host:port, got %q", value)
+		return
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+		v.fail(path, "expected host:port, got %q", value)
+	}
+}
+
+func (v *validator) duration(path string, d Duration) {
+	if d < 0 {
+		v.fail(path, "duration must not be negative")
+	}
+}
+
+func (v *validator) nonNegative(path string, n int) {
+	if n < 0 {
+		v.fail(path, "must not be negative")
+	}
+}
+
+func (v *validator) mac(path string, mac string) {
+	if !macPattern.MatchString(strings.TrimSpace(mac)) {
+		v.fail(path, "invalid MAC address %q", mac)
+	}
+}
+
+// oneOf checks an optional value against the accepted values, case-insensitively
+func (v *validator) oneOf(path string, value string, values ...string) {
+	if value == "" {
+		return
+	}
+	for _, allowed := range values {
+		if strings.EqualFold(value, allowed) {
+			return
+		}
+	}
+	v.fail(path, "%q is not one of %s", value, strings.Join(values, ", "))
+}
+
+// template checks the syntax of a Go text/template, the functions are checked by the sinks
+func (v *validator) template(path string, text string) {
+	if text == "" {
+		return
+	}
+	tree := parse.New(path)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*parse.Tree{}); err != nil {
+		v.fail(path, "invalid template: %v", err)
+	}
+}
+
+func (v *validator) clientTLS(path string, t *TLS) {
+	if t == nil {
+		return
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		v.fail(path, "cert_file and key_file must be given together")
+	}
+}
+
+func (v *validator) role(path string, role string) {
+	v.oneOf(path, role, "admin", "read-only", "readonly", "read")
+}
+
+func (v *validator) auth(a *Auth) {
+	v.duration("auth.session_ttl", a.SessionTTL)
+	usernames := make(map[string]bool)
+	for i, u := range a.Users {
+		path := fmt.Sprintf("auth.users[%d]", i)
+		if u.Username == "" {
+			v.fail(path+".username", "required")
+		} else if usernames[u.Username] {
+			v.fail(path+".username", "duplicate user %q", u.Username)
+		}
+		usernames[u.Username] = true
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil && !strings.Contains(u.PasswordHash, "${") {
+			v.fail(path+".password_hash", "not a bcrypt hash, create one with: ruuvi-go-gateway hash-password")
+		}
+		v.role(path+".role", u.Role)
+	}
+	for i, t := range a.Tokens {
+		path := fmt.Sprintf("auth.tokens[%d]", i)
+		if t.Name == "" {
+			v.fail(path+".name", "required")
+		}
+		if hash, err := hex.DecodeString(t.TokenSHA256); (err != nil || len(hash) != 32) && !strings.Contains(t.TokenSHA256, "${") {
+			v.fail(path+".token_sha256", "not a hex encoded SHA-256 hash, create a token with: ruuvi-go-gateway generate-token")
+		}
+		v.role(path+".role", t.Role)
+	}
+	if p := a.Proxy; p != nil && p.Enabled {
+		if len(p.TrustedProxies) == 0 {
+			v.fail("auth.proxy.trusted_proxies", "required when proxy auth is enabled")
+		}
+		for i, value := range p.TrustedProxies {
+			if _, _, err := net.ParseCIDR(value); err != nil && net.ParseIP(value) == nil {
+				v.fail(fmt.Sprintf("auth.proxy.trusted_proxies[%d]", i), "invalid address or CIDR %q", value)
+			}
+		}
+		v.role("auth.proxy.default_role", p.DefaultRole)
+	}
+}
+
+// instance checks the name and the tag filter of a sink instance. The names of the sinks must
+// be unique as they label the metrics, instances in the lists must be named.
+func (v *validator) instance(path string, kind string, name string, filter *SinkFilter, named bool) {
+	if named && name == "" {
+		v.fail(path+".name", "required")
+	} else if sink := SinkName(kind, name); v.sinks[sink] {
+		v.fail(path+".name", "duplicate instance %q", sink)
+	} else {
+		if v.sinks == nil {
+			v.sinks = make(map[string]bool)
+		}
+		v.sinks[sink] = true
+	}
+	if filter != nil {
+		v.filter(path+".filter", filter)
+	}
+}
+
+func (v *validator) filter(path string, f *SinkFilter) {
+	for i, mac := range f.Tags {
+		v.mac(fmt.Sprintf("%s.tags[%d]", path, i), mac)
+	}
+	for i, mac := range f.ExcludeTags {
+		v.mac(fmt.Sprintf("%s.exclude_tags[%d]", path, i), mac)
+	}
+	for i, group := range f.Groups {
+		if _, ok := v.groups[group]; !ok {
+			v.fail(fmt.Sprintf("%s.groups[%d]", path, i), "unknown tag group %q", group)
+		}
+	}
+	for i, group := range f.ExcludeGroups {
+		if _, ok := v.groups[group]; !ok {
+			v.fail(fmt.Sprintf("%s.exclude_groups[%d]", path, i), "unknown tag group %q", group)
+		}
+	}
+	for i, name := range f.Fields {
+		if _, ok := parser.FieldByName(name); !ok {
+			v.fail(fmt.Sprintf("%s.fields[%d]", path, i), "unknown field %q", name)
+		}
+	}
+	for i, name := range f.ExcludeFields {
+		if _, ok := parser.FieldByName(name); !ok {
+			v.fail(fmt.Sprintf("%s.exclude_fields[%d]", path, i), "unknown field %q", name)
+		}
+	}
+}
+
+// publishing checks the change based publishing options of a sink
+func (v *validator) publishing(path string, minimumInterval Duration, heartbeat Duration, deadbands map[string]float64) {
+	v.duration(path+".minimum_interval", minimumInterval)
+	v.duration(path+".heartbeat", heartbeat)
+	if heartbeat > 0 && heartbeat < minimumInterval {
+		v.fail(path+".heartbeat", "shorter than minimum_interval")
+	}
+	for name, delta := range deadbands {
+		if _, ok := parser.FieldByName(name); !ok {
+			v.fail(path+".deadbands."+name, "unknown field %q", name)
+		} else if delta < 0 {
+			v.fail(path+".deadbands."+name, "must not be negative")
+		}
+	}
+}
+
+// smoothing checks the filters of each field, only numeric fields can be smoothed
+func (v *validator) smoothing(path string, s Smoothing) {
+	for name, filters := range s.Fields {
+		fieldPath := path + ".fields." + name
+		if f, ok := parser.FieldByName(name); !ok {
+			v.fail(fieldPath, "unknown field %q", name)
+		} else if f.Kind == parser.BoolField {
+			v.fail(fieldPath, "%q is not numeric", name)
+		} else if slices.Contains(value_calculator.CalculatedFields, name) {
+			v.fail(fieldPath, "%q is calculated from the smoothed values, smooth the fields it is calculated from", name)
+		}
+		for i, f := range filters {
+			filterPath := fmt.Sprintf("%s[%d]", fieldPath, i)
+			if f.Type == "" {
+				v.fail(filterPath+".type", "required")
+			}
+			v.oneOf(filterPath+".type", f.Type, "moving_average", "ewma", "median")
+			v.nonNegative(filterPath+".window", f.Window)
+			if f.Alpha < 0 || f.Alpha > 1 {
+				v.fail(filterPath+".alpha", "must be between 0 and 1")
+			}
+		}
+	}
+}
+
+// aggregation checks the aggregation window, the sink must not drop the aggregated measurements
+func (v *validator) aggregation(path string, window Duration, minimumInterval Duration) {
+	v.duration(path+".aggregation_window", window)
+	if window > 0 && minimumInterval > window {
+		v.fail(path+".minimum_interval", "longer than aggregation_window, aggregated measurements would be dropped")
+	}
+}
+
+func (v *validator) influxDB(path string, p InfluxDBPublisher, named bool) {
+	v.instance(path, "influxdb", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".url", p.Url, "")
+	}
+	v.url(path+".url", p.Url, "http", "https")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+}
+
+func (v *validator) influxDB3(path string, p InfluxDB3Publisher, named bool) {
+	v.instance(path, "influxdb3", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".url", p.Url, "")
+	}
+	v.url(path+".url", p.Url, "http", "https")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+}
+
+func (v *validator) influxDB1(path string, p InfluxDB1Publisher, named bool) {
+	v.instance(path, "influxdb1", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".url", p.Url, "")
+	}
+	v.oneOf(path+".protocol", p.Protocol, "http", "udp", "tcp")
+	if p.Protocol == "" || strings.EqualFold(p.Protocol, "http") {
+		v.url(path+".url", p.Url, "http", "https")
+	} else if p.Url != "" {
+		v.hostPort(path+".url", p.Url)
+	}
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".timeout", p.Timeout)
+}
+
+func (v *validator) prometheusRemoteWrite(path string, p PrometheusRemoteWrite, named bool) {
+	v.instance(path, "prometheus_remote_write", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".url", p.Url, "")
+	}
+	v.url(path+".url", p.Url, "http", "https")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".flush_interval", p.FlushInterval)
+	v.duration(path+".timeout", p.Timeout)
+	v.nonNegative(path+".batch_size", p.BatchSize)
+	if p.MaxRetries != nil {
+		v.nonNegative(path+".max_retries", *p.MaxRetries)
+	}
+}
+
+func (v *validator) otlp(path string, p OTLP, named bool) {
+	v.instance(path, "otlp", p.Name, p.Filter, named)
+	v.oneOf(path+".protocol", p.Protocol, "http", "http/protobuf", "grpc")
+	v.oneOf(path+".temporality", p.Temporality, "cumulative", "delta")
+	v.url(path+".url", p.Url, "http", "https")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".export_interval", p.ExportInterval)
+	v.duration(path+".timeout", p.Timeout)
+	v.duration(path+".series_ttl", p.SeriesTTL)
+}
+
+func (v *validator) mqttPublisher(path string, p MQTTPublisher, named bool) {
+	v.instance(path, "mqtt", p.Name, p.Filter, named)
+	if enabled(p.Enabled) && p.BrokerUrl == "" && p.BrokerAddress == "" {
+		v.fail(path+".broker_url", "required, or broker_address")
+	}
+	v.url(path+".broker_url", p.BrokerUrl, "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss")
+	v.port(path+".broker_port", p.BrokerPort)
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".message_expiry", p.MessageExpiry)
+	v.oneOf(path+".protocol_version", p.ProtocolVersion, "3.1.1", "3", "4", "v3", "5", "5.0", "v5")
+	if p.QoS > 2 {
+		v.fail(path+".qos", "QoS %d is not 0, 1 or 2", p.QoS)
+	}
+	for topic, qos := range p.TopicQoS {
+		if qos > 2 {
+			v.fail(path+".topic_qos."+topic, "QoS %d is not 0, 1 or 2", qos)
+		}
+	}
+	v.template(path+".topic_template", p.TopicTemplate)
+	v.template(path+".payload_template", p.PayloadTemplate)
+	v.template(path+".field_topic_template", p.FieldTopicTemplate)
+	v.template(path+".field_payload_template", p.FieldPayloadTemplate)
+	for i, name := range p.Fields {
+		if _, ok := parser.FieldByName(name); !ok {
+			v.fail(fmt.Sprintf("%s.fields[%d]", path, i), "unknown field %q", name)
+		}
+	}
+	if len(p.Fields) > 0 && p.Filter != nil && len(p.Filter.Fields) > 0 {
+		v.fail(path+".fields", "set either fields or filter.fields")
+	}
+}
+
+func (v *validator) postgres(path string, p PostgresPublisher, named bool) {
+	v.instance(path, "postgres", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".connection_string", p.ConnectionString, p.ConnectionStringFile)
+	}
+	v.oneOf(path+".layout", p.Layout, "wide", "narrow")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".flush_interval", p.FlushInterval)
+	v.nonNegative(path+".batch_size", p.BatchSize)
+}
+
+func (v *validator) sqlite(path string, p SQLitePublisher, named bool) {
+	v.instance(path, "sqlite", p.Name, p.Filter, named)
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".retention", p.Retention)
+	v.duration(path+".vacuum_interval", p.VacuumInterval)
+	v.duration(path+".flush_interval", p.FlushInterval)
+	v.nonNegative(path+".batch_size", p.BatchSize)
+}
+
+func (v *validator) kafka(path string, p KafkaPublisher, named bool) {
+	v.instance(path, "kafka", p.Name, p.Filter, named)
+	if enabled(p.Enabled) && len(p.Brokers) == 0 {
+		v.fail(path+".brokers", "required")
+	}
+	for i, broker := range p.Brokers {
+		v.hostPort(fmt.Sprintf("%s.brokers[%d]", path, i), broker)
+	}
+	v.template(path+".topic_template", p.TopicTemplate)
+	v.oneOf(path+".acks", p.Acks, "all", "leader", "none")
+	v.oneOf(path+".compression", p.Compression, "none", "gzip", "snappy", "lz4", "zstd")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".timeout", p.Timeout)
+	v.clientTLS(path+".tls", p.TLS)
+	if s := p.SASL; s != nil {
+		if s.Mechanism == "" {
+			v.fail(path+".sasl.mechanism", "required")
+		}
+		v.oneOf(path+".sasl.mechanism", s.Mechanism, "plain", "scram-sha-256", "scram-sha-512")
+	}
+}
+
+func (v *validator) nats(path string, p NATSPublisher, named bool) {
+	v.instance(path, "nats", p.Name, p.Filter, named)
+	if enabled(p.Enabled) {
+		v.required(path+".url", p.Url, "")
+	}
+	if p.Url != "" {
+		for i, u := range strings.Split(p.Url, ",") {
+			v.url(fmt.Sprintf("%s.url[%d]", path, i), strings.TrimSpace(u), "nats", "tls", "ws", "wss")
+		}
+	}
+	v.template(path+".subject_template", p.SubjectTemplate)
+	v.oneOf(path+".acks", p.Acks, "jetstream", "none")
+	v.publishing(path, p.MinimumInterval, p.Heartbeat, p.Deadbands)
+	v.aggregation(path, p.AggregationWindow, p.MinimumInterval)
+	v.duration(path+".stream_max_age", p.StreamMaxAge)
+	v.duration(path+".timeout", p.Timeout)
+	v.clientTLS(path+".tls", p.TLS)
+}
+
+func (v *validator) matter(m *Matter) {
+	// Passcodes the Matter specification does not allow
+	switch m.Passcode {
+	case 11111111, 22222222, 33333333, 44444444, 55555555, 66666666, 77777777, 88888888, 99999999, 12345678, 87654321:
+		v.fail("matter.passcode", "passcode %d is not allowed by the Matter specification", m.Passcode)
+	}
+	if m.Passcode > 99999998 {
+		v.fail("matter.passcode", "passcode must be between 1 and 99999998")
+	}
+	if m.Discriminator > 4095 {
+		v.fail("matter.discriminator", "discriminator must be between 0 and 4095")
+	}
+}
+
+// Validate checks the values which can be checked without connecting anywhere. Values which
+// reference environment variables are not checked, required values may also come from *_file.
+func Validate(c Config) error {
+	v := &validator{groups: c.TagGroups}
+	if c.GwMac != "" {
+		v.mac("gw_mac", c.GwMac)
+	}
+	for mac := range c.TagNames {
+		v.mac("tag_names."+mac, mac)
+	}
+	for i, mac := range c.EnabledTags {
+		v.mac(fmt.Sprintf("enabled_tags[%d]", i), mac)
+	}
+	for group, macs := range c.TagGroups {
+		for i, mac := range macs {
+			v.mac(fmt.Sprintf("tag_groups.%s[%d]", group, i), mac)
+		}
+	}
+	v.oneOf("logging.level", c.Logging.Level, "trace", "debug", "info", "warn", "error", "fatal", "panic")
+	v.oneOf("logging.type", c.Logging.Type, "structured", "json", "simple")
+
+	if l := c.GatewayPolling; l != nil {
+		if enabled(l.Enabled) {
+			v.required("gateway_polling.gateway_url", l.GatewayUrl, "")
+		}
+		v.url("gateway_polling.gateway_url", l.GatewayUrl, "http", "https")
+		v.duration("gateway_polling.interval", l.Interval)
+	}
+	if l := c.MQTTListener; l != nil {
+		if enabled(l.Enabled) && l.BrokerUrl == "" && l.BrokerAddress == "" {
+			v.fail("mqtt_listener.broker_url", "required, or broker_address")
+		}
+		v.url("mqtt_listener.broker_url", l.BrokerUrl, "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss")
+		v.port("mqtt_listener.broker_port", l.BrokerPort)
+	}
+	if l := c.HTTPListener; l != nil {
+		v.port("http_listener.port", l.Port)
+		if t := l.TLS; t != nil {
+			if (t.CertFile == "") != (t.KeyFile == "") {
+				v.fail("http_listener.tls", "cert_file and key_file must be given together")
+			}
+			v.port("http_listener.tls.redirect_port", t.RedirectPort)
+			v.duration("http_listener.tls.reload_interval", t.ReloadInterval)
+		}
+	}
+	if l := c.GRPCListener; l != nil {
+		v.port("grpc_listener.port", l.Port)
+	}
+	if a := c.Auth; a != nil && a.Enabled {
+		v.auth(a)
+	}
+	if p := c.Processing; p != nil && p.Smoothing != nil {
+		v.smoothing("processing.smoothing", *p.Smoothing)
+	}
+	if p := c.Prometheus; p != nil {
+		v.port("prometheus.port", p.Port)
+		v.duration("prometheus.series_ttl", p.SeriesTTL)
+		v.aggregation("prometheus", p.AggregationWindow, 0)
+		v.instance("prometheus", "prometheus", "", p.Filter, false)
+	}
+	if p := c.InfluxDBPublisher; p != nil {
+		v.influxDB("influxdb_publisher", *p, false)
+	}
+	for i, p := range c.InfluxDBPublishers {
+		v.influxDB(fmt.Sprintf("influxdb_publishers[%d]", i), p, true)
+	}
+	if p := c.InfluxDB3Publisher; p != nil {
+		v.influxDB3("influxdb3_publisher", *p, false)
+	}
+	for i, p := range c.InfluxDB3Publishers {
+		v.influxDB3(fmt.Sprintf("influxdb3_publishers[%d]", i), p, true)
+	}
+	if p := c.InfluxDB1Publisher; p != nil {
+		v.influxDB1("influxdb1_publisher", *p, false)
+	}
+	for i, p := range c.InfluxDB1Publishers {
+		v.influxDB1(fmt.Sprintf("influxdb1_publishers[%d]", i), p, true)
+	}
+	if p := c.PrometheusRemoteWrite; p != nil {
+		v.prometheusRemoteWrite("prometheus_remote_write", *p, false)
+	}
+	for i, p := range c.PrometheusRemoteWrites {
+		v.prometheusRemoteWrite(fmt.Sprintf("prometheus_remote_writes[%d]", i), p, true)
+	}
+	if p := c.OTLP; p != nil {
+		v.otlp("otlp", *p, false)
+	}
+	for i, p := range c.OTLPExporters {
+		v.otlp(fmt.Sprintf("otlp_exporters[%d]", i), p, true)
+	}
+	if p := c.MQTTPublisher; p != nil {
+		v.mqttPublisher("mqtt_publisher", *p, false)
+	}
+	for i, p := range c.MQTTPublishers {
+		v.mqttPublisher(fmt.Sprintf("mqtt_publishers[%d]", i), p, true)
+	}
+	if p := c.PostgresPublisher; p != nil {
+		v.postgres("postgres_publisher", *p, false)
+	}
+	for i, p := range c.PostgresPublishers {
+		v.postgres(fmt.Sprintf("postgres_publishers[%d]", i), p, true)
+	}
+	if p := c.SQLitePublisher; p != nil {
+		v.sqlite("sqlite_publisher", *p, false)
+	}
+	for i, p := range c.SQLitePublishers {
+		v.sqlite(fmt.Sprintf("sqlite_publishers[%d]", i), p, true)
+	}
+	if p := c.KafkaPublisher; p != nil {
+		v.kafka("kafka_publisher", *p, false)
+	}
+	for i, p := range c.KafkaPublishers {
+		v.kafka(fmt.Sprintf("kafka_publishers[%d]", i), p, true)
+	}
+	if p := c.NATSPublisher; p != nil {
+		v.nats("nats_publisher", *p, false)
+	}
+	for i, p := range c.NATSPublishers {
+		v.nats(fmt.Sprintf("nats_publishers[%d]", i), p, true)
+	}
+	if m := c.Matter; m != nil {
+		v.matter(m)
+	}
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// ValidateFile checks a config file without starting the gateway: unknown fields, values of the
+// wrong type and everything Validate checks. Secrets are not resolved, so the *_file files and
+// the environment variables do not need to exist.
+func ValidateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	v := &validator{}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		v.yamlError(err, nil)
+		return v.errors
+	}
+	// Paths of the values by line, for the decoding errors which only have the line
+	lines := make(map[int]string)
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		v.unknownFields(node.Content[0], reflect.TypeOf(Config{}), "", lines)
+	}
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		v.yamlError(err, lines)
+		// The other values are decoded despite type errors
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return v.errors
+		}
+	}
+	if err := Validate(c); err != nil {
+		v.errors = append(v.errors, err.(ValidationError)...)
+	}
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// yamlError adds the YAML decoding errors, with the path of the value on the line when it is known
+func (v *validator) yamlError(err error, lines map[int]string) {
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	for _, message := range messages {
+		match := yamlLinePattern.FindStringSubmatch(message)
+		if match == nil {
+			v.fail("", "%s", message)
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		if path, ok := lines[line]; ok {
+			v.fail(path, "%s (line %d)", match[2], line)
+		} else {
+			v.fail("line "+match[1], "%s", match[2])
+		}
+	}
+}
+
+// unknownFields reports the mapping keys which do not match a field of the config structs and
+// records the paths of the values by line
+func (v *validator) unknownFields(node *yaml.Node, t reflect.Type, path string, lines map[int]string) {
+	if node.Kind == yaml.ScalarNode {
+		lines[node.Line] = path
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type, t.NumField())
+		for _, field := range yamlFields(t) {
+			fields[yamlName(field)] = field.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			fieldType, ok := fields[key]
+			if !ok {
+				v.fail(fieldPath(path, key), "unknown field (line %d)", node.Content[i].Line)
+				continue
+			}
+			v.unknownFields(node.Content[i+1], fieldType, fieldPath(path, key), lines)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			v.unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), lines)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.unknownFields(node.Content[i+1], t.Elem(), fieldPath(path, node.Content[i].Value), lines)
+		}
+	}
+}
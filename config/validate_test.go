@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func errorPaths(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var invalid ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	paths := make(map[string]string)
+	for _, e := range invalid {
+		paths[e.Path] = e.Message
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	disabled := false
+	c := Config{
+		GwMac:   "AA:BB:CC:DD:EE:FF",
+		Logging: Logging{Level: "verbose", Type: "json"},
+		InfluxDBPublisher: &InfluxDBPublisher{
+			Url: "localhost:8086",
+		},
+		InfluxDB3Publisher: &InfluxDB3Publisher{SinkOptions: SinkOptions{MinimumInterval: Duration(time.Minute), AggregationWindow: Duration(time.Second)}},
+		// Required values are not checked in disabled sections
+		InfluxDB1Publisher: &InfluxDB1Publisher{Enabled: &disabled},
+		MQTTPublisher: &MQTTPublisher{
+			BrokerUrl:     "tcp://localhost:1883",
+			QoS:           3,
+			Fields:        []string{"temperature", "colour"},
+			TopicTemplate: "ruuvi/{{.Mac}",
+			SinkOptions:   SinkOptions{Deadbands: map[string]float64{"temperature": 0.1, "temp": 0.1, "humidity": -1}},
+		},
+		KafkaPublisher: &KafkaPublisher{
+			Brokers:     []string{"localhost:9092", "localhost"},
+			Compression: "brotli",
+		},
+		PostgresPublisher: &PostgresPublisher{ConnectionStringFile: "/run/secrets/postgres"},
+		Auth: &Auth{
+			Enabled: true,
+			Users:   []AuthUser{{Username: "admin", PasswordHash: "plain", Role: "owner"}},
+		},
+		Matter:     &Matter{Passcode: 12345678, Discriminator: 5000},
+		Prometheus: &Prometheus{AggregationWindow: Duration(-time.Second)},
+	}
+	paths := errorPaths(t, Validate(c))
+	want := map[string]string{
+		"logging.level":                        `"verbose" is not one of trace, debug, info, warn, error, fatal, panic`,
+		"influxdb_publisher.url":               "missing scheme, eg. http://localhost:8086",
+		"influxdb3_publisher.url":              "required",
+		"influxdb3_publisher.minimum_interval": "longer than aggregation_window, aggregated measurements would be dropped",
+		"mqtt_publisher.qos":                   "QoS 3 is not 0, 1 or 2",
+		"mqtt_publisher.fields[1]":             `unknown field "colour"`,
+		"mqtt_publisher.deadbands.temp":        `unknown field "temp"`,
+		"mqtt_publisher.deadbands.humidity":    "must not be negative",
+		"kafka_publisher.brokers[1]":           `expected host:port, got "localhost"`,
+		"kafka_publisher.compression":          `"brotli" is not one of none, gzip, snappy, lz4, zstd`,
+		"auth.users[0].password_hash":          "not a bcrypt hash, create one with: ruuvi-go-gateway hash-password",
+		"auth.users[0].role":                   `"owner" is not one of admin, read-only, readonly, read`,
+		"matter.passcode":                      "passcode 12345678 is not allowed by the Matter specification",
+		"matter.discriminator":                 "discriminator must be between 0 and 4095",
+		"prometheus.aggregation_window":        "duration must not be negative",
+	}
+	for path, message := range want {
+		if paths[path] != message {
+			t.Errorf("%s: got %q, want %q", path, paths[path], message)
+		}
+	}
+	if _, ok := paths["mqtt_publisher.topic_template"]; !ok {
+		t.Error("invalid template was not reported")
+	}
+	// Disabled sections and secrets read from files are not required
+	for _, path := range []string{"influxdb1_publisher.url", "postgres_publisher.connection_string"} {
+		if message, ok := paths[path]; ok {
+			t.Errorf("%s: unexpected error %q", path, message)
+		}
+	}
+	if len(paths) != 16 {
+		t.Errorf("got %d errors: %v", len(paths), paths)
+	}
+
+	if err := Validate(Config{GwMac: "00:00:00:00:00:00"}); err != nil {
+		t.Errorf("minimal config: %v", err)
+	}
+}
+
+func TestValidate_Instances(t *testing.T) {
+	c := Config{
+		MQTTPublisher: &MQTTPublisher{SinkOptions: SinkOptions{Name: "cloud"}, BrokerUrl: "tcp://localhost:1883"},
+		MQTTPublishers: []MQTTPublisher{
+			{BrokerUrl: "tcp://localhost:1883"},
+			{SinkOptions: SinkOptions{Name: "cloud"}, BrokerUrl: "tcp://broker:1883"},
+			{
+				SinkOptions: SinkOptions{Name: "local", Filter: &SinkFilter{Tags: []string{"AA:BB:CC:DD:EE"}, Fields: []string{"rssi"}}},
+				BrokerUrl:   "localhost:1883",
+				Fields:      []string{"temperature"},
+			},
+		},
+		// The same name is allowed for different sink types
+		InfluxDBPublishers: []InfluxDBPublisher{{SinkOptions: SinkOptions{Name: "cloud"}, Url: "http://localhost:8086"}},
+		Prometheus: &Prometheus{Filter: &SinkFilter{
+			Groups:        []string{"air", "garage"},
+			Fields:        []string{"temperature", "humidity", "battery"},
+			ExcludeFields: []string{"rssi"},
+		}},
+		TagGroups: map[string][]string{"air": {"AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:0"}},
+	}
+	paths := errorPaths(t, Validate(c))
+	want := map[string]string{
+		"mqtt_publishers[0].name":           "required",
+		"mqtt_publishers[1].name":           `duplicate instance "mqtt:cloud"`,
+		"mqtt_publishers[2].broker_url":     "missing scheme, eg. tcp://localhost:1883",
+		"mqtt_publishers[2].filter.tags[0]": `invalid MAC address "AA:BB:CC:DD:EE"`,
+		"mqtt_publishers[2].fields":         "set either fields or filter.fields",
+		"prometheus.filter.groups[1]":       `unknown tag group "garage"`,
+		"prometheus.filter.fields[2]":       `unknown field "battery"`,
+		"tag_groups.air[1]":                 `invalid MAC address "AA:BB:CC:DD:EE:0"`,
+	}
+	for path, message := range want {
+		if paths[path] != message {
+			t.Errorf("%s: got %q, want %q", path, paths[path], message)
+		}
+	}
+	if len(paths) != len(want) {
+		t.Errorf("got %v", paths)
+	}
+}
+
+func TestValidate_Smoothing(t *testing.T) {
+	c := Config{Processing: &Processing{Smoothing: &Smoothing{Fields: map[string][]SmoothingFilter{
+		"rssi":                  {{Type: "median", Window: 5}, {Type: "ewma", Alpha: 0.3}},
+		"pm2p5":                 {{Type: "kalman"}, {Window: -1}},
+		"co2":                   {{Type: "ewma", Alpha: 1.5}},
+		"noise":                 {{Type: "moving_average"}},
+		"calibrationInProgress": {{Type: "moving_average"}},
+		"dewPoint":              {{Type: "ewma"}},
+	}}}}
+	paths := errorPaths(t, Validate(c))
+	want := map[string]string{
+		"processing.smoothing.fields.pm2p5[0].type":         `"kalman" is not one of moving_average, ewma, median`,
+		"processing.smoothing.fields.pm2p5[1].type":         "required",
+		"processing.smoothing.fields.pm2p5[1].window":       "must not be negative",
+		"processing.smoothing.fields.co2[0].alpha":          "must be between 0 and 1",
+		"processing.smoothing.fields.noise":                 `unknown field "noise"`,
+		"processing.smoothing.fields.calibrationInProgress": `"calibrationInProgress" is not numeric`,
+		"processing.smoothing.fields.dewPoint":              `"dewPoint" is calculated from the smoothed values, smooth the fields it is calculated from`,
+	}
+	for path, message := range want {
+		if paths[path] != message {
+			t.Errorf("%s: got %q, want %q", path, paths[path], message)
+		}
+	}
+	if len(paths) != len(want) {
+		t.Errorf("got %v", paths)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `gw_mac: 00:00:00:00:00:00
+http_listener:
+  port: abc
+  prot: 8080
+mqtt_publisher:
+  broker_url: tcp://localhost:1883
+  password: ${MQTT_PASSWORD}
+  topic_prefix: ruuvi
+  topic_qos:
+    ruuvi/+/temperature: 5
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths := errorPaths(t, ValidateFile(path))
+	want := map[string]string{
+		"http_listener.prot":                           "unknown field (line 4)",
+		"http_listener.port":                           "cannot unmarshal !!str `abc` into int (line 3)",
+		"mqtt_publisher.topic_qos.ruuvi/+/temperature": "QoS 5 is not 0, 1 or 2",
+	}
+	for path, message := range want {
+		if paths[path] != message {
+			t.Errorf("%s: got %q, want %q", path, paths[path], message)
+		}
+	}
+	if len(paths) != len(want) {
+		t.Errorf("got %v", paths)
+	}
+
+	if err := ValidateFile("../config.sample.yml"); err != nil {
+		t.Errorf("config.sample.yml: %v", err)
+	}
+}
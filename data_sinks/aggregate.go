@@ -0,0 +1,147 @@
+package data_sinks
+
+import (
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/metrics"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+// Counters are not averaged, the last value of the window is published
+var aggregateCounters = map[string]bool{
+	"movementCounter":           true,
+	"measurementSequenceNumber": true,
+}
+
+// aggregateStatistic is one of the statistics written next to the mean of an aggregated field,
+// named <field>_<suffix> by the sinks with a column or a series per value
+type aggregateStatistic struct {
+	suffix string
+	kind   parser.FieldKind
+	value  func(a parser.Aggregate) float64
+}
+
+var aggregateStatistics = []aggregateStatistic{
+	{"min", parser.FloatField, func(a parser.Aggregate) float64 { return a.Min }},
+	{"max", parser.FloatField, func(a parser.Aggregate) float64 { return a.Max }},
+	{"count", parser.IntField, func(a parser.Aggregate) float64 { return float64(a.Count) }},
+}
+
+// typedValue returns the statistic as float64, or int64 for the count
+func (s aggregateStatistic) typedValue(a parser.Aggregate) interface{} {
+	if s.kind == parser.IntField {
+		return int64(s.value(a))
+	}
+	return s.value(a)
+}
+
+// aggregatedField returns whether the field has statistics when aggregated, the counters and the
+// flags only keep their last value
+func aggregatedField(f parser.Field) bool {
+	return f.Kind != parser.BoolField && !aggregateCounters[f.Name]
+}
+
+type fieldWindow struct {
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+}
+
+// tagWindow collects the measurements of one tag, fields are indexed like parser.Fields
+type tagWindow struct {
+	last   parser.Measurement
+	fields []fieldWindow
+}
+
+func (w *tagWindow) add(m parser.Measurement) {
+	w.last = m
+	for i, f := range parser.Fields {
+		v, ok := f.Float(m)
+		if !ok {
+			continue
+		}
+		fw := &w.fields[i]
+		if fw.count == 0 || v < fw.min {
+			fw.min = v
+		}
+		if fw.count == 0 || v > fw.max {
+			fw.max = v
+		}
+		fw.count++
+		fw.sum += v
+		fw.last = v
+	}
+}
+
+// measurement returns the last measurement of the window with the means of the numeric fields,
+// the last values of the counters and the flags, and the statistics in Aggregates
+func (w *tagWindow) measurement() parser.Measurement {
+	m := w.last
+	// The raw values of the last measurement do not match the means
+	m.Raw = nil
+	m.Aggregates = make(map[string]parser.Aggregate)
+	for i, f := range parser.Fields {
+		fw := w.fields[i]
+		if fw.count == 0 {
+			f.Clear(&m)
+			continue
+		}
+		if !aggregatedField(f) {
+			f.SetFloat(&m, fw.last)
+			continue
+		}
+		mean := fw.sum / float64(fw.count)
+		f.SetFloat(&m, mean)
+		m.Aggregates[f.Name] = parser.Aggregate{Min: fw.min, Max: fw.max, Mean: mean, Count: fw.count}
+	}
+	return m
+}
+
+// Aggregate returns a channel which collects the measurements of each tag over the window and sends
+// one aggregated measurement per tag to the sink at the end of the window. Closing the returned
+// channel sends the open windows and closes the sink. Like the gateway, the measurements are
+// dropped and counted in the sink drops when the sink queue is full.
+func Aggregate(name string, window time.Duration, sink chan<- parser.Measurement) chan<- parser.Measurement {
+	log.WithFields(log.Fields{
+		"sink":   name,
+		"window": window,
+	}).Info("Aggregating sink measurements")
+	measurements := make(chan parser.Measurement, cap(sink))
+	go func() {
+		windows := make(map[string]*tagWindow)
+		flush := func() {
+			for mac, w := range windows {
+				select {
+				case sink <- w.measurement():
+				default:
+					metrics.SinkDrops.WithLabelValues(name).Inc()
+				}
+				delete(windows, mac)
+			}
+		}
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case m, ok := <-measurements:
+				if !ok {
+					flush()
+					close(sink)
+					return
+				}
+				w, found := windows[m.Mac]
+				if !found {
+					w = &tagWindow{fields: make([]fieldWindow, len(parser.Fields))}
+					windows[m.Mac] = w
+				}
+				w.add(m)
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return measurements
+}
@@ -0,0 +1,137 @@
+package data_sinks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/metrics"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAggregate(t *testing.T) {
+	sink := make(chan parser.Measurement, 10)
+	// The window does not end during the test, closing the input sends the open windows
+	in := Aggregate("test", time.Hour, sink)
+	for i, temperature := range []float64{20, 21, 25} {
+		m := testMeasurement()
+		m.Temperature = &temperature
+		counter := int64(10 + i)
+		m.MovementCounter = &counter
+		if i == 2 {
+			m.Humidity = nil
+		}
+		in <- m
+	}
+	other := testMeasurement()
+	other.Mac = "AA:BB:CC:DD:EE:01"
+	in <- other
+	close(in)
+
+	got := make(map[string]parser.Measurement)
+	for m := range sink {
+		got[m.Mac] = m
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d measurements", len(got))
+	}
+	m := got["AA:BB:CC:DD:EE:FF"]
+	if *m.Temperature != 22 || *m.MovementCounter != 12 || *m.Humidity != 45.25 {
+		t.Errorf("values: %v %v %v", *m.Temperature, *m.MovementCounter, *m.Humidity)
+	}
+	if a := m.Aggregates["temperature"]; a != (parser.Aggregate{Min: 20, Max: 25, Mean: 22, Count: 3}) {
+		t.Errorf("temperature: %+v", a)
+	}
+	if a := m.Aggregates["humidity"]; a.Count != 2 {
+		t.Errorf("humidity: %+v", a)
+	}
+	if _, ok := m.Aggregates["movementCounter"]; ok {
+		t.Error("counter was aggregated")
+	}
+	if m.Name == nil || *m.Name != "Living Room" {
+		t.Error("name of the last measurement was not kept")
+	}
+
+	fields := influxFields(m)
+	if fields["temperature"] != 22.0 || fields["temperature_min"] != 20.0 || fields["temperature_max"] != 25.0 || fields["temperature_count"] != int64(3) {
+		t.Errorf("influx fields: %v", fields)
+	}
+
+	// The sinks with a column or a series per value write the statistics next to the mean
+	series := make(map[string]float64)
+	for _, s := range newRemoteWriter(config.PrometheusRemoteWrite{}).series(m, time.Now()) {
+		series[labelValue(s, "__name__")] = s.Value
+	}
+	if series["ruuvi_temperature"] != 22 || series["ruuvi_temperature_min"] != 20 || series["ruuvi_temperature_count"] != 3 {
+		t.Errorf("remote write series: %v", series)
+	}
+	if _, ok := series["ruuvi_movement_counter_max"]; ok {
+		t.Error("remote write series of a counter statistic")
+	}
+
+	wide := &postgresSink{columns: postgresColumns(true, nil)}
+	row := wide.rows([]timedMeasurement{{measurement: m}})[0]
+	for i, column := range wide.copyColumns() {
+		if want, ok := map[string]interface{}{"temperature_max": 25.0, "temperature_count": int64(3), "pressure_min": nil}[column]; ok && row[i] != want {
+			t.Errorf("postgres %s: got %v want %v", column, row[i], want)
+		}
+	}
+
+	messages, err := newMQTTTemplates(config.MQTTPublisher{}).FieldMessages(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := make(map[string]string)
+	for _, msg := range messages {
+		payloads[msg.Topic] = string(msg.Payload)
+	}
+	if payloads["/AA:BB:CC:DD:EE:FF/temperature_min"] != "20" || payloads["/AA:BB:CC:DD:EE:FF/temperature_count"] != "3" {
+		t.Errorf("mqtt field messages: %v", payloads)
+	}
+
+	values := newTagValues(0)
+	values.record(m)
+	if a := values.snapshot()[0].Aggregates; len(a) != 3 {
+		t.Errorf("otlp aggregates of temperature, humidity and rssi: %v", a)
+	}
+}
+
+func TestAggregate_Window(t *testing.T) {
+	sink := make(chan parser.Measurement, 10)
+	in := Aggregate("test", 20*time.Millisecond, sink)
+	in <- testMeasurement()
+	select {
+	case m := <-sink:
+		if m.Aggregates["temperature"].Count != 1 {
+			t.Errorf("aggregates: %+v", m.Aggregates)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("window was not sent")
+	}
+	close(in)
+}
+
+func TestAggregate_FullSink(t *testing.T) {
+	// A stalled sink does not block the aggregator, the window is dropped and counted
+	sink := make(chan parser.Measurement, 1)
+	sink <- testMeasurement()
+	drops := metrics.SinkDrops.WithLabelValues("test_full")
+	before := testutil.ToFloat64(drops)
+	in := Aggregate("test_full", time.Hour, sink)
+	in <- testMeasurement()
+	close(in)
+	for deadline := time.Now().Add(time.Second); testutil.ToFloat64(drops) == before; {
+		if time.Now().After(deadline) {
+			t.Fatal("the window was not dropped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	count := 0
+	for range sink {
+		count++
+	}
+	if count != 1 || testutil.ToFloat64(drops)-before != 1 {
+		t.Errorf("got %d measurements and %v drops, want the queued one and 1", count, testutil.ToFloat64(drops)-before)
+	}
+}
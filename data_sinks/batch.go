@@ -0,0 +1,87 @@
+package data_sinks
+
+import (
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+// timedMeasurement is a measurement with its receive time, for sinks which write in batches
+type timedMeasurement struct {
+	measurement parser.Measurement
+	time        time.Time
+}
+
+// limiterOptions returns the publishing limits of a sink
+func limiterOptions(o config.SinkOptions) limiter.Options {
+	return limiter.Options{
+		MinInterval: time.Duration(o.MinimumInterval),
+		Heartbeat:   time.Duration(o.Heartbeat),
+		Deadbands:   o.Deadbands,
+	}
+}
+
+type batchOptions struct {
+	// Sink name for logging
+	name          string
+	batchSize     int
+	flushInterval time.Duration
+	limit         limiter.Options
+	write         func(records []timedMeasurement) error
+	// Called after the measurement channel is closed and the last batch is written
+	close func()
+}
+
+// runBatches collects measurements and writes them when the batch is full or on the flush interval.
+// Records of failed writes are kept, up to 10 batches, and retried on the flush interval.
+func runBatches(measurements <-chan parser.Measurement, opts batchOptions) {
+	maxPending := opts.batchSize * 10
+	limiter := limiter.NewWithOptions(opts.limit)
+	var pending []timedMeasurement
+	failing := false
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := opts.write(pending); err != nil {
+			log.WithError(err).WithField("pending", len(pending)).Errorf("Failed to write measurements to %s", opts.name)
+			failing = true
+			if len(pending) > maxPending {
+				log.WithField("dropped", len(pending)-maxPending).Warnf("Dropping oldest %s measurements", opts.name)
+				pending = pending[len(pending)-maxPending:]
+			}
+			return
+		}
+		log.WithField("count", len(pending)).Tracef("Wrote measurements to %s", opts.name)
+		pending = nil
+		failing = false
+	}
+
+	ticker := time.NewTicker(opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case measurement, ok := <-measurements:
+			if !ok {
+				flush()
+				if opts.close != nil {
+					opts.close()
+				}
+				return
+			}
+			if !limiter.Check(measurement) {
+				log.WithField("mac", measurement.Mac).Tracef("Skipping %s write due to interval limit", opts.name)
+				continue
+			}
+			pending = append(pending, timedMeasurement{measurement: measurement, time: time.Now()})
+			if len(pending) >= opts.batchSize && !failing {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
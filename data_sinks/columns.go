@@ -0,0 +1,120 @@
+package data_sinks
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+// fieldColumn is a measurement field, a statistic of an aggregated field or the unfiltered value
+// of a smoothed field, for the sinks which write a column or a series per value
+type fieldColumn struct {
+	field parser.Field
+	// Set for the statistics of aggregated fields
+	statistic *aggregateStatistic
+	// Set for the unfiltered values of smoothed fields
+	raw bool
+}
+
+// fieldColumns returns a column for every measurement field. With aggregated, the numeric fields
+// are followed by the columns of their statistics, otherwise the raw fields by their unfiltered
+// values. Aggregated measurements do not have the raw values.
+func fieldColumns(aggregated bool, raw []string) []fieldColumn {
+	var columns []fieldColumn
+	for _, f := range parser.Fields {
+		columns = append(columns, fieldColumn{field: f})
+		if aggregated && aggregatedField(f) {
+			for i := range aggregateStatistics {
+				columns = append(columns, fieldColumn{field: f, statistic: &aggregateStatistics[i]})
+			}
+		}
+		if !aggregated && slices.Contains(raw, f.Name) {
+			columns = append(columns, fieldColumn{field: f, raw: true})
+		}
+	}
+	return columns
+}
+
+// rawFields returns the fields of the measurement which have an unfiltered value
+func rawFields(m parser.Measurement) []string {
+	fields := make([]string, 0, len(m.Raw))
+	for name := range m.Raw {
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// suffix returns the suffix added to the name of the field, eg. "_min"
+func (c fieldColumn) suffix() string {
+	switch {
+	case c.statistic != nil:
+		return "_" + c.statistic.suffix
+	case c.raw:
+		return "_raw"
+	}
+	return ""
+}
+
+// fieldName returns the name of the value like the InfluxDB fields, eg. temperature_min
+func (c fieldColumn) fieldName() string {
+	return c.field.Name + c.suffix()
+}
+
+func (c fieldColumn) kind() parser.FieldKind {
+	switch {
+	case c.statistic != nil:
+		return c.statistic.kind
+	case c.raw:
+		// The unfiltered values of integer fields are kept as float64 too
+		return parser.FloatField
+	}
+	return c.field.Kind
+}
+
+// value returns the value as float64, int64 or bool
+func (c fieldColumn) value(m parser.Measurement) (interface{}, bool) {
+	switch {
+	case c.statistic != nil:
+		a, ok := m.Aggregates[c.field.Name]
+		if !ok {
+			return nil, false
+		}
+		return c.statistic.typedValue(a), true
+	case c.raw:
+		v, ok := m.Raw[c.field.Name]
+		if !ok {
+			return nil, false
+		}
+		return v, true
+	}
+	return c.field.Value(m)
+}
+
+// float returns the value as a float64, booleans being 1 or 0
+func (c fieldColumn) float(m parser.Measurement) (float64, bool) {
+	switch {
+	case c.statistic != nil:
+		a, ok := m.Aggregates[c.field.Name]
+		if !ok {
+			return 0, false
+		}
+		return c.statistic.value(a), true
+	case c.raw:
+		v, ok := m.Raw[c.field.Name]
+		return v, ok
+	}
+	return c.field.Float(m)
+}
+
+// format returns the value formatted as a plain string
+func (c fieldColumn) format(m parser.Measurement) (string, bool) {
+	if c.statistic == nil && !c.raw {
+		return c.field.Format(m)
+	}
+	v, ok := c.float(m)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), true
+}
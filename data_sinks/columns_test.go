@@ -0,0 +1,60 @@
+package data_sinks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+func TestRawValues(t *testing.T) {
+	m := testMeasurement()
+	m.Raw = map[string]float64{"temperature": 21.9, "rssi": -74}
+
+	series := make(map[string]float64)
+	for _, s := range newRemoteWriter(config.PrometheusRemoteWrite{}).series(m, time.Now()) {
+		series[labelValue(s, "__name__")] = s.Value
+	}
+	if series["ruuvi_temperature"] != 21.5 || series["ruuvi_temperature_raw"] != 21.9 || series["ruuvi_rssi_raw"] != -74 {
+		t.Errorf("remote write series: %v", series)
+	}
+	if _, ok := series["ruuvi_humidity_raw"]; ok {
+		t.Error("remote write series of an unsmoothed field")
+	}
+
+	wide := &postgresSink{columns: postgresColumns(false, []string{"temperature", "rssi"})}
+	row := wide.rows([]timedMeasurement{{measurement: m}})[0]
+	for i, column := range wide.copyColumns() {
+		if want, ok := map[string]interface{}{"temperature_raw": 21.9, "rssi_raw": -74.0, "rssi": int64(-70)}[column]; ok && row[i] != want {
+			t.Errorf("postgres %s: got %v want %v", column, row[i], want)
+		}
+	}
+	// Aggregated measurements have no raw values
+	for _, c := range postgresColumns(true, []string{"temperature"}) {
+		if c.name == "temperature_raw" {
+			t.Error("raw column of an aggregated sink")
+		}
+	}
+
+	messages, err := newMQTTTemplates(config.MQTTPublisher{}).FieldMessages(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := make(map[string]string)
+	for _, msg := range messages {
+		payloads[msg.Topic] = string(msg.Payload)
+	}
+	if payloads["/AA:BB:CC:DD:EE:FF/temperature_raw"] != "21.9" || payloads["/AA:BB:CC:DD:EE:FF/rssi_raw"] != "-74" {
+		t.Errorf("mqtt field messages: %v", payloads)
+	}
+
+	values := newTagValues(0)
+	values.record(m)
+	if raw := values.snapshot()[0].Raw; len(raw) != 2 {
+		t.Errorf("prometheus and otlp raw values of temperature and rssi: %v", raw)
+	}
+	values.record(testMeasurement())
+	if raw := values.snapshot()[0].Raw; raw != nil {
+		t.Errorf("raw values were kept from the previous measurement: %v", raw)
+	}
+}
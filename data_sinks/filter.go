@@ -0,0 +1,94 @@
+package data_sinks
+
+import (
+	"strings"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+// Filter applies a config.SinkFilter to the measurements before they are sent to a sink, so the
+// sinks themselves do not need to know about the filters
+type Filter struct {
+	tags        map[string]bool
+	excludeTags map[string]bool
+	// Fields removed from the measurements
+	clear []parser.Field
+}
+
+// NewFilter resolves the groups of the filter, a nil filter passes everything
+func NewFilter(conf *config.SinkFilter, groups map[string][]string) *Filter {
+	if conf == nil {
+		return nil
+	}
+	f := &Filter{}
+	addTags := func(set map[string]bool, macs []string) map[string]bool {
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		for _, mac := range macs {
+			set[strings.ToUpper(strings.TrimSpace(mac))] = true
+		}
+		return set
+	}
+	if len(conf.Tags) > 0 {
+		f.tags = addTags(f.tags, conf.Tags)
+	}
+	for _, group := range conf.Groups {
+		macs, ok := groups[group]
+		if !ok {
+			log.WithField("group", group).Warn("Sink filter references an unknown tag group")
+		}
+		// An empty group still restricts the filter, it does not select every tag
+		f.tags = addTags(f.tags, macs)
+	}
+	if len(conf.ExcludeTags) > 0 {
+		f.excludeTags = addTags(f.excludeTags, conf.ExcludeTags)
+	}
+	for _, group := range conf.ExcludeGroups {
+		f.excludeTags = addTags(f.excludeTags, groups[group])
+	}
+
+	include := make(map[string]bool)
+	for _, name := range conf.Fields {
+		include[name] = true
+	}
+	exclude := make(map[string]bool)
+	for _, name := range conf.ExcludeFields {
+		exclude[name] = true
+	}
+	for _, field := range parser.Fields {
+		if (len(include) > 0 && !include[field.Name]) || exclude[field.Name] {
+			f.clear = append(f.clear, field)
+		}
+	}
+	return f
+}
+
+// Apply returns the measurement with the selected fields, or false when the tag is not sent to the sink
+func (f *Filter) Apply(m parser.Measurement) (parser.Measurement, bool) {
+	if f == nil {
+		return m, true
+	}
+	mac := strings.ToUpper(m.Mac)
+	if (f.tags != nil && !f.tags[mac]) || f.excludeTags[mac] {
+		return m, false
+	}
+	// The measurement is a copy, clearing the fields does not affect the other sinks
+	for _, field := range f.clear {
+		field.Clear(&m)
+	}
+	if len(f.clear) > 0 && len(m.Raw) > 0 {
+		// The raw values map is shared with the other sinks, so it is copied
+		raw := make(map[string]float64, len(m.Raw))
+		for name, v := range m.Raw {
+			raw[name] = v
+		}
+		for _, field := range f.clear {
+			delete(raw, field.Name)
+		}
+		m.Raw = raw
+	}
+	return m, true
+}
@@ -0,0 +1,70 @@
+package data_sinks
+
+import (
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+func TestFilter_Tags(t *testing.T) {
+	groups := map[string][]string{
+		"air":     {"aa:bb:cc:dd:ee:ff"},
+		"outdoor": {"AA:BB:CC:DD:EE:01"},
+	}
+	m := testMeasurement()
+
+	var f *Filter
+	if _, ok := f.Apply(m); !ok {
+		t.Error("nil filter dropped the measurement")
+	}
+	if f := NewFilter(nil, groups); f != nil {
+		t.Error("expected a nil filter without config")
+	}
+
+	tests := []struct {
+		name string
+		conf config.SinkFilter
+		want bool
+	}{
+		{"empty", config.SinkFilter{}, true},
+		{"tags", config.SinkFilter{Tags: []string{"aa:bb:cc:dd:ee:ff"}}, true},
+		{"other tags", config.SinkFilter{Tags: []string{"AA:BB:CC:DD:EE:01"}}, false},
+		{"group", config.SinkFilter{Groups: []string{"air"}}, true},
+		{"other group", config.SinkFilter{Groups: []string{"outdoor"}}, false},
+		{"unknown group", config.SinkFilter{Groups: []string{"garage"}}, false},
+		{"excluded", config.SinkFilter{ExcludeTags: []string{"AA:BB:CC:DD:EE:FF"}}, false},
+		{"excluded group", config.SinkFilter{Groups: []string{"air"}, ExcludeGroups: []string{"air"}}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := NewFilter(&tt.conf, groups).Apply(m); ok != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestFilter_Fields(t *testing.T) {
+	m := testMeasurement()
+	filtered, ok := NewFilter(&config.SinkFilter{Fields: []string{"temperature", "rssi"}, ExcludeFields: []string{"rssi"}}, nil).Apply(m)
+	if !ok {
+		t.Fatal("measurement was dropped")
+	}
+	if filtered.Temperature == nil || filtered.Humidity != nil || filtered.Rssi != nil {
+		t.Errorf("fields: %+v", filtered.BasicEnvironmentalData)
+	}
+	if filtered.Mac != m.Mac || filtered.Name == nil || filtered.DataFormat != 5 {
+		t.Errorf("common data was removed: %+v", filtered.CommonData)
+	}
+	// The other sinks get the original measurement
+	if m.Humidity == nil || m.Rssi == nil {
+		t.Error("the original measurement was modified")
+	}
+
+	m.Raw = map[string]float64{"temperature": 21.4, "rssi": -75}
+	filtered, _ = NewFilter(&config.SinkFilter{ExcludeFields: []string{"rssi"}}, nil).Apply(m)
+	if _, ok := filtered.Raw["rssi"]; ok || filtered.Raw["temperature"] != 21.4 {
+		t.Errorf("raw values: %v", filtered.Raw)
+	}
+	if _, ok := m.Raw["rssi"]; !ok {
+		t.Error("the original raw values were modified")
+	}
+}
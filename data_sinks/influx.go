@@ -0,0 +1,44 @@
+package data_sinks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+// influxTags returns the tags written by every InfluxDB sink
+func influxTags(m parser.Measurement, additionalTags map[string]string) map[string]string {
+	tags := map[string]string{
+		"dataFormat": fmt.Sprintf("%X", m.DataFormat),
+		"mac":        strings.ReplaceAll(m.Mac, ":", ""),
+	}
+	if m.Name != nil {
+		tags["name"] = *m.Name
+	}
+	for tag, value := range additionalTags {
+		tags[tag] = value
+	}
+	return tags
+}
+
+// influxFields returns the fields written by every InfluxDB sink, named like the measurement JSON.
+// Aggregated measurements add <field>_min, <field>_max and <field>_count next to the mean, and
+// smoothed measurements <field>_raw when the raw values are published.
+func influxFields(m parser.Measurement) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, f := range parser.Fields {
+		if v, ok := f.Value(m); ok {
+			fields[f.Name] = v
+		}
+	}
+	for name, a := range m.Aggregates {
+		fields[name+"_min"] = a.Min
+		fields[name+"_max"] = a.Max
+		fields[name+"_count"] = a.Count
+	}
+	for name, v := range m.Raw {
+		fields[name+"_raw"] = v
+	}
+	return fields
+}
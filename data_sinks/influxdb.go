@@ -2,15 +2,12 @@
 
 import (
 	"context"
-	"fmt"
-	"strings"
 	"time"
 
 	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
 	"github.com/Saavuori/ruuvi-go-gateway/config"
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
 	influxdb "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -37,7 +34,7 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 	client := influxdb.NewClient(url, conf.AuthToken)
 	writeAPI := client.WriteAPIBlocking(conf.Org, bucket)
 
-	limiter := limiter.New(time.Duration(conf.MinimumInterval))
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
 	measurements := make(chan parser.Measurement, 1024)
 	go func() {
 		for measurement := range measurements {
@@ -46,52 +43,7 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 				continue
 			}
 			go func(measurement parser.Measurement) {
-				p := influxdb.NewPointWithMeasurement(measurementName).
-					AddTag("dataFormat", fmt.Sprintf("%X", measurement.DataFormat)).
-					AddTag("mac", strings.ReplaceAll(measurement.Mac, ":", ""))
-				if measurement.Name != nil {
-					p.AddTag("name", *measurement.Name)
-				}
-				for tag, value := range conf.AdditionalTags {
-					p.AddTag(tag, value)
-				}
-				addFloat(p, "temperature", measurement.Temperature)
-				addFloat(p, "humidity", measurement.Humidity)
-				addFloat(p, "pressure", measurement.Pressure)
-				addFloat(p, "accelerationX", measurement.AccelerationX)
-				addFloat(p, "accelerationY", measurement.AccelerationY)
-				addFloat(p, "accelerationZ", measurement.AccelerationZ)
-				addFloat(p, "batteryVoltage", measurement.BatteryVoltage)
-				addInt(p, "txPower", measurement.TxPower)
-				addInt(p, "rssi", measurement.Rssi)
-				addInt(p, "movementCounter", measurement.MovementCounter)
-				addInt(p, "measurementSequenceNumber", measurement.MeasurementSequenceNumber)
-				addFloat(p, "accelerationTotal", measurement.AccelerationTotal)
-				addFloat(p, "absoluteHumidity", measurement.AbsoluteHumidity)
-				addFloat(p, "dewPoint", measurement.DewPoint)
-				addFloat(p, "equilibriumVaporPressure", measurement.EquilibriumVaporPressure)
-				addFloat(p, "airDensity", measurement.AirDensity)
-				addFloat(p, "accelerationAngleFromX", measurement.AccelerationAngleFromX)
-				addFloat(p, "accelerationAngleFromY", measurement.AccelerationAngleFromY)
-				addFloat(p, "accelerationAngleFromZ", measurement.AccelerationAngleFromZ)
-				// New E1 fields
-				addFloat(p, "pm1p0", measurement.Pm1p0)
-				addFloat(p, "pm2p5", measurement.Pm2p5)
-				addFloat(p, "pm4p0", measurement.Pm4p0)
-				addFloat(p, "pm10p0", measurement.Pm10p0)
-				addFloat(p, "co2", measurement.CO2)
-				addFloat(p, "voc", measurement.VOC)
-				addFloat(p, "nox", measurement.NOX)
-				addFloat(p, "illuminance", measurement.Illuminance)
-				addFloat(p, "soundInstant", measurement.SoundInstant)
-				addFloat(p, "soundAverage", measurement.SoundAverage)
-				addFloat(p, "soundPeak", measurement.SoundPeak)
-				addFloat(p, "airQualityIndex", measurement.AirQualityIndex)
-				// Diagnostics
-				addBool(p, "calibrationInProgress", measurement.CalibrationInProgress)
-				addBool(p, "buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
-				addBool(p, "rtcOnBoot", measurement.RtcOnBoot)
-				p.SetTime(time.Now())
+				p := influxdb.NewPoint(measurementName, influxTags(measurement, conf.AdditionalTags), influxFields(measurement), time.Now())
 				err := writeAPI.WritePoint(context.Background(), p)
 				if err != nil {
 					log.WithError(err).Error("Failed to send data to InfluxDB")
@@ -102,21 +54,3 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 	}()
 	return measurements
 }
-
-func addFloat(p *write.Point, name string, value *float64) {
-	if value != nil {
-		p.AddField(name, *value)
-	}
-}
-
-func addInt(p *write.Point, name string, value *int64) {
-	if value != nil {
-		p.AddField(name, *value)
-	}
-}
-
-func addBool(p *write.Point, name string, value *bool) {
-	if value != nil {
-		p.AddField(name, *value)
-	}
-}
@@ -0,0 +1,221 @@
+package data_sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// encodeLineProtocol encodes a measurement as one line of InfluxDB line protocol with nanosecond precision
+func encodeLineProtocol(measurementName string, m parser.Measurement, additionalTags map[string]string, timestamp time.Time) ([]byte, error) {
+	var enc lineprotocol.Encoder
+	enc.SetPrecision(lineprotocol.Nanosecond)
+	enc.StartLine(measurementName)
+
+	tags := influxTags(m, additionalTags)
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		// Line protocol does not allow empty tag values
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	// Tags must be added in lexical order
+	sort.Strings(keys)
+	for _, key := range keys {
+		enc.AddTag(key, tags[key])
+	}
+
+	fields := influxFields(m)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("measurement of %s has no fields", m.Mac)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := lineprotocol.NewValue(fields[name])
+		if !ok {
+			return nil, fmt.Errorf("invalid value for field %s: %v", name, fields[name])
+		}
+		enc.AddField(name, value)
+	}
+	enc.EndLine(timestamp)
+	if err := enc.Err(); err != nil {
+		return nil, err
+	}
+	return enc.Bytes(), nil
+}
+
+type lineProtocolWriter interface {
+	Write(lines []byte) error
+	Close() error
+}
+
+// influxHTTPWriter writes to the InfluxDB 1.x /write endpoint
+type influxHTTPWriter struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+}
+
+func newInfluxHTTPWriter(conf config.InfluxDB1Publisher, timeout time.Duration) (*influxHTTPWriter, error) {
+	base := conf.Url
+	if base == "" {
+		base = "http://localhost:8086"
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "/") + "/write")
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB url: %w", err)
+	}
+	query := url.Values{}
+	query.Set("db", conf.Database)
+	if conf.RetentionPolicy != "" {
+		query.Set("rp", conf.RetentionPolicy)
+	}
+	query.Set("precision", "ns")
+	u.RawQuery = query.Encode()
+	return &influxHTTPWriter{
+		client:   &http.Client{Timeout: timeout},
+		url:      u.String(),
+		username: conf.Username,
+		password: conf.Password,
+	}, nil
+}
+
+func (w *influxHTTPWriter) Write(lines []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (w *influxHTTPWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// influxSocketWriter writes raw line protocol to a UDP or TCP listener, reconnecting after errors
+type influxSocketWriter struct {
+	network string
+	address string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func (w *influxSocketWriter) Write(lines []byte) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.address, w.timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	if _, err := w.conn.Write(lines); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *influxSocketWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+func newLineProtocolWriter(conf config.InfluxDB1Publisher) (lineProtocolWriter, error) {
+	timeout := time.Duration(conf.Timeout)
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	switch strings.ToLower(conf.Protocol) {
+	case "", "http":
+		return newInfluxHTTPWriter(conf, timeout)
+	case "udp", "tcp":
+		address := conf.Url
+		if address == "" {
+			address = "localhost:8094"
+		}
+		return &influxSocketWriter{network: strings.ToLower(conf.Protocol), address: address, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("invalid protocol %q, expected http, udp or tcp", conf.Protocol)
+	}
+}
+
+func InfluxDB1(conf config.InfluxDB1Publisher) chan<- parser.Measurement {
+	measurementName := conf.Measurement
+	if measurementName == "" {
+		measurementName = "ruuvi_measurements"
+	}
+	log.WithFields(log.Fields{
+		"target":           conf.Url,
+		"protocol":         conf.Protocol,
+		"database":         conf.Database,
+		"measurement_name": measurementName,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting InfluxDB v1 sink")
+
+	writer, err := newLineProtocolWriter(conf)
+	if err != nil {
+		log.WithError(err).Error("Failed to create InfluxDB v1 writer")
+	}
+
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
+	measurements := make(chan parser.Measurement, 1024)
+	go func() {
+		for measurement := range measurements {
+			if writer == nil {
+				continue
+			}
+			if !limiter.Check(measurement) {
+				log.WithField("mac", measurement.Mac).Trace("Skipping InfluxDB v1 publish due to interval limit")
+				continue
+			}
+			line, err := encodeLineProtocol(measurementName, measurement, conf.AdditionalTags, time.Now())
+			if err != nil {
+				log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to encode line protocol")
+				continue
+			}
+			if err := writer.Write(line); err != nil {
+				log.WithError(err).Error("Failed to send data to InfluxDB v1")
+			}
+		}
+		if writer != nil {
+			writer.Close()
+		}
+	}()
+	return measurements
+}
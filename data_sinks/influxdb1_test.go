@@ -0,0 +1,135 @@
+package data_sinks
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+const expectedLine = "ruuvi,dataFormat=5,location=home,mac=AABBCCDDEEFF,name=Living\\ Room humidity=45.25,rssi=-70i,temperature=21.5 1700000000000000000\n"
+
+func TestEncodeLineProtocol(t *testing.T) {
+	line, err := encodeLineProtocol("ruuvi", testMeasurement(), map[string]string{"location": "home"}, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("encodeLineProtocol: %v", err)
+	}
+	if string(line) != expectedLine {
+		t.Errorf("got %q\nwant %q", line, expectedLine)
+	}
+
+	m := testMeasurement()
+	empty := ""
+	m.Name = &empty
+	line, _ = encodeLineProtocol("ruuvi", m, nil, time.Unix(1700000000, 0))
+	if string(line) != "ruuvi,dataFormat=5,mac=AABBCCDDEEFF humidity=45.25,rssi=-70i,temperature=21.5 1700000000000000000\n" {
+		t.Errorf("empty name: got %q", line)
+	}
+}
+
+func TestInfluxHTTPWriter(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Query().Get("db") == "missing" {
+			http.Error(w, `{"error":"database not found"}`, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	writer, err := newLineProtocolWriter(config.InfluxDB1Publisher{
+		Url:             srv.URL,
+		Database:        "ruuvi",
+		RetentionPolicy: "autogen",
+		Username:        "user",
+		Password:        "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write([]byte(expectedLine)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	query := received.URL.Query()
+	if received.URL.Path != "/write" || query.Get("db") != "ruuvi" || query.Get("rp") != "autogen" || query.Get("precision") != "ns" {
+		t.Errorf("request: got %s", received.URL)
+	}
+	if user, pass, _ := received.BasicAuth(); user != "user" || pass != "pass" {
+		t.Errorf("basic auth: got %q %q", user, pass)
+	}
+	if string(body) != expectedLine {
+		t.Errorf("body: got %q", body)
+	}
+
+	writer, _ = newLineProtocolWriter(config.InfluxDB1Publisher{Url: srv.URL, Database: "missing"})
+	if err := writer.Write([]byte(expectedLine)); err == nil {
+		t.Errorf("expected an error for a missing database")
+	}
+}
+
+func TestInfluxSocketWriter_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writer, _ := newLineProtocolWriter(config.InfluxDB1Publisher{Protocol: "udp", Url: conn.LocalAddr().String()})
+	defer writer.Close()
+	if err := writer.Write([]byte(expectedLine)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != expectedLine {
+		t.Errorf("got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestInfluxSocketWriter_TCP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text() + "\n"
+		}
+	}()
+
+	writer, _ := newLineProtocolWriter(config.InfluxDB1Publisher{Protocol: "tcp", Url: lis.Addr().String()})
+	defer writer.Close()
+	for i := 0; i < 2; i++ {
+		if err := writer.Write([]byte(expectedLine)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case line := <-lines:
+			if line != expectedLine {
+				t.Errorf("got %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for line")
+		}
+	}
+}
@@ -2,8 +2,6 @@
 
 import (
 	"context"
-	"fmt"
-	"strings"
 	"time"
 
 	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
@@ -38,7 +36,7 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 		log.WithError(err).Error("Failed to create InfluxDB3 client")
 	}
 
-	limiter := limiter.New(time.Duration(conf.MinimumInterval))
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
 	measurements := make(chan parser.Measurement, 1024)
 	go func() {
 		for measurement := range measurements {
@@ -47,52 +45,7 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 				continue
 			}
 			go func(measurement parser.Measurement) {
-				p := influxdb3.NewPointWithMeasurement(measurementName).
-					SetTag("dataFormat", fmt.Sprintf("%X", measurement.DataFormat)).
-					SetTag("mac", strings.ReplaceAll(measurement.Mac, ":", ""))
-				if measurement.Name != nil {
-					p.SetTag("name", *measurement.Name)
-				}
-				for tag, value := range conf.AdditionalTags {
-					p.SetTag(tag, value)
-				}
-				influx3AddFloat(p, "temperature", measurement.Temperature)
-				influx3AddFloat(p, "humidity", measurement.Humidity)
-				influx3AddFloat(p, "pressure", measurement.Pressure)
-				influx3AddFloat(p, "accelerationX", measurement.AccelerationX)
-				influx3AddFloat(p, "accelerationY", measurement.AccelerationY)
-				influx3AddFloat(p, "accelerationZ", measurement.AccelerationZ)
-				influx3AddFloat(p, "batteryVoltage", measurement.BatteryVoltage)
-				influx3AddInt(p, "txPower", measurement.TxPower)
-				influx3AddInt(p, "rssi", measurement.Rssi)
-				influx3AddInt(p, "movementCounter", measurement.MovementCounter)
-				influx3AddInt(p, "measurementSequenceNumber", measurement.MeasurementSequenceNumber)
-				influx3AddFloat(p, "accelerationTotal", measurement.AccelerationTotal)
-				influx3AddFloat(p, "absoluteHumidity", measurement.AbsoluteHumidity)
-				influx3AddFloat(p, "dewPoint", measurement.DewPoint)
-				influx3AddFloat(p, "equilibriumVaporPressure", measurement.EquilibriumVaporPressure)
-				influx3AddFloat(p, "airDensity", measurement.AirDensity)
-				influx3AddFloat(p, "accelerationAngleFromX", measurement.AccelerationAngleFromX)
-				influx3AddFloat(p, "accelerationAngleFromY", measurement.AccelerationAngleFromY)
-				influx3AddFloat(p, "accelerationAngleFromZ", measurement.AccelerationAngleFromZ)
-				// New E1 fields
-				influx3AddFloat(p, "pm1p0", measurement.Pm1p0)
-				influx3AddFloat(p, "pm2p5", measurement.Pm2p5)
-				influx3AddFloat(p, "pm4p0", measurement.Pm4p0)
-				influx3AddFloat(p, "pm10p0", measurement.Pm10p0)
-				influx3AddFloat(p, "co2", measurement.CO2)
-				influx3AddFloat(p, "voc", measurement.VOC)
-				influx3AddFloat(p, "nox", measurement.NOX)
-				influx3AddFloat(p, "illuminance", measurement.Illuminance)
-				influx3AddFloat(p, "soundInstant", measurement.SoundInstant)
-				influx3AddFloat(p, "soundAverage", measurement.SoundAverage)
-				influx3AddFloat(p, "soundPeak", measurement.SoundPeak)
-				influx3AddFloat(p, "airQualityIndex", measurement.AirQualityIndex)
-				// Diagnostics
-				influx3AddBool(p, "calibrationInProgress", measurement.CalibrationInProgress)
-				influx3AddBool(p, "buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
-				influx3AddBool(p, "rtcOnBoot", measurement.RtcOnBoot)
-				p.SetTimestamp(time.Now())
+				p := influxdb3.NewPoint(measurementName, influxTags(measurement, conf.AdditionalTags), influxFields(measurement), time.Now())
 				err := client.WritePoints(context.Background(), []*influxdb3.Point{p})
 				if err != nil {
 					log.WithError(err).Error("Failed to send data to InfluxDB3")
@@ -103,21 +56,3 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 	}()
 	return measurements
 }
-
-func influx3AddFloat(p *influxdb3.Point, name string, value *float64) {
-	if value != nil {
-		p.SetField(name, *value)
-	}
-}
-
-func influx3AddInt(p *influxdb3.Point, name string, value *int64) {
-	if value != nil {
-		p.SetField(name, *value)
-	}
-}
-
-func influx3AddBool(p *influxdb3.Point, name string, value *bool) {
-	if value != nil {
-		p.SetField(name, *value)
-	}
-}
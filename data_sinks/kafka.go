@@ -0,0 +1,179 @@
+package data_sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const defaultKafkaTopicTemplate = "ruuvi"
+
+// sanitizeKafkaTopic replaces the characters which are not allowed in Kafka topic names
+func sanitizeKafkaTopic(topic string) string {
+	topic = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(topic))
+	if len(topic) > 249 {
+		topic = topic[:249]
+	}
+	return topic
+}
+
+func kafkaOptions(conf config.KafkaPublisher) ([]kgo.Opt, error) {
+	if len(conf.Brokers) == 0 {
+		return nil, errors.New("no brokers configured")
+	}
+	clientID := conf.ClientID
+	if clientID == "" {
+		clientID = "ruuvi-go-gateway"
+	}
+	timeout := time.Duration(conf.Timeout)
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(conf.Brokers...),
+		kgo.ClientID(clientID),
+		kgo.RecordDeliveryTimeout(timeout),
+		// Records are dropped instead of blocking the sink when the brokers are unreachable for long
+		kgo.MaxBufferedRecords(10000),
+	}
+
+	// Records are partitioned by the key, the MAC, so the measurements of a tag stay in order
+	switch strings.ToLower(conf.Acks) {
+	case "", "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("invalid acks %q, expected all, leader or none", conf.Acks)
+	}
+
+	switch strings.ToLower(conf.Compression) {
+	case "", "snappy":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case "none":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	case "gzip":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case "lz4":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case "zstd":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		return nil, fmt.Errorf("invalid compression %q", conf.Compression)
+	}
+
+	tlsConf, err := newTLSConfig(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConf))
+	}
+
+	if conf.SASL != nil {
+		switch strings.ToLower(conf.SASL.Mechanism) {
+		case "plain":
+			opts = append(opts, kgo.SASL(plain.Auth{User: conf.SASL.Username, Pass: conf.SASL.Password}.AsMechanism()))
+		case "scram-sha-256":
+			opts = append(opts, kgo.SASL(scram.Auth{User: conf.SASL.Username, Pass: conf.SASL.Password}.AsSha256Mechanism()))
+		case "scram-sha-512":
+			opts = append(opts, kgo.SASL(scram.Auth{User: conf.SASL.Username, Pass: conf.SASL.Password}.AsSha512Mechanism()))
+		default:
+			return nil, fmt.Errorf("invalid SASL mechanism %q, expected plain, scram-sha-256 or scram-sha-512", conf.SASL.Mechanism)
+		}
+	}
+	return opts, nil
+}
+
+// kafkaRecord returns the measurement as JSON keyed by the MAC
+func kafkaRecord(topic string, m parser.Measurement) (*kgo.Record, error) {
+	value, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &kgo.Record{
+		Topic: topic,
+		Key:   []byte(m.Mac),
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "content-type", Value: []byte("application/json")},
+		},
+	}, nil
+}
+
+func Kafka(conf config.KafkaPublisher) chan<- parser.Measurement {
+	log.WithFields(log.Fields{
+		"brokers":          conf.Brokers,
+		"topic_template":   conf.TopicTemplate,
+		"acks":             conf.Acks,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting Kafka sink")
+
+	var client *kgo.Client
+	opts, err := kafkaOptions(conf)
+	if err == nil {
+		// The client connects lazily and reconnects after failures
+		client, err = kgo.NewClient(opts...)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to create Kafka client")
+	}
+
+	topics := newSubjectTemplate("topic_template", conf.TopicTemplate, defaultKafkaTopicTemplate, sanitizeKafkaTopic)
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
+	measurements := make(chan parser.Measurement, 1024)
+	go func() {
+		ctx := context.Background()
+		for measurement := range measurements {
+			if client == nil {
+				continue
+			}
+			if !limiter.Check(measurement) {
+				log.WithField("mac", measurement.Mac).Trace("Skipping Kafka publish due to interval limit")
+				continue
+			}
+			topic, err := topics.render(measurement)
+			if err != nil {
+				log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to render Kafka topic")
+				continue
+			}
+			record, err := kafkaRecord(topic, measurement)
+			if err != nil {
+				log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to serialize measurement")
+				continue
+			}
+			client.TryProduce(ctx, record, func(r *kgo.Record, err error) {
+				if err != nil {
+					log.WithError(err).WithFields(log.Fields{"topic": r.Topic, "mac": string(r.Key)}).Error("Failed to publish to Kafka")
+				}
+			})
+		}
+		if client != nil {
+			flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			if err := client.Flush(flushCtx); err != nil {
+				log.WithError(err).Warn("Failed to flush Kafka records")
+			}
+			client.Close()
+		}
+	}()
+	return measurements
+}
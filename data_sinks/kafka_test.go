@@ -0,0 +1,70 @@
+package data_sinks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaOptions(t *testing.T) {
+	if _, err := kafkaOptions(config.KafkaPublisher{Brokers: []string{"localhost:9092"}}); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+	invalid := []config.KafkaPublisher{
+		{},
+		{Brokers: []string{"localhost:9092"}, Acks: "some"},
+		{Brokers: []string{"localhost:9092"}, Compression: "brotli"},
+		{Brokers: []string{"localhost:9092"}, SASL: &config.KafkaSASL{Mechanism: "gssapi"}},
+	}
+	for _, conf := range invalid {
+		if _, err := kafkaOptions(conf); err == nil {
+			t.Errorf("%+v: expected an error", conf)
+		}
+	}
+}
+
+func TestSanitizeKafkaTopic(t *testing.T) {
+	if got := sanitizeKafkaTopic(" ruuvi.Living Room/ä "); got != "ruuvi.Living_Room__" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "ruuvi.living-room"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	sink := Kafka(config.KafkaPublisher{Brokers: cluster.ListenAddrs(), TopicTemplate: "ruuvi.{{.Slug}}"})
+	sink <- testMeasurement()
+	close(sink)
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("ruuvi.living-room"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) == 0 && ctx.Err() == nil {
+		records = append(records, consumer.PollFetches(ctx).Records()...)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	if string(records[0].Key) != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("key: got %q", records[0].Key)
+	}
+	var m parser.Measurement
+	if err := json.Unmarshal(records[0].Value, &m); err != nil || m.Temperature == nil || *m.Temperature != 21.5 {
+		t.Errorf("value: got %s (%v)", records[0].Value, err)
+	}
+}
@@ -1,15 +1,16 @@
 ﻿package data_sinks
 
 import (
+	"bytes"
 	"encoding/json"
-	"strconv"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
 	"github.com/Saavuori/ruuvi-go-gateway/config"
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -33,61 +34,171 @@ func normalizeBrokerURL(url string) string {
 	return url
 }
 
-func MQTT(conf config.MQTTPublisher, tagNames map[string]string) chan<- parser.Measurement {
+// mqttPublisher wraps an mqttClient with the sink configuration, applying QoS,
+// MQTT 5 properties and publish result accounting to every message.
+type mqttPublisher struct {
+	client mqttClient
+	conf   config.MQTTPublisher
+	stats  *mqttPublishStats
+}
+
+func (p *mqttPublisher) publish(msg mqttMessage) {
+	p.publishWith(p.client, msg)
+}
+
+// publishWith publishes through an explicit client, used from connection callbacks
+// which may run before the client has been assigned to the publisher.
+func (p *mqttPublisher) publishWith(client mqttClient, msg mqttMessage) {
+	// The QoS set on the message is a minimum, eg. Homie requires QoS 1
+	if qos := mqttTopicQoS(p.conf, msg.Topic); qos > msg.QoS {
+		msg.QoS = qos
+	}
+	client.Publish(msg, func(err error) {
+		p.stats.record(err)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"topic": msg.Topic,
+				"qos":   msg.QoS,
+			}).WithError(err).Warn("Failed to publish MQTT message")
+		}
+	})
+}
+
+// measurementMessage builds a message carrying measurement data, which expires
+// after the configured message_expiry on MQTT 5 connections.
+func (p *mqttPublisher) measurementMessage(topic string, payload []byte, contentType string, measurement parser.Measurement) mqttMessage {
+	return mqttMessage{
+		Topic:          topic,
+		Retain:         p.conf.RetainMessages,
+		Payload:        payload,
+		ContentType:    contentType,
+		MessageExpiry:  time.Duration(p.conf.MessageExpiry),
+		UserProperties: p.userProperties(measurement),
+	}
+}
+
+func (p *mqttPublisher) userProperties(measurement parser.Measurement) []mqttUserProperty {
+	props := []mqttUserProperty{
+		{Key: "mac", Value: measurement.Mac},
+		{Key: "data_format", Value: fmt.Sprintf("%X", measurement.DataFormat)},
+	}
+	if measurement.Name != nil {
+		props = append(props, mqttUserProperty{Key: "name", Value: *measurement.Name})
+	}
+	keys := make([]string, 0, len(p.conf.UserProperties))
+	for key := range p.conf.UserProperties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		props = append(props, mqttUserProperty{Key: key, Value: p.conf.UserProperties[key]})
+	}
+	return props
+}
+
+func (p *mqttPublisher) logStats(interval time.Duration) {
+	for range time.Tick(interval) {
+		fields := log.Fields{
+			"published": p.stats.published.Load(),
+			"failed":    p.stats.failed.Load(),
+		}
+		if p.stats.failed.Load() > 0 {
+			log.WithFields(fields).Info("MQTT publish statistics")
+		} else {
+			log.WithFields(fields).Debug("MQTT publish statistics")
+		}
+	}
+}
+
+// mqttConnect connects a client with the given client ID, last will and connection callback
+type mqttConnect func(clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient
+
+// connectMQTT connects the sink publisher and, when enabled, the Homie publisher. Homie sets its
+// $state to lost with the last will of a connection of its own, so the sink connection keeps the
+// lwt_topic will which Home Assistant uses as the availability topic.
+func connectMQTT(conf config.MQTTPublisher, clientID string, publisher *mqttPublisher, homie *homiePublisher, connect mqttConnect) {
+	var will *mqttMessage
+	if conf.LWTTopic != "" {
+		will = &mqttMessage{
+			Topic:   conf.LWTTopic,
+			QoS:     mqttTopicQoS(conf, conf.LWTTopic),
+			Retain:  true,
+			Payload: []byte(lwtOfflinePayload(conf)),
+		}
+	}
+	publisher.client = connect(clientID, will, func(client mqttClient) {
+		if conf.LWTTopic != "" {
+			publisher.publishWith(client, mqttMessage{
+				Topic:   conf.LWTTopic,
+				Retain:  true,
+				Payload: []byte(lwtOnlinePayload(conf)),
+			})
+		}
+	})
+	if homie != nil {
+		homie.publisher.client = connect(clientID+"-homie", homie.will(), homie.onConnect)
+	}
+}
+
+// mqttContentType guesses the MQTT 5 content type of a rendered payload
+func mqttContentType(payload []byte) string {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+func MQTT(conf config.MQTTPublisher, control GatewayControl) chan<- parser.Measurement {
 	server := normalizeBrokerURL(conf.BrokerUrl)
 	log.WithFields(log.Fields{
+		"instance":         conf.Name,
 		"target":           server,
 		"topic_prefix":     conf.TopicPrefix,
 		"minimum_interval": conf.MinimumInterval,
+		"protocol_version": conf.ProtocolVersion,
+		"qos":              conf.QoS,
 	}).Info("Starting MQTT sink")
 
 	clientID := conf.ClientID
 	if clientID == "" {
 		clientID = "RuuviBridgePublisher"
-	}
-	opts := mqtt.NewClientOptions()
-	opts.SetCleanSession(false)
-	opts.AddBroker(server)
-	opts.SetClientID(clientID)
-	opts.SetUsername(conf.Username)
-	opts.SetPassword(conf.Password)
-	opts.SetKeepAlive(10 * time.Second)
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(10 * time.Second)
-	if conf.LWTTopic != "" {
-		payload := conf.LWTOfflinePayload
-		if payload == "" {
-			payload = "{\"state\":\"offline\"}"
+		// Instances connecting to the same broker must not share the client ID
+		if conf.Name != "" {
+			clientID += "-" + conf.Name
 		}
-		opts.SetWill(conf.LWTTopic, payload, 0, true)
 	}
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-			log.WithFields(log.Fields{
-				"target":           server,
-				"topic_prefix":     conf.TopicPrefix,
-				"minimum_interval": conf.MinimumInterval,
-			}).WithError(token.Error()).Error("Failed to connect to MQTT")
+	publisher := &mqttPublisher{
+		conf:  conf,
+		stats: &mqttPublishStats{},
 	}
-	if conf.LWTTopic != "" {
-		payload := conf.LWTOnlinePayload
-		if payload == "" {
-			payload = "{\"state\":\"online\"}"
+	var homeassistant *homeassistantPublisher
+	if conf.HomeassistantDiscoveryPrefix != "" {
+		homeassistant = newHomeassistantPublisher(publisher)
+	}
+	var homie *homiePublisher
+	if conf.HomieBaseTopic != "" {
+		homie = newHomiePublisher(&mqttPublisher{conf: conf, stats: publisher.stats})
+	}
+	connectMQTT(conf, clientID, publisher, homie, func(clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient {
+		return newMQTTClient(conf, server, clientID, will, onConnect)
+	})
+	go publisher.logStats(5 * time.Minute)
+	if homeassistant != nil {
+		err := publisher.client.Subscribe(homeassistant.statusTopic(), 0, func(msg mqttMessage) {
+			homeassistant.onStatus(msg.Payload)
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to subscribe to the Home Assistant status topic")
 		}
-		client.Publish(conf.LWTTopic, 0, true, payload)
 	}
 
-	// Helper to get tag name from config
-	getTagName := func(mac string) string {
-		if tagNames != nil {
-			if name, ok := tagNames[strings.ToUpper(mac)]; ok && name != "" {
-				return name
-			}
-		}
-		return ""
+	if conf.ControlEnabled && control != nil {
+		newMQTTControl(publisher, control).subscribe()
 	}
 
-	limiter := limiter.New(time.Duration(conf.MinimumInterval))
+	templates := newMQTTTemplates(conf)
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
 	measurements := make(chan parser.Measurement, 1024)
 	go func() {
 		for measurement := range measurements {
@@ -95,70 +206,30 @@ func MQTT(conf config.MQTTPublisher, tagNames map[string]string) chan<- parser.M
 				log.WithField("mac", measurement.Mac).Trace("Skipping MQTT publish due to interval limit")
 				continue
 			}
-			// Add tag name to measurement if configured
-			if name := getTagName(measurement.Mac); name != "" {
-				measurement.Name = &name
+			topic, err := templates.Topic(measurement)
+			if err != nil {
+				log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to render MQTT topic")
+				continue
 			}
-			data, err := json.Marshal(measurement)
+			data, err := templates.Payload(measurement)
 			if err != nil {
 				log.WithError(err).Error("Failed to serialize measurement")
 			} else {
-				client.Publish(conf.TopicPrefix+"/"+measurement.Mac, 0, conf.RetainMessages, string(data))
-				if conf.HomeassistantDiscoveryPrefix != "" {
-					publishHomeAssistantDiscoveries(client, conf, measurement)
+				publisher.publish(publisher.measurementMessage(topic, data, mqttContentType(data), measurement))
+				if homeassistant != nil {
+					homeassistant.publish(measurement, topic)
+				}
+				if homie != nil {
+					homie.publish(measurement)
 				}
 				if conf.PublishRaw {
-					safePublishF := func(label string, v *float64) {
-						if v != nil {
-							client.Publish(conf.TopicPrefix+"/"+measurement.Mac+"/"+label, 0, conf.RetainMessages, strconv.FormatFloat(*v, 'f', -1, 64))
-						}
-					}
-					safePublishI := func(label string, v *int64) {
-						if v != nil {
-							client.Publish(conf.TopicPrefix+"/"+measurement.Mac+"/"+label, 0, conf.RetainMessages, strconv.FormatInt(*v, 10))
-						}
+					messages, err := templates.FieldMessages(measurement)
+					if err != nil {
+						log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to render MQTT field messages")
 					}
-					safePublishB := func(label string, v *bool) {
-						if v != nil {
-							client.Publish(conf.TopicPrefix+"/"+measurement.Mac+"/"+label, 0, conf.RetainMessages, strconv.FormatBool(*v))
-						}
+					for _, msg := range messages {
+						publisher.publish(publisher.measurementMessage(msg.Topic, msg.Payload, mqttContentType(msg.Payload), measurement))
 					}
-					safePublishF("temperature", measurement.Temperature)
-					safePublishF("humidity", measurement.Humidity)
-					safePublishF("pressure", measurement.Pressure)
-					safePublishF("accelerationX", measurement.AccelerationX)
-					safePublishF("accelerationY", measurement.AccelerationY)
-					safePublishF("accelerationZ", measurement.AccelerationZ)
-					safePublishF("batteryVoltage", measurement.BatteryVoltage)
-					safePublishI("txPower", measurement.TxPower)
-					safePublishI("rssi", measurement.Rssi)
-					safePublishI("movementCounter", measurement.MovementCounter)
-					safePublishI("measurementSequenceNumber", measurement.MeasurementSequenceNumber)
-					safePublishF("accelerationTotal", measurement.AccelerationTotal)
-					safePublishF("absoluteHumidity", measurement.AbsoluteHumidity)
-					safePublishF("dewPoint", measurement.DewPoint)
-					safePublishF("equilibriumVaporPressure", measurement.EquilibriumVaporPressure)
-					safePublishF("airDensity", measurement.AirDensity)
-					safePublishF("accelerationAngleFromX", measurement.AccelerationAngleFromX)
-					safePublishF("accelerationAngleFromY", measurement.AccelerationAngleFromY)
-					safePublishF("accelerationAngleFromZ", measurement.AccelerationAngleFromZ)
-					// New E1 fields
-					safePublishF("pm1p0", measurement.Pm1p0)
-					safePublishF("pm2p5", measurement.Pm2p5)
-					safePublishF("pm4p0", measurement.Pm4p0)
-					safePublishF("pm10p0", measurement.Pm10p0)
-					safePublishF("co2", measurement.CO2)
-					safePublishF("voc", measurement.VOC)
-					safePublishF("nox", measurement.NOX)
-					safePublishF("illuminance", measurement.Illuminance)
-					safePublishF("soundInstant", measurement.SoundInstant)
-					safePublishF("soundAverage", measurement.SoundAverage)
-					safePublishF("soundPeak", measurement.SoundPeak)
-					safePublishF("airQualityIndex", measurement.AirQualityIndex)
-					// Diagnostics
-					safePublishB("calibrationInProgress", measurement.CalibrationInProgress)
-					safePublishB("buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
-					safePublishB("rtcOnBoot", measurement.RtcOnBoot)
 				}
 			}
 		}
@@ -0,0 +1,459 @@
+package data_sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	mqttPublishTimeout = 10 * time.Second
+	// Messages waiting to be sent, further messages are dropped while the broker is not responding
+	mqttPublishQueueSize = 1024
+	// Messages sent and waiting for the broker acknowledgement on MQTT 3.1.1 connections
+	mqttMaxInFlight = 256
+)
+
+var errMQTTQueueFull = errors.New("publish queue is full")
+
+// mqttMessage is a single outgoing or incoming MQTT message. ContentType, MessageExpiry,
+// UserProperties, ResponseTopic and CorrelationData are MQTT 5 features and are silently
+// dropped on 3.1.1 connections.
+type mqttMessage struct {
+	Topic           string
+	QoS             byte
+	Retain          bool
+	Payload         []byte
+	ContentType     string
+	MessageExpiry   time.Duration
+	UserProperties  []mqttUserProperty
+	ResponseTopic   string
+	CorrelationData []byte
+}
+
+type mqttUserProperty struct {
+	Key   string
+	Value string
+}
+
+// mqttClient hides the differences between the paho MQTT 3.1.1 and MQTT 5 clients.
+// Publish does not block, the messages are sent in order and done is called once the
+// broker has acknowledged the message (for QoS > 0), the message has been written to
+// the connection (for QoS 0) or publishing has failed.
+type mqttClient interface {
+	Publish(msg mqttMessage, done func(error))
+	// Subscribe registers a handler for a topic filter. Subscriptions are restored
+	// on every reconnection and handlers are called in their own goroutine.
+	Subscribe(filter string, qos byte, handler func(msg mqttMessage)) error
+}
+
+type mqttSubscription struct {
+	filter  string
+	qos     byte
+	handler func(msg mqttMessage)
+}
+
+// mqttSubscriptions is the list of subscriptions restored on reconnection
+type mqttSubscriptions struct {
+	mu   sync.Mutex
+	list []mqttSubscription
+}
+
+func (s *mqttSubscriptions) add(sub mqttSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, sub)
+}
+
+func (s *mqttSubscriptions) all() []mqttSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mqttSubscription(nil), s.list...)
+}
+
+type mqttQueuedMessage struct {
+	msg  mqttMessage
+	done func(error)
+}
+
+// mqttPublishQueue sends the messages in order from its own goroutine, so a broker which
+// does not respond does not block the sink. Messages are dropped when the queue is full.
+type mqttPublishQueue struct {
+	messages chan mqttQueuedMessage
+}
+
+func newMQTTPublishQueue(size int, send func(msg mqttMessage, done func(error))) *mqttPublishQueue {
+	q := &mqttPublishQueue{messages: make(chan mqttQueuedMessage, size)}
+	go func() {
+		for m := range q.messages {
+			send(m.msg, m.done)
+		}
+	}()
+	return q
+}
+
+func (q *mqttPublishQueue) add(msg mqttMessage, done func(error)) {
+	select {
+	case q.messages <- mqttQueuedMessage{msg: msg, done: done}:
+	default:
+		done(errMQTTQueueFull)
+	}
+}
+
+type mqttPublishStats struct {
+	published atomic.Uint64
+	failed    atomic.Uint64
+}
+
+func (s *mqttPublishStats) record(err error) {
+	if err != nil {
+		s.failed.Add(1)
+	} else {
+		s.published.Add(1)
+	}
+}
+
+func isMQTT5(conf config.MQTTPublisher) bool {
+	switch conf.ProtocolVersion {
+	case "5", "5.0", "v5":
+		return true
+	case "", "3", "3.1.1", "4", "v3":
+		return false
+	default:
+		log.WithField("protocol_version", conf.ProtocolVersion).Warn("Unknown MQTT protocol version, falling back to 3.1.1")
+		return false
+	}
+}
+
+// newMQTTClient connects to the broker with the configured protocol version. The
+// optional will is registered as the last will of the connection and the onConnect
+// callback is called on every (re)connection.
+func newMQTTClient(conf config.MQTTPublisher, server string, clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient {
+	if isMQTT5(conf) {
+		return newMQTTv5Client(conf, server, clientID, will, onConnect)
+	}
+	return newMQTTv3Client(conf, server, clientID, will, onConnect)
+}
+
+type mqttV3Client struct {
+	client        mqtt.Client
+	subscriptions mqttSubscriptions
+	queue         *mqttPublishQueue
+	inFlight      chan struct{}
+}
+
+func newMQTTv3Client(conf config.MQTTPublisher, server string, clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient {
+	c := &mqttV3Client{inFlight: make(chan struct{}, mqttMaxInFlight)}
+	c.queue = newMQTTPublishQueue(mqttPublishQueueSize, c.send)
+	opts := mqtt.NewClientOptions()
+	opts.SetCleanSession(false)
+	opts.AddBroker(server)
+	opts.SetClientID(clientID)
+	opts.SetUsername(conf.Username)
+	opts.SetPassword(conf.Password)
+	opts.SetKeepAlive(10 * time.Second)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(10 * time.Second)
+	// Publishing on a stalled connection gives up after the timeout instead of 30 seconds
+	opts.SetWriteTimeout(mqttPublishTimeout)
+	// Handlers run in their own goroutine so that they may publish
+	opts.SetOrderMatters(false)
+	if will != nil {
+		opts.SetBinaryWill(will.Topic, will.Payload, will.QoS, will.Retain)
+	}
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		for _, sub := range c.subscriptions.all() {
+			if err := c.subscribe(sub); err != nil {
+				log.WithError(err).WithField("topic", sub.filter).Error("Failed to subscribe to MQTT topic")
+			}
+		}
+		onConnect(c)
+	})
+	c.client = mqtt.NewClient(opts)
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		log.WithFields(log.Fields{
+			"target":           server,
+			"protocol_version": "3.1.1",
+		}).WithError(token.Error()).Error("Failed to connect to MQTT")
+	}
+	return c
+}
+
+func (c *mqttV3Client) Publish(msg mqttMessage, done func(error)) {
+	c.queue.add(msg, done)
+}
+
+// send hands the message to paho, which keeps the order, and waits for the result in
+// its own goroutine. The queue waits while mqttMaxInFlight messages are unacknowledged.
+func (c *mqttV3Client) send(msg mqttMessage, done func(error)) {
+	c.inFlight <- struct{}{}
+	token := c.client.Publish(msg.Topic, msg.QoS, msg.Retain, msg.Payload)
+	go func() {
+		defer func() { <-c.inFlight }()
+		if !token.WaitTimeout(mqttPublishTimeout) {
+			done(errors.New("timed out waiting for publish to complete"))
+			return
+		}
+		done(token.Error())
+	}()
+}
+
+func (c *mqttV3Client) Subscribe(filter string, qos byte, handler func(msg mqttMessage)) error {
+	sub := mqttSubscription{filter: filter, qos: qos, handler: handler}
+	c.subscriptions.add(sub)
+	if !c.client.IsConnectionOpen() {
+		// Subscribed by the connect handler once connected
+		return nil
+	}
+	return c.subscribe(sub)
+}
+
+func (c *mqttV3Client) subscribe(sub mqttSubscription) error {
+	token := c.client.Subscribe(sub.filter, sub.qos, func(_ mqtt.Client, m mqtt.Message) {
+		sub.handler(mqttMessage{
+			Topic:   m.Topic(),
+			QoS:     m.Qos(),
+			Retain:  m.Retained(),
+			Payload: m.Payload(),
+		})
+	})
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return errors.New("timed out waiting for subscription")
+	}
+	return token.Error()
+}
+
+type mqttV5Client struct {
+	mu            sync.Mutex
+	cm            *autopaho.ConnectionManager
+	subscriptions mqttSubscriptions
+	queue         *mqttPublishQueue
+}
+
+func newMQTTv5Client(conf config.MQTTPublisher, server string, clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient {
+	c := &mqttV5Client{}
+	// autopaho waits for the acknowledgement, one message at a time keeps them in order
+	c.queue = newMQTTPublishQueue(mqttPublishQueueSize, func(msg mqttMessage, done func(error)) {
+		done(c.send(msg))
+	})
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		log.WithError(err).WithField("target", server).Error("Invalid MQTT broker URL")
+		return c
+	}
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		KeepAlive:                     10,
+		CleanStartOnInitialConnection: false,
+		SessionExpiryInterval:         3600,
+		ReconnectBackoff:              autopaho.NewConstantBackoff(10 * time.Second),
+		ConnectUsername:               conf.Username,
+		ConnectPassword:               []byte(conf.Password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			c.mu.Lock()
+			c.cm = cm
+			c.mu.Unlock()
+			for _, sub := range c.subscriptions.all() {
+				if err := c.subscribe(cm, sub); err != nil {
+					log.WithError(err).WithField("topic", sub.filter).Error("Failed to subscribe to MQTT topic")
+				}
+			}
+			onConnect(c)
+		},
+		OnConnectError: func(err error) {
+			log.WithFields(log.Fields{
+				"target":           server,
+				"protocol_version": "5",
+			}).WithError(err).Error("Failed to connect to MQTT")
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					c.dispatch(pr.Packet)
+					return true, nil
+				},
+			},
+		},
+	}
+	if will != nil {
+		cfg.SetWillMessage(will.Topic, will.Payload, will.QoS, will.Retain)
+	}
+	cm, err := autopaho.NewConnection(context.Background(), cfg)
+	if err != nil {
+		log.WithError(err).WithField("target", server).Error("Failed to create MQTT 5 client")
+		return c
+	}
+	c.mu.Lock()
+	c.cm = cm
+	c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), mqttPublishTimeout)
+	defer cancel()
+	if err := cm.AwaitConnection(ctx); err != nil {
+		log.WithField("target", server).WithError(err).Warn("MQTT 5 connection not yet established, retrying in background")
+	}
+	return c
+}
+
+func (c *mqttV5Client) connection() *autopaho.ConnectionManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cm
+}
+
+func (c *mqttV5Client) Publish(msg mqttMessage, done func(error)) {
+	c.queue.add(msg, done)
+}
+
+func (c *mqttV5Client) send(msg mqttMessage) error {
+	cm := c.connection()
+	if cm == nil {
+		return errors.New("MQTT 5 client not initialized")
+	}
+	props := &paho.PublishProperties{
+		ContentType:     msg.ContentType,
+		ResponseTopic:   msg.ResponseTopic,
+		CorrelationData: msg.CorrelationData,
+	}
+	if msg.MessageExpiry > 0 {
+		expiry := uint32(msg.MessageExpiry / time.Second)
+		props.MessageExpiry = &expiry
+	}
+	for _, p := range msg.UserProperties {
+		props.User.Add(p.Key, p.Value)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mqttPublishTimeout)
+	defer cancel()
+	resp, err := cm.Publish(ctx, &paho.Publish{
+		QoS:        msg.QoS,
+		Retain:     msg.Retain,
+		Topic:      msg.Topic,
+		Properties: props,
+		Payload:    msg.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.ReasonCode >= 0x80 {
+		return fmt.Errorf("broker rejected publish with reason code 0x%02X", resp.ReasonCode)
+	}
+	return nil
+}
+
+func (c *mqttV5Client) Subscribe(filter string, qos byte, handler func(msg mqttMessage)) error {
+	sub := mqttSubscription{filter: filter, qos: qos, handler: handler}
+	c.subscriptions.add(sub)
+	cm := c.connection()
+	if cm == nil {
+		return nil
+	}
+	err := c.subscribe(cm, sub)
+	if errors.Is(err, autopaho.ConnectionDownError) {
+		// Subscribed by OnConnectionUp once connected
+		return nil
+	}
+	return err
+}
+
+func (c *mqttV5Client) subscribe(cm *autopaho.ConnectionManager, sub mqttSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mqttPublishTimeout)
+	defer cancel()
+	_, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: sub.filter, QoS: sub.qos}},
+	})
+	return err
+}
+
+func (c *mqttV5Client) dispatch(p *paho.Publish) {
+	msg := mqttMessage{
+		Topic:   p.Topic,
+		QoS:     p.QoS,
+		Retain:  p.Retain,
+		Payload: p.Payload,
+	}
+	if p.Properties != nil {
+		msg.ContentType = p.Properties.ContentType
+		msg.ResponseTopic = p.Properties.ResponseTopic
+		msg.CorrelationData = p.Properties.CorrelationData
+		for _, u := range p.Properties.User {
+			msg.UserProperties = append(msg.UserProperties, mqttUserProperty{Key: u.Key, Value: u.Value})
+		}
+	}
+	for _, sub := range c.subscriptions.all() {
+		if mqttTopicMatches(sub.filter, p.Topic) {
+			// Handlers may publish, which must not block the paho receive loop
+			go sub.handler(msg)
+		}
+	}
+}
+
+func lwtOfflinePayload(conf config.MQTTPublisher) string {
+	if conf.LWTOfflinePayload == "" {
+		return "{\"state\":\"offline\"}"
+	}
+	return conf.LWTOfflinePayload
+}
+
+func lwtOnlinePayload(conf config.MQTTPublisher) string {
+	if conf.LWTOnlinePayload == "" {
+		return "{\"state\":\"online\"}"
+	}
+	return conf.LWTOnlinePayload
+}
+
+// mqttTopicQoS returns the QoS for a topic. The most specific matching filter in
+// topic_qos wins, otherwise the sink-wide qos is used.
+func mqttTopicQoS(conf config.MQTTPublisher, topic string) byte {
+	best := ""
+	found := false
+	filters := make([]string, 0, len(conf.TopicQoS))
+	for filter := range conf.TopicQoS {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	for _, filter := range filters {
+		if mqttTopicMatches(filter, topic) && (!found || len(filter) > len(best)) {
+			best = filter
+			found = true
+		}
+	}
+	qos := conf.QoS
+	if found {
+		qos = conf.TopicQoS[best]
+	}
+	if qos > 2 {
+		qos = 2
+	}
+	return qos
+}
+
+// mqttTopicMatches reports whether topic matches the MQTT topic filter, supporting
+// the single level (+) and multi level (#) wildcards.
+func mqttTopicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,139 @@
+package data_sinks
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+type fakeMQTTClient struct {
+	mu       sync.Mutex
+	messages []mqttMessage
+}
+
+func (c *fakeMQTTClient) Publish(msg mqttMessage, done func(error)) {
+	c.mu.Lock()
+	c.messages = append(c.messages, msg)
+	c.mu.Unlock()
+	done(nil)
+}
+
+func (c *fakeMQTTClient) Subscribe(filter string, qos byte, handler func(msg mqttMessage)) error {
+	return nil
+}
+
+// retained returns the last payload published to each topic
+func (c *fakeMQTTClient) retained() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make(map[string]string)
+	for _, msg := range c.messages {
+		topics[msg.Topic] = string(msg.Payload)
+	}
+	return topics
+}
+
+func newTestPublisher(conf config.MQTTPublisher) (*mqttPublisher, *fakeMQTTClient) {
+	client := &fakeMQTTClient{}
+	return &mqttPublisher{client: client, conf: conf, stats: &mqttPublishStats{}}, client
+}
+
+func TestMQTTTopicQoS(t *testing.T) {
+	conf := config.MQTTPublisher{
+		QoS: 0,
+		TopicQoS: map[string]byte{
+			"homeassistant/#":  1,
+			"ruuvi/+/rssi":     2,
+			"ruuvi/+/+":        1,
+			"something/else/#": 2,
+		},
+	}
+	cases := map[string]byte{
+		"ruuvi/AA:BB":                        0,
+		"ruuvi/AA:BB/rssi":                   2,
+		"ruuvi/AA:BB/temperature":            1,
+		"homeassistant/sensor/x/config":      1,
+		"homeassistantfoo/sensor/x/config":   0,
+		"ruuvi/AA:BB/temperature/additional": 0,
+	}
+	for topic, want := range cases {
+		if got := mqttTopicQoS(conf, topic); got != want {
+			t.Errorf("mqttTopicQoS(%q): got %d want %d", topic, got, want)
+		}
+	}
+}
+
+func TestMQTTTopicMatches(t *testing.T) {
+	cases := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"ruuvi/#", "ruuvi/AA:BB/temperature", true},
+		{"ruuvi/#", "ruuvi", true},
+		{"ruuvi/+", "ruuvi/AA:BB", true},
+		{"ruuvi/+", "ruuvi/AA:BB/temperature", false},
+		{"ruuvi/AA:BB", "ruuvi/AA:BC", false},
+	}
+	for _, c := range cases {
+		if got := mqttTopicMatches(c.filter, c.topic); got != c.want {
+			t.Errorf("mqttTopicMatches(%q, %q): got %v want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestMQTTPublishQueue(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sent []string
+	q := newMQTTPublishQueue(2, func(msg mqttMessage, done func(error)) {
+		// The broker does not respond until released
+		<-release
+		mu.Lock()
+		sent = append(sent, msg.Topic)
+		mu.Unlock()
+		done(nil)
+	})
+
+	results := make(chan error, 10)
+	done := func(err error) { results <- err }
+	start := time.Now()
+	// The first message is taken by the worker, two wait in the queue and the last is dropped
+	q.add(mqttMessage{Topic: "a"}, done)
+	time.Sleep(10 * time.Millisecond)
+	q.add(mqttMessage{Topic: "b"}, done)
+	q.add(mqttMessage{Topic: "c"}, done)
+	q.add(mqttMessage{Topic: "d"}, done)
+	if time.Since(start) > time.Second {
+		t.Error("add blocked on a broker which does not respond")
+	}
+	if err := <-results; !errors.Is(err, errMQTTQueueFull) {
+		t.Errorf("got %v, want %v", err, errMQTTQueueFull)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("message %d: %v", i, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 3 || sent[0] != "a" || sent[1] != "b" || sent[2] != "c" {
+		t.Errorf("sent %v", sent)
+	}
+}
+
+func TestMQTTPublisher_Stats(t *testing.T) {
+	publisher, client := newTestPublisher(config.MQTTPublisher{QoS: 1})
+	publisher.publish(mqttMessage{Topic: "ruuvi/AA:BB"})
+	if len(client.messages) != 1 || client.messages[0].QoS != 1 {
+		t.Errorf("messages: %+v", client.messages)
+	}
+	if publisher.stats.published.Load() != 1 || publisher.stats.failed.Load() != 0 {
+		t.Errorf("published %d, failed %d", publisher.stats.published.Load(), publisher.stats.failed.Load())
+	}
+}
@@ -0,0 +1,134 @@
+package data_sinks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GatewayControl is the management interface used by the MQTT control plane.
+// Changes made through it are persisted to the config file and applied without a restart.
+type GatewayControl interface {
+	SetTagName(mac string, name string) (map[string]string, error)
+	SetTagEnabled(mac string, enabled bool) ([]string, error)
+	ReloadConfig() error
+	Status() interface{}
+}
+
+type mqttControlRequest struct {
+	ID   json.RawMessage `json:"id,omitempty"`
+	Mac  string          `json:"mac,omitempty"`
+	Name string          `json:"name,omitempty"`
+}
+
+type mqttControlResponse struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Command string          `json:"command"`
+	Success bool            `json:"success"`
+	Error   string          `json:"error,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+}
+
+type mqttControl struct {
+	publisher *mqttPublisher
+	control   GatewayControl
+	base      string
+}
+
+func newMQTTControl(publisher *mqttPublisher, control GatewayControl) *mqttControl {
+	base := publisher.conf.ControlTopic
+	if base == "" {
+		base = publisher.conf.TopicPrefix + "/gateway"
+	}
+	return &mqttControl{
+		publisher: publisher,
+		control:   control,
+		base:      strings.TrimSuffix(base, "/"),
+	}
+}
+
+func (c *mqttControl) commandTopic() string {
+	return c.base + "/cmd/+"
+}
+
+func (c *mqttControl) execute(command string, req mqttControlRequest) (interface{}, error) {
+	switch command {
+	case "rename":
+		if req.Mac == "" {
+			return nil, errors.New("mac is required")
+		}
+		return c.control.SetTagName(req.Mac, req.Name)
+	case "enable", "disable":
+		if req.Mac == "" {
+			return nil, errors.New("mac is required")
+		}
+		return c.control.SetTagEnabled(req.Mac, command == "enable")
+	case "reload":
+		return nil, c.control.ReloadConfig()
+	case "status":
+		return c.control.Status(), nil
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (c *mqttControl) handle(msg mqttMessage) {
+	command := strings.TrimPrefix(msg.Topic, c.base+"/cmd/")
+	if msg.Retain {
+		// A retained command would be executed again on every reconnect
+		log.WithField("topic", msg.Topic).Warn("Ignoring retained MQTT control command")
+		return
+	}
+
+	var req mqttControlRequest
+	resp := mqttControlResponse{Command: command}
+	if len(strings.TrimSpace(string(msg.Payload))) > 0 {
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			resp.Error = "invalid JSON: " + err.Error()
+		}
+	}
+	resp.ID = req.ID
+	if resp.Error == "" {
+		result, err := c.execute(command, req)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Success = true
+			resp.Result = result
+		}
+	}
+
+	fields := log.Fields{"command": command, "mac": req.Mac}
+	if resp.Success {
+		log.WithFields(fields).Info("Executed MQTT control command")
+	} else {
+		log.WithFields(fields).WithField("error", resp.Error).Warn("MQTT control command failed")
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.WithError(err).Error("Failed to serialize MQTT control response")
+		return
+	}
+	reply := mqttMessage{
+		Topic:           c.base + "/response/" + command,
+		QoS:             1,
+		Payload:         payload,
+		ContentType:     "application/json",
+		CorrelationData: msg.CorrelationData,
+	}
+	if msg.ResponseTopic != "" {
+		reply.Topic = msg.ResponseTopic
+	}
+	c.publisher.publish(reply)
+}
+
+func (c *mqttControl) subscribe() {
+	log.WithField("topic", c.commandTopic()).Info("Accepting MQTT control commands")
+	if err := c.publisher.client.Subscribe(c.commandTopic(), 1, c.handle); err != nil {
+		log.WithError(err).Error("Failed to subscribe to the MQTT control topic")
+	}
+}
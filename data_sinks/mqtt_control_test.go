@@ -0,0 +1,110 @@
+package data_sinks
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+type fakeGatewayControl struct {
+	names   map[string]string
+	enabled []string
+}
+
+func (c *fakeGatewayControl) SetTagName(mac string, name string) (map[string]string, error) {
+	if mac != "AA:BB:CC:DD:EE:FF" {
+		return nil, errors.New("invalid MAC address")
+	}
+	c.names[mac] = name
+	return c.names, nil
+}
+
+func (c *fakeGatewayControl) SetTagEnabled(mac string, enabled bool) ([]string, error) {
+	if enabled {
+		c.enabled = append(c.enabled, mac)
+	} else {
+		c.enabled = nil
+	}
+	return c.enabled, nil
+}
+
+func (c *fakeGatewayControl) ReloadConfig() error {
+	return nil
+}
+
+func (c *fakeGatewayControl) Status() interface{} {
+	return map[string]string{"version": "test"}
+}
+
+func lastResponse(t *testing.T, client *fakeMQTTClient) (mqttMessage, map[string]interface{}) {
+	t.Helper()
+	msg := client.messages[len(client.messages)-1]
+	var resp map[string]interface{}
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", msg.Payload, err)
+	}
+	return msg, resp
+}
+
+func TestMQTTControl_Commands(t *testing.T) {
+	publisher, client := newTestPublisher(config.MQTTPublisher{TopicPrefix: "ruuvi", ControlEnabled: true})
+	gateway := &fakeGatewayControl{names: make(map[string]string)}
+	control := newMQTTControl(publisher, gateway)
+	if control.commandTopic() != "ruuvi/gateway/cmd/+" {
+		t.Errorf("commandTopic: got %q", control.commandTopic())
+	}
+
+	control.handle(mqttMessage{
+		Topic:   "ruuvi/gateway/cmd/rename",
+		Payload: []byte(`{"id":"abc","mac":"AA:BB:CC:DD:EE:FF","name":"Sauna"}`),
+	})
+	msg, resp := lastResponse(t, client)
+	if msg.Topic != "ruuvi/gateway/response/rename" || resp["id"] != "abc" || resp["success"] != true {
+		t.Errorf("rename: got %s=%s", msg.Topic, msg.Payload)
+	}
+	if gateway.names["AA:BB:CC:DD:EE:FF"] != "Sauna" {
+		t.Errorf("rename: tag name not set")
+	}
+
+	// MQTT 5 requests are answered on the response topic with the correlation data
+	control.handle(mqttMessage{
+		Topic:           "ruuvi/gateway/cmd/enable",
+		Payload:         []byte(`{"id":7,"mac":"AA:BB:CC:DD:EE:FF"}`),
+		ResponseTopic:   "client/replies",
+		CorrelationData: []byte("req-1"),
+	})
+	msg, resp = lastResponse(t, client)
+	if msg.Topic != "client/replies" || string(msg.CorrelationData) != "req-1" || resp["id"] != float64(7) {
+		t.Errorf("enable: got %s=%s (%s)", msg.Topic, msg.Payload, msg.CorrelationData)
+	}
+	if len(gateway.enabled) != 1 {
+		t.Errorf("enable: tag not enabled")
+	}
+
+	control.handle(mqttMessage{Topic: "ruuvi/gateway/cmd/status"})
+	_, resp = lastResponse(t, client)
+	if result, ok := resp["result"].(map[string]interface{}); !ok || result["version"] != "test" {
+		t.Errorf("status: got %v", resp)
+	}
+
+	for _, tc := range []struct{ topic, payload string }{
+		{"ruuvi/gateway/cmd/rename", `{"mac":"invalid"}`},
+		{"ruuvi/gateway/cmd/disable", `{}`},
+		{"ruuvi/gateway/cmd/reboot", `{}`},
+		{"ruuvi/gateway/cmd/status", `not json`},
+	} {
+		control.handle(mqttMessage{Topic: tc.topic, Payload: []byte(tc.payload)})
+		if _, resp := lastResponse(t, client); resp["success"] != false || resp["error"] == "" {
+			t.Errorf("%s %s: expected error, got %v", tc.topic, tc.payload, resp)
+		}
+	}
+
+	// Retained commands are never executed
+	count := len(client.messages)
+	control.handle(mqttMessage{Topic: "ruuvi/gateway/cmd/reload", Retain: true})
+	if len(client.messages) != count {
+		t.Errorf("retained command was executed")
+	}
+}
@@ -3,11 +3,12 @@
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/Saavuori/ruuvi-go-gateway/config"
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -58,22 +59,23 @@ type homeassistantDiscoveryConfig struct {
 	EntityCategory       string
 }
 
-func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublisher, measurement parser.Measurement) {
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+func homeassistantDiscoveryConfigs(measurement parser.Measurement) []homeassistantDiscoveryConfig {
+	var configs []homeassistantDiscoveryConfig
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Temperature != nil,
 		DeviceClass:       "temperature",
 		EntityName:        "Temperature",
 		UnitOfMeasurement: "Â°C",
 		JsonAttribute:     "temperature",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Humidity != nil,
 		DeviceClass:       "humidity",
 		EntityName:        "Humidity",
 		UnitOfMeasurement: "%",
 		JsonAttribute:     "humidity",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:            measurement.Pressure != nil,
 		DeviceClass:          "pressure",
 		EntityName:           "Pressure",
@@ -81,35 +83,35 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:        "pressure",
 		JsonAttributeMutator: " / 100.0",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationX != nil,
 		EntityName:        "Acceleration X",
 		UnitOfMeasurement: "g",
 		JsonAttribute:     "accelerationX",
 		Icon:              "mdi:axis-x-arrow",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationY != nil,
 		EntityName:        "Acceleration Y",
 		UnitOfMeasurement: "g",
 		JsonAttribute:     "accelerationY",
 		Icon:              "mdi:axis-y-arrow",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationZ != nil,
 		EntityName:        "Acceleration Z",
 		UnitOfMeasurement: "g",
 		JsonAttribute:     "accelerationZ",
 		Icon:              "mdi:axis-z-arrow",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.BatteryVoltage != nil,
 		DeviceClass:       "voltage",
 		EntityName:        "Battery voltage",
 		UnitOfMeasurement: "V",
 		JsonAttribute:     "batteryVoltage",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.MovementCounter != nil,
 		EntityName:        "Movement counter",
 		UnitOfMeasurement: "x",
@@ -117,28 +119,28 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		StateClass:        "total_increasing",
 		EntityCategory:    "diagnostic",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationTotal != nil,
 		EntityName:        "Total acceleration",
 		UnitOfMeasurement: "g",
 		JsonAttribute:     "accelerationTotal",
 		Icon:              "mdi:axis-arrow",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AbsoluteHumidity != nil,
 		EntityName:        "Absolute humidity",
 		UnitOfMeasurement: "g/mÂ³",
 		JsonAttribute:     "absoluteHumidity",
 		Icon:              "mdi:water",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.DewPoint != nil,
 		DeviceClass:       "temperature",
 		EntityName:        "Dew point",
 		UnitOfMeasurement: "Â°C",
 		JsonAttribute:     "dewPoint",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:            measurement.EquilibriumVaporPressure != nil,
 		DeviceClass:          "pressure",
 		EntityName:           "Equilibrium vapor pressure",
@@ -146,35 +148,35 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:        "equilibriumVaporPressure",
 		JsonAttributeMutator: " / 100.0",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AirDensity != nil,
 		EntityName:        "Air density",
 		UnitOfMeasurement: "kg/mÂ³",
 		JsonAttribute:     "airDensity",
 		Icon:              "mdi:gauge",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationAngleFromX != nil,
 		EntityName:        "Acceleration angle from X axis",
 		UnitOfMeasurement: "Â°",
 		JsonAttribute:     "accelerationAngleFromX",
 		Icon:              "mdi:angle-acute",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationAngleFromY != nil,
 		EntityName:        "Acceleration angle from Y axis",
 		UnitOfMeasurement: "Â°",
 		JsonAttribute:     "accelerationAngleFromY",
 		Icon:              "mdi:angle-acute",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.AccelerationAngleFromZ != nil,
 		EntityName:        "Acceleration angle from Z axis",
 		UnitOfMeasurement: "Â°",
 		JsonAttribute:     "accelerationAngleFromZ",
 		Icon:              "mdi:angle-acute",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Rssi != nil,
 		DeviceClass:       "signal_strength",
 		EntityName:        "RSSI",
@@ -183,7 +185,7 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		Icon:              "mdi:signal-variant",
 		EntityCategory:    "diagnostic",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.TxPower != nil,
 		EntityName:        "TX power",
 		UnitOfMeasurement: "dBm",
@@ -191,7 +193,7 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		Icon:              "mdi:signal-variant",
 		EntityCategory:    "diagnostic",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.MeasurementSequenceNumber != nil,
 		EntityName:        "Measurement sequence number",
 		UnitOfMeasurement: "x",
@@ -201,56 +203,56 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		EntityCategory:    "diagnostic",
 	})
 	// New E1 fields
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Pm1p0 != nil,
 		DeviceClass:       "pm1",
 		EntityName:        "PM1.0",
 		UnitOfMeasurement: "Âµg/mÂ³",
 		JsonAttribute:     "pm1p0",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Pm2p5 != nil,
 		DeviceClass:       "pm25",
 		EntityName:        "PM2.5",
 		UnitOfMeasurement: "Âµg/mÂ³",
 		JsonAttribute:     "pm2p5",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Pm4p0 != nil,
 		EntityName:        "PM4.0",
 		UnitOfMeasurement: "Âµg/mÂ³",
 		JsonAttribute:     "pm4p0",
 		Icon:              "mdi:molecule",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Pm10p0 != nil,
 		DeviceClass:       "pm10",
 		EntityName:        "PM10",
 		UnitOfMeasurement: "Âµg/mÂ³",
 		JsonAttribute:     "pm10p0",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.CO2 != nil,
 		DeviceClass:       "carbon_dioxide",
 		EntityName:        "COâ‚‚",
 		UnitOfMeasurement: "ppm",
 		JsonAttribute:     "co2",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.VOC != nil,
 		EntityName:        "VOC index",
 		UnitOfMeasurement: "x",
 		JsonAttribute:     "voc",
 		Icon:              "mdi:molecule",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.NOX != nil,
 		EntityName:        "NOx index",
 		UnitOfMeasurement: "x",
 		JsonAttribute:     "nox",
 		Icon:              "mdi:molecule",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.Illuminance != nil,
 		DeviceClass:       "illuminance",
 		EntityName:        "Illuminance",
@@ -258,7 +260,7 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:     "illuminance",
 		Icon:              "mdi:brightness-5",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.SoundInstant != nil,
 		DeviceClass:       "sound_pressure",
 		EntityName:        "Sound level (instant, A-weighted)",
@@ -266,7 +268,7 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:     "soundInstant",
 		Icon:              "mdi:volume-medium",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.SoundAverage != nil,
 		DeviceClass:       "sound_pressure",
 		EntityName:        "Sound level (average, A-weighted)",
@@ -274,7 +276,7 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:     "soundAverage",
 		Icon:              "mdi:volume-medium",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:         measurement.SoundPeak != nil,
 		DeviceClass:       "sound_pressure",
 		EntityName:        "Sound level (peak, A-weighted)",
@@ -282,22 +284,173 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		JsonAttribute:     "soundPeak",
 		Icon:              "mdi:volume-high",
 	})
-	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+	configs = append(configs, homeassistantDiscoveryConfig{
 		Available:     measurement.AirQualityIndex != nil,
 		DeviceClass:   "aqi",
 		EntityName:    "Air quality index",
 		JsonAttribute: "airQualityIndex",
 	})
+	return configs
 }
 
-func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher, measurement parser.Measurement, disco homeassistantDiscoveryConfig) {
-	id := fmt.Sprintf("ruuvitag_%s_%s", strings.ReplaceAll(measurement.Mac, ":", ""), disco.JsonAttribute)
-	confTopicPrefix := fmt.Sprintf("%s/sensor/%s", conf.HomeassistantDiscoveryPrefix, id)
-	if !disco.Available {
-		client.Publish(confTopicPrefix+"/config", 0, conf.RetainMessages, "")
-		client.Publish(confTopicPrefix+"/attributes", 0, conf.RetainMessages, "")
+// homeassistantDeviceState is the discovery state last published for a tag
+type homeassistantDeviceState struct {
+	measurement parser.Measurement
+	stateTopic  string
+	configs     map[string]string // JSON attribute -> published discovery config
+	attributes  string
+}
+
+// homeassistantPublisher publishes Home Assistant MQTT discovery. Discovery data is
+// cached per tag and only republished when it changes (eg. new fields, name or model),
+// or when Home Assistant announces it has (re)started with its birth message.
+type homeassistantPublisher struct {
+	publisher *mqttPublisher
+
+	mu      sync.Mutex
+	devices map[string]*homeassistantDeviceState
+}
+
+func newHomeassistantPublisher(publisher *mqttPublisher) *homeassistantPublisher {
+	return &homeassistantPublisher{
+		publisher: publisher,
+		devices:   make(map[string]*homeassistantDeviceState),
+	}
+}
+
+// statusTopic is the topic of the Home Assistant birth and last will messages
+func (h *homeassistantPublisher) statusTopic() string {
+	return h.publisher.conf.HomeassistantDiscoveryPrefix + "/status"
+}
+
+func (h *homeassistantPublisher) onStatus(payload []byte) {
+	if strings.TrimSpace(string(payload)) != "online" {
 		return
 	}
+	log.Info("Home Assistant came online, republishing discovery data")
+	go h.republish()
+}
+
+// republish sends the cached configs of the available entities again. The entities of
+// missing fields were cleared by the first publish and stay cleared.
+func (h *homeassistantPublisher) republish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conf := h.publisher.conf
+	for _, state := range h.devices {
+		userProperties := h.publisher.userProperties(state.measurement)
+		attributes := make([]string, 0, len(state.configs))
+		for attribute := range state.configs {
+			attributes = append(attributes, attribute)
+		}
+		sort.Strings(attributes)
+		for _, attribute := range attributes {
+			_, confTopicPrefix := homeassistantEntityTopic(conf, state.measurement.Mac, attribute)
+			h.publisher.publish(mqttMessage{
+				Topic:          confTopicPrefix + "/attributes",
+				Retain:         conf.RetainMessages,
+				Payload:        []byte(state.attributes),
+				ContentType:    "application/json",
+				UserProperties: userProperties,
+			})
+			h.publisher.publish(mqttMessage{
+				Topic:          confTopicPrefix + "/config",
+				Retain:         conf.RetainMessages,
+				Payload:        []byte(state.configs[attribute]),
+				ContentType:    "application/json",
+				UserProperties: userProperties,
+			})
+		}
+	}
+}
+
+// homeassistantEntityTopic returns the unique ID and the discovery topic prefix of an entity
+func homeassistantEntityTopic(conf config.MQTTPublisher, mac string, attribute string) (string, string) {
+	id := fmt.Sprintf("ruuvitag_%s_%s", strings.ReplaceAll(mac, ":", ""), attribute)
+	return id, fmt.Sprintf("%s/sensor/%s", conf.HomeassistantDiscoveryPrefix, id)
+}
+
+func (h *homeassistantPublisher) publish(measurement parser.Measurement, stateTopic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.devices[measurement.Mac] = h.publishDevice(measurement, stateTopic, h.devices[measurement.Mac])
+}
+
+// publishDevice publishes the discovery data which differs from the previous state.
+// Without a previous state everything is published, and entities for missing fields are cleared.
+// This is the only place where entities are cleared.
+func (h *homeassistantPublisher) publishDevice(measurement parser.Measurement, stateTopic string, previous *homeassistantDeviceState) *homeassistantDeviceState {
+	conf := h.publisher.conf
+	state := &homeassistantDeviceState{
+		measurement: measurement,
+		stateTopic:  stateTopic,
+		configs:     make(map[string]string),
+	}
+	attributesJson, err := json.Marshal(homeassistantDiscoveryAttributes{
+		Mac:                   measurement.Mac,
+		DataFormat:            fmt.Sprintf("%X", measurement.DataFormat),
+		CalibrationInProgress: measurement.CalibrationInProgress,
+		ButtonPressedOnBoot:   measurement.ButtonPressedOnBoot,
+		RtcOnBoot:             measurement.RtcOnBoot,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to serialize Home Assistant attribute data")
+		return previous
+	}
+	state.attributes = string(attributesJson)
+	attributesChanged := previous == nil || previous.attributes != state.attributes
+	userProperties := h.publisher.userProperties(measurement)
+
+	for _, disco := range homeassistantDiscoveryConfigs(measurement) {
+		id, confTopicPrefix := homeassistantEntityTopic(conf, measurement.Mac, disco.JsonAttribute)
+		if !disco.Available {
+			wasAvailable := false
+			if previous != nil {
+				_, wasAvailable = previous.configs[disco.JsonAttribute]
+			}
+			if previous == nil || wasAvailable {
+				h.publisher.publish(mqttMessage{Topic: confTopicPrefix + "/config", Retain: conf.RetainMessages})
+				h.publisher.publish(mqttMessage{Topic: confTopicPrefix + "/attributes", Retain: conf.RetainMessages})
+			}
+			continue
+		}
+		discoveryJson, err := homeassistantEntityConfig(conf, measurement, stateTopic, id, confTopicPrefix, disco)
+		if err != nil {
+			log.WithError(err).Error("Failed to serialize Home Assistant discovery data")
+			continue
+		}
+		state.configs[disco.JsonAttribute] = string(discoveryJson)
+		configChanged := previous == nil || previous.configs[disco.JsonAttribute] != string(discoveryJson)
+		if attributesChanged || configChanged {
+			h.publisher.publish(mqttMessage{
+				Topic:          confTopicPrefix + "/attributes",
+				Retain:         conf.RetainMessages,
+				Payload:        attributesJson,
+				ContentType:    "application/json",
+				UserProperties: userProperties,
+			})
+		}
+		if configChanged {
+			h.publisher.publish(mqttMessage{
+				Topic:          confTopicPrefix + "/config",
+				Retain:         conf.RetainMessages,
+				Payload:        discoveryJson,
+				ContentType:    "application/json",
+				UserProperties: userProperties,
+			})
+		}
+	}
+	return state
+}
+
+func homeassistantModel(measurement parser.Measurement) string {
+	if measurement.DataFormat == 0xE1 || measurement.DataFormat == 6 {
+		return "Ruuvi Air"
+	}
+	return "RuuviTag"
+}
+
+func homeassistantEntityConfig(conf config.MQTTPublisher, measurement parser.Measurement, stateTopic string, id string, confTopicPrefix string, disco homeassistantDiscoveryConfig) ([]byte, error) {
 	var name string
 	if measurement.Name != nil {
 		name = *measurement.Name
@@ -308,10 +461,16 @@ func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher
 	if stateClass == "" {
 		stateClass = "measurement"
 	}
-	discoveryJson, err := json.Marshal(homeassistantDiscovery{
+	// The same payloads as published to lwt_topic, including the defaults
+	var available, notAvailable string
+	if conf.LWTTopic != "" {
+		available = lwtOnlinePayload(conf)
+		notAvailable = lwtOfflinePayload(conf)
+	}
+	return json.Marshal(homeassistantDiscovery{
 		UniqueID:            id,
 		DeviceClass:         disco.DeviceClass,
-		StateTopic:          conf.TopicPrefix + "/" + measurement.Mac,
+		StateTopic:          stateTopic,
 		StateClass:          stateClass,
 		JsonAttributesTopic: confTopicPrefix + "/attributes",
 		Name:                disco.EntityName,
@@ -319,31 +478,14 @@ func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher
 		ValueTemplate:       fmt.Sprintf("{{ (value_json.%s%s) | round(2) }}", disco.JsonAttribute, disco.JsonAttributeMutator),
 		Icon:                disco.Icon,
 		AvailabilityTopic:   conf.LWTTopic,
-		PayloadAvailable:    conf.LWTOnlinePayload,
-		PayloadNotAvailable: conf.LWTOfflinePayload,
+		PayloadAvailable:    available,
+		PayloadNotAvailable: notAvailable,
 		EntityCategory:      disco.EntityCategory,
 		Device: homeassistantDiscoveryDevice{
 			Identifiers:  []string{measurement.Mac},
 			Name:         name,
-			Model:        "RuuviTag",
+			Model:        homeassistantModel(measurement),
 			Manufacturer: "Ruuvi",
 		},
 	})
-	if err != nil {
-		log.WithError(err).Error("Failed to serialize Home Assistant discovery data")
-		return
-	}
-	attributesJson, err := json.Marshal(homeassistantDiscoveryAttributes{
-		Mac:                   measurement.Mac,
-		DataFormat:            fmt.Sprintf("%X", measurement.DataFormat),
-		CalibrationInProgress: measurement.CalibrationInProgress,
-		ButtonPressedOnBoot:   measurement.ButtonPressedOnBoot,
-		RtcOnBoot:             measurement.RtcOnBoot,
-	})
-	if err != nil {
-		log.WithError(err).Error("Failed to serialize Home Assistant attribute data")
-		return
-	}
-	client.Publish(confTopicPrefix+"/attributes", 0, conf.RetainMessages, string(attributesJson))
-	client.Publish(confTopicPrefix+"/config", 0, conf.RetainMessages, string(discoveryJson))
 }
@@ -0,0 +1,124 @@
+package data_sinks
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+func countTopics(client *fakeMQTTClient, from int, suffix string) int {
+	count := 0
+	for _, msg := range client.messages[from:] {
+		if strings.HasSuffix(msg.Topic, suffix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestHomeassistant_PublishesOnlyChanges(t *testing.T) {
+	publisher, client := newTestPublisher(config.MQTTPublisher{HomeassistantDiscoveryPrefix: "homeassistant"})
+	homeassistant := newHomeassistantPublisher(publisher)
+
+	m := testMeasurement()
+	homeassistant.publish(m, "ruuvi/AA:BB:CC:DD:EE:FF")
+	entities := len(homeassistantDiscoveryConfigs(m))
+	// temperature, humidity and rssi are available, everything else is cleared once
+	if published := len(client.messages); published != entities*2 {
+		t.Errorf("first publish: got %d messages want %d", published, entities*2)
+	}
+	topics := client.retained()
+	if topics["homeassistant/sensor/ruuvitag_AABBCCDDEEFF_temperature/config"] == "" {
+		t.Errorf("temperature config not published")
+	}
+	if _, ok := topics["homeassistant/sensor/ruuvitag_AABBCCDDEEFF_pm2p5/config"]; !ok {
+		t.Errorf("missing pm2p5 entity was not cleared")
+	}
+
+	count := len(client.messages)
+	homeassistant.publish(m, "ruuvi/AA:BB:CC:DD:EE:FF")
+	if published := len(client.messages) - count; published != 0 {
+		t.Errorf("unchanged measurement: got %d messages want 0", published)
+	}
+
+	// Renaming the tag republishes the configs of the available entities
+	count = len(client.messages)
+	name := "Sauna"
+	m.Name = &name
+	homeassistant.publish(m, "ruuvi/AA:BB:CC:DD:EE:FF")
+	if published := countTopics(client, count, "/config"); published != 3 {
+		t.Errorf("renamed tag: got %d config messages want 3", published)
+	}
+
+	// A removed field clears only that entity
+	count = len(client.messages)
+	m.Humidity = nil
+	homeassistant.publish(m, "ruuvi/AA:BB:CC:DD:EE:FF")
+	if published := len(client.messages) - count; published != 2 {
+		t.Errorf("removed field: got %d messages want 2", published)
+	}
+	if topics := client.retained(); topics["homeassistant/sensor/ruuvitag_AABBCCDDEEFF_humidity/config"] != "" {
+		t.Errorf("humidity entity was not cleared")
+	}
+
+	// The birth message republishes the configs of the available entities, without clearing the others
+	count = len(client.messages)
+	homeassistant.republish()
+	if published := countTopics(client, count, "/config"); published != 2 {
+		t.Errorf("republish: got %d config messages want 2", published)
+	}
+	for _, msg := range client.messages[count:] {
+		if len(msg.Payload) == 0 {
+			t.Errorf("republish cleared %s", msg.Topic)
+		}
+	}
+	if topics := client.retained(); topics["homeassistant/sensor/ruuvitag_AABBCCDDEEFF_temperature/config"] == "" {
+		t.Errorf("temperature config was not republished")
+	}
+}
+
+func TestHomeassistant_AvailabilityWithHomie(t *testing.T) {
+	conf := config.MQTTPublisher{
+		HomeassistantDiscoveryPrefix: "homeassistant",
+		HomieBaseTopic:               "homie",
+		LWTTopic:                     "ruuvi/gateway/status",
+	}
+	publisher, client := newTestPublisher(conf)
+	homie := newHomiePublisher(&mqttPublisher{conf: conf, stats: publisher.stats})
+	homieClient := &fakeMQTTClient{}
+	wills := make(map[string]*mqttMessage)
+	connectMQTT(conf, "ruuvi", publisher, homie, func(clientID string, will *mqttMessage, onConnect func(mqttClient)) mqttClient {
+		wills[clientID] = will
+		c := client
+		if clientID != "ruuvi" {
+			c = homieClient
+		}
+		onConnect(c)
+		return c
+	})
+
+	// The sink connection keeps the lwt_topic will, Homie has its own connection for $state
+	if will := wills["ruuvi"]; will == nil || will.Topic != conf.LWTTopic || string(will.Payload) != `{"state":"offline"}` {
+		t.Errorf("sink will: %+v", will)
+	}
+	if will := wills["ruuvi-homie"]; will == nil || will.Topic != "homie/ruuvi-gateway/$state" || string(will.Payload) != "lost" {
+		t.Errorf("Homie will: %+v", will)
+	}
+	if got := client.retained()[conf.LWTTopic]; got != `{"state":"online"}` {
+		t.Errorf("online payload: got %q", got)
+	}
+	if got := homieClient.retained()["homie/ruuvi-gateway/$state"]; got != "ready" {
+		t.Errorf("Homie $state: got %q", got)
+	}
+
+	newHomeassistantPublisher(publisher).publish(testMeasurement(), "ruuvi/AA:BB:CC:DD:EE:FF")
+	var discovery homeassistantDiscovery
+	if err := json.Unmarshal([]byte(client.retained()["homeassistant/sensor/ruuvitag_AABBCCDDEEFF_temperature/config"]), &discovery); err != nil {
+		t.Fatal(err)
+	}
+	if discovery.AvailabilityTopic != conf.LWTTopic || discovery.PayloadAvailable != `{"state":"online"}` || discovery.PayloadNotAvailable != `{"state":"offline"}` {
+		t.Errorf("availability: %q %q %q", discovery.AvailabilityTopic, discovery.PayloadAvailable, discovery.PayloadNotAvailable)
+	}
+}
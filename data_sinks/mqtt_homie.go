@@ -0,0 +1,249 @@
+package data_sinks
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+// Homie 4.0 convention, see https://homieiot.github.io/specification/spec-core-v4_0_0/
+//
+// The gateway is published as a single Homie device so that its $state can be set
+// to "lost" with the MQTT last will. The device has a connection of its own, the
+// last will of the sink connection is the lwt_topic offline payload. Every tag is a node of the device and every
+// measurement field present on the tag is a property of the node.
+
+type homieProperty struct {
+	Name string
+	Unit string
+}
+
+var homieProperties = map[string]homieProperty{
+	"temperature":               {"Temperature", "°C"},
+	"humidity":                  {"Humidity", "%"},
+	"pressure":                  {"Pressure", "Pa"},
+	"accelerationX":             {"Acceleration X", "g"},
+	"accelerationY":             {"Acceleration Y", "g"},
+	"accelerationZ":             {"Acceleration Z", "g"},
+	"batteryVoltage":            {"Battery voltage", "V"},
+	"txPower":                   {"TX power", "dBm"},
+	"rssi":                      {"RSSI", "dBm"},
+	"movementCounter":           {"Movement counter", "#"},
+	"measurementSequenceNumber": {"Measurement sequence number", "#"},
+	"accelerationTotal":         {"Total acceleration", "g"},
+	"absoluteHumidity":          {"Absolute humidity", "g/m³"},
+	"dewPoint":                  {"Dew point", "°C"},
+	"equilibriumVaporPressure":  {"Equilibrium vapor pressure", "Pa"},
+	"airDensity":                {"Air density", "kg/m³"},
+	"accelerationAngleFromX":    {"Acceleration angle from X axis", "°"},
+	"accelerationAngleFromY":    {"Acceleration angle from Y axis", "°"},
+	"accelerationAngleFromZ":    {"Acceleration angle from Z axis", "°"},
+	"pm1p0":                     {"PM1.0", "µg/m³"},
+	"pm2p5":                     {"PM2.5", "µg/m³"},
+	"pm4p0":                     {"PM4.0", "µg/m³"},
+	"pm10p0":                    {"PM10", "µg/m³"},
+	"co2":                       {"CO₂", "ppm"},
+	"voc":                       {"VOC index", "#"},
+	"nox":                       {"NOx index", "#"},
+	"illuminance":               {"Illuminance", "lx"},
+	"soundInstant":              {"Sound level (instant, A-weighted)", "dB"},
+	"soundAverage":              {"Sound level (average, A-weighted)", "dB"},
+	"soundPeak":                 {"Sound level (peak, A-weighted)", "dB"},
+	"airQualityIndex":           {"Air quality index", "%"},
+	"calibrationInProgress":     {"Calibration in progress", ""},
+	"buttonPressedOnBoot":       {"Button pressed on boot", ""},
+	"rtcOnBoot":                 {"RTC running on boot", ""},
+}
+
+type homieNode struct {
+	name       string
+	nodeType   string
+	properties []parser.Field
+}
+
+func (n homieNode) equal(other homieNode) bool {
+	if n.name != other.name || n.nodeType != other.nodeType || len(n.properties) != len(other.properties) {
+		return false
+	}
+	for i := range n.properties {
+		if n.properties[i].Name != other.properties[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+type homiePublisher struct {
+	publisher *mqttPublisher
+	base      string
+	name      string
+
+	mu    sync.Mutex
+	nodes map[string]homieNode
+}
+
+func newHomiePublisher(publisher *mqttPublisher) *homiePublisher {
+	deviceID := publisher.conf.HomieDeviceID
+	if deviceID == "" {
+		deviceID = "ruuvi-gateway"
+	}
+	name := publisher.conf.HomieName
+	if name == "" {
+		name = "Ruuvi Gateway"
+	}
+	h := &homiePublisher{
+		publisher: publisher,
+		base:      strings.TrimSuffix(publisher.conf.HomieBaseTopic, "/") + "/" + slugify(deviceID),
+		name:      name,
+		nodes:     make(map[string]homieNode),
+	}
+	log.WithField("topic", h.base).Info("Publishing Homie 4.0 device")
+	return h
+}
+
+// homieID converts a field name into a Homie topic ID, eg. "accelerationX" -> "acceleration-x"
+func homieID(name string) string {
+	return separateWords(name, '-')
+}
+
+// separateWords converts a camelCase name into lowercase words joined with sep
+func separateWords(name string, sep byte) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte(sep)
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func homieDatatype(f parser.Field) string {
+	switch f.Kind {
+	case parser.IntField:
+		return "integer"
+	case parser.BoolField:
+		return "boolean"
+	default:
+		return "float"
+	}
+}
+
+func (h *homiePublisher) will() *mqttMessage {
+	return &mqttMessage{Topic: h.base + "/$state", QoS: 1, Retain: true, Payload: []byte("lost")}
+}
+
+func (h *homiePublisher) attribute(send func(mqttMessage), topic string, value string) {
+	send(mqttMessage{Topic: h.base + "/" + topic, QoS: 1, Retain: true, Payload: []byte(value)})
+}
+
+// publishDevice publishes the device attributes and every known node, must be called with mu held
+func (h *homiePublisher) publishDevice(send func(mqttMessage)) {
+	h.attribute(send, "$state", "init")
+	h.attribute(send, "$homie", "4.0")
+	h.attribute(send, "$name", h.name)
+	h.attribute(send, "$extensions", "")
+	ids := make([]string, 0, len(h.nodes))
+	for id := range h.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		h.publishNode(send, id, h.nodes[id])
+	}
+	h.attribute(send, "$nodes", strings.Join(ids, ","))
+	h.attribute(send, "$state", "ready")
+}
+
+func (h *homiePublisher) publishNode(send func(mqttMessage), id string, node homieNode) {
+	propertyIDs := make([]string, 0, len(node.properties))
+	for _, f := range node.properties {
+		propertyID := homieID(f.Name)
+		propertyIDs = append(propertyIDs, propertyID)
+		prop := homieProperties[f.Name]
+		if prop.Name == "" {
+			prop.Name = f.Name
+		}
+		h.attribute(send, id+"/"+propertyID+"/$name", prop.Name)
+		h.attribute(send, id+"/"+propertyID+"/$datatype", homieDatatype(f))
+		if prop.Unit != "" {
+			h.attribute(send, id+"/"+propertyID+"/$unit", prop.Unit)
+		}
+	}
+	h.attribute(send, id+"/$name", node.name)
+	h.attribute(send, id+"/$type", node.nodeType)
+	h.attribute(send, id+"/$properties", strings.Join(propertyIDs, ","))
+}
+
+// removeProperties clears the retained topics of properties which are no longer present on a node
+func (h *homiePublisher) removeProperties(send func(mqttMessage), id string, old homieNode, node homieNode) {
+	for _, f := range old.properties {
+		present := false
+		for _, p := range node.properties {
+			if p.Name == f.Name {
+				present = true
+				break
+			}
+		}
+		if present {
+			continue
+		}
+		propertyID := homieID(f.Name)
+		for _, topic := range []string{"", "/$name", "/$datatype", "/$unit"} {
+			h.attribute(send, id+"/"+propertyID+topic, "")
+		}
+	}
+}
+
+func (h *homiePublisher) onConnect(client mqttClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishDevice(func(msg mqttMessage) { h.publisher.publishWith(client, msg) })
+}
+
+func (h *homiePublisher) publish(measurement parser.Measurement) {
+	id := strings.ToLower(strings.ReplaceAll(measurement.Mac, ":", ""))
+	node := homieNode{
+		name:     "RuuviTag " + measurement.Mac,
+		nodeType: "RuuviTag",
+	}
+	if measurement.Name != nil && *measurement.Name != "" {
+		node.name = *measurement.Name
+	}
+	if measurement.DataFormat == 0xE1 || measurement.DataFormat == 6 {
+		node.nodeType = "Ruuvi Air"
+	}
+	for _, f := range parser.Fields {
+		if f.Has(measurement) {
+			node.properties = append(node.properties, f)
+		}
+	}
+
+	h.mu.Lock()
+	old, known := h.nodes[id]
+	if !known || !old.equal(node) {
+		log.WithFields(log.Fields{
+			"mac":        measurement.Mac,
+			"properties": len(node.properties),
+		}).Debug("Publishing Homie node")
+		h.nodes[id] = node
+		h.publishDevice(h.publisher.publish)
+		if known {
+			h.removeProperties(h.publisher.publish, id, old, node)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, f := range node.properties {
+		value, _ := f.Format(measurement)
+		h.attribute(h.publisher.publish, id+"/"+homieID(f.Name), value)
+	}
+}
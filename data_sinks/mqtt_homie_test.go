@@ -0,0 +1,83 @@
+package data_sinks
+
+import (
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+func TestHomie_PublishesDeviceAndNode(t *testing.T) {
+	publisher, client := newTestPublisher(config.MQTTPublisher{HomieBaseTopic: "homie"})
+	homie := newHomiePublisher(publisher)
+
+	if will := homie.will(); will.Topic != "homie/ruuvi-gateway/$state" || string(will.Payload) != "lost" {
+		t.Errorf("will: got %s=%s", will.Topic, will.Payload)
+	}
+
+	homie.publish(testMeasurement())
+	topics := client.retained()
+	expected := map[string]string{
+		"homie/ruuvi-gateway/$homie":                             "4.0",
+		"homie/ruuvi-gateway/$state":                             "ready",
+		"homie/ruuvi-gateway/$nodes":                             "aabbccddeeff",
+		"homie/ruuvi-gateway/aabbccddeeff/$name":                 "Living Room",
+		"homie/ruuvi-gateway/aabbccddeeff/$properties":           "temperature,humidity,rssi",
+		"homie/ruuvi-gateway/aabbccddeeff/temperature/$datatype": "float",
+		"homie/ruuvi-gateway/aabbccddeeff/temperature/$unit":     "°C",
+		"homie/ruuvi-gateway/aabbccddeeff/temperature":           "21.5",
+		"homie/ruuvi-gateway/aabbccddeeff/rssi/$datatype":        "integer",
+		"homie/ruuvi-gateway/aabbccddeeff/rssi":                  "-70",
+		"homie/ruuvi-gateway/aabbccddeeff/humidity/$unit":        "%",
+		"homie/ruuvi-gateway/aabbccddeeff/humidity":              "45.25",
+		"homie/ruuvi-gateway/aabbccddeeff/temperature/$name":     "Temperature",
+		"homie/ruuvi-gateway/aabbccddeeff/humidity/$datatype":    "float",
+		"homie/ruuvi-gateway/aabbccddeeff/$type":                 "RuuviTag",
+		"homie/ruuvi-gateway/$name":                              "Ruuvi Gateway",
+		"homie/ruuvi-gateway/aabbccddeeff/rssi/$unit":            "dBm",
+		"homie/ruuvi-gateway/aabbccddeeff/rssi/$name":            "RSSI",
+		"homie/ruuvi-gateway/aabbccddeeff/humidity/$name":        "Humidity",
+		"homie/ruuvi-gateway/$extensions":                        "",
+	}
+	for topic, want := range expected {
+		if got, ok := topics[topic]; !ok || got != want {
+			t.Errorf("%s: got %q want %q", topic, got, want)
+		}
+	}
+	for _, msg := range client.messages {
+		if msg.QoS != 1 || !msg.Retain {
+			t.Errorf("%s: expected retained QoS 1 message", msg.Topic)
+		}
+	}
+
+	// Structure is only republished when the fields change
+	count := len(client.messages)
+	homie.publish(testMeasurement())
+	if published := len(client.messages) - count; published != 3 {
+		t.Errorf("unchanged node: got %d messages want 3", published)
+	}
+
+	m := testMeasurement()
+	m.Humidity = nil
+	homie.publish(m)
+	topics = client.retained()
+	if topics["homie/ruuvi-gateway/aabbccddeeff/$properties"] != "temperature,rssi" {
+		t.Errorf("$properties: got %q", topics["homie/ruuvi-gateway/aabbccddeeff/$properties"])
+	}
+	if topics["homie/ruuvi-gateway/aabbccddeeff/humidity"] != "" {
+		t.Errorf("removed property value should have been cleared")
+	}
+}
+
+func TestHomieID(t *testing.T) {
+	cases := map[string]string{
+		"temperature":               "temperature",
+		"accelerationX":             "acceleration-x",
+		"measurementSequenceNumber": "measurement-sequence-number",
+		"pm2p5":                     "pm2p5",
+	}
+	for in, want := range cases {
+		if got := homieID(in); got != want {
+			t.Errorf("homieID(%q): got %q want %q", in, got, want)
+		}
+	}
+}
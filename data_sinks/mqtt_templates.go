@@ -0,0 +1,217 @@
+package data_sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMQTTTopicTemplate        = "{{.Prefix}}/{{.Mac}}"
+	defaultMQTTFieldTopicTemplate   = "{{.Prefix}}/{{.Mac}}/{{.Field}}"
+	defaultMQTTFieldPayloadTemplate = "{{.Value}}"
+)
+
+// mqttTemplateData is the data available to the topic and payload templates
+type mqttTemplateData struct {
+	Prefix     string
+	Mac        string
+	Name       string // Configured or advertised name, or the MAC if the tag has no name
+	Slug       string // Name converted to lowercase letters, digits and dashes
+	DataFormat string
+	// Field and Value are only set for per-field (publish_raw) messages
+	Field       string
+	Value       string
+	Values      map[string]interface{}
+	Measurement parser.Measurement
+}
+
+var mqttTemplateFuncs = template.FuncMap{
+	"slug":     slugify,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"nocolons": func(s string) string { return strings.ReplaceAll(s, ":", "") },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// Fallback for values the measurement may lack, eg. {{index .Values "co2" | default "null"}}
+	"default": func(fallback interface{}, v interface{}) interface{} {
+		if v == nil {
+			return fallback
+		}
+		return v
+	},
+}
+
+var slugReplacer = strings.NewReplacer("ä", "a", "å", "a", "ö", "o", "ü", "u", "ß", "ss", "é", "e", "è", "e")
+
+// slugify converts a tag name into a topic friendly form, eg. "Living Room" -> "living-room"
+func slugify(s string) string {
+	s = slugReplacer.Replace(strings.ToLower(s))
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// mqttTemplates renders the topics and payloads of the MQTT sink
+type mqttTemplates struct {
+	prefix       string
+	topic        *template.Template
+	fieldTopic   *template.Template
+	payload      *template.Template // nil publishes the measurement as JSON
+	fieldPayload *template.Template
+}
+
+func parseMQTTTemplate(name string, text string, fallback string) *template.Template {
+	if text == "" {
+		text = fallback
+	}
+	// A value missing from .Values fails the rendering instead of producing "<no value>"
+	newTemplate := func() *template.Template {
+		return template.New(name).Funcs(mqttTemplateFuncs).Option("missingkey=error")
+	}
+	tmpl, err := newTemplate().Parse(text)
+	if err != nil {
+		log.WithError(err).WithField("template", name).Error("Invalid MQTT template, using the default")
+		if fallback == "" {
+			return nil
+		}
+		return template.Must(newTemplate().Parse(fallback))
+	}
+	return tmpl
+}
+
+func newMQTTTemplates(conf config.MQTTPublisher) *mqttTemplates {
+	t := &mqttTemplates{
+		prefix:       conf.TopicPrefix,
+		topic:        parseMQTTTemplate("topic_template", conf.TopicTemplate, defaultMQTTTopicTemplate),
+		fieldTopic:   parseMQTTTemplate("field_topic_template", conf.FieldTopicTemplate, defaultMQTTFieldTopicTemplate),
+		fieldPayload: parseMQTTTemplate("field_payload_template", conf.FieldPayloadTemplate, defaultMQTTFieldPayloadTemplate),
+	}
+	if conf.PayloadTemplate != "" {
+		t.payload = parseMQTTTemplate("payload_template", conf.PayloadTemplate, "")
+	}
+	return t
+}
+
+func (t *mqttTemplates) data(m parser.Measurement) mqttTemplateData {
+	name := m.Mac
+	if m.Name != nil && *m.Name != "" {
+		name = *m.Name
+	}
+	values := make(map[string]interface{})
+	for _, f := range parser.Fields {
+		if v, ok := f.Value(m); ok {
+			values[f.Name] = v
+		}
+	}
+	return mqttTemplateData{
+		Prefix:      t.prefix,
+		Mac:         m.Mac,
+		Name:        name,
+		Slug:        slugify(name),
+		DataFormat:  fmt.Sprintf("%X", m.DataFormat),
+		Values:      values,
+		Measurement: m,
+	}
+}
+
+func renderMQTTTemplate(tmpl *template.Template, data mqttTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// sanitizeMQTTTopic strips the characters which are not allowed in MQTT topic names
+func sanitizeMQTTTopic(topic string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '+' || r == '#' || r == 0 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(topic))
+}
+
+// renderMQTTTopic renders and sanitizes a topic, failing when the topic is empty
+func renderMQTTTopic(tmpl *template.Template, data mqttTemplateData) (string, error) {
+	topic, err := renderMQTTTemplate(tmpl, data)
+	if err != nil {
+		return "", err
+	}
+	topic = sanitizeMQTTTopic(topic)
+	if topic == "" {
+		return "", fmt.Errorf("template %s rendered an empty topic", tmpl.Name())
+	}
+	return topic, nil
+}
+
+// Topic renders the topic of the full measurement message
+func (t *mqttTemplates) Topic(m parser.Measurement) (string, error) {
+	return renderMQTTTopic(t.topic, t.data(m))
+}
+
+// Payload renders the full measurement message, by default the measurement as JSON
+func (t *mqttTemplates) Payload(m parser.Measurement) ([]byte, error) {
+	if t.payload == nil {
+		return json.Marshal(m)
+	}
+	payload, err := renderMQTTTemplate(t.payload, t.data(m))
+	return []byte(payload), err
+}
+
+type mqttFieldMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// FieldMessages renders the topic and payload of each present field for publish_raw, aggregated
+// measurements add <field>_min, <field>_max and <field>_count, and smoothed measurements <field>_raw
+// with the unfiltered values. The fields which fail to render are skipped, the first error is
+// returned with the other messages.
+func (t *mqttTemplates) FieldMessages(m parser.Measurement) ([]mqttFieldMessage, error) {
+	data := t.data(m)
+	var messages []mqttFieldMessage
+	var firstErr error
+	for _, c := range fieldColumns(len(m.Aggregates) > 0, rawFields(m)) {
+		value, ok := c.format(m)
+		if !ok {
+			continue
+		}
+		data.Field = c.fieldName()
+		data.Value = value
+		topic, err := renderMQTTTopic(t.fieldTopic, data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		payload, err := renderMQTTTemplate(t.fieldPayload, data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		messages = append(messages, mqttFieldMessage{Topic: topic, Payload: []byte(payload)})
+	}
+	return messages, firstErr
+}
@@ -0,0 +1,120 @@
+package data_sinks
+
+import (
+	"io"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+func testMeasurement() parser.Measurement {
+	name := "Living Room"
+	temperature := 21.5
+	humidity := 45.25
+	rssi := int64(-70)
+	m := parser.Measurement{}
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.Name = &name
+	m.DataFormat = 5
+	m.Temperature = &temperature
+	m.Humidity = &humidity
+	m.Rssi = &rssi
+	return m
+}
+
+func TestMQTTTemplates_Defaults(t *testing.T) {
+	templates := newMQTTTemplates(config.MQTTPublisher{TopicPrefix: "ruuvi"})
+	m := testMeasurement()
+
+	topic, err := templates.Topic(m)
+	if err != nil || topic != "ruuvi/AA:BB:CC:DD:EE:FF" {
+		t.Errorf("Topic: got %q (%v) want %q", topic, err, "ruuvi/AA:BB:CC:DD:EE:FF")
+	}
+	messages, err := templates.FieldMessages(m)
+	if err != nil {
+		t.Fatalf("FieldMessages returned error: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("FieldMessages: got %d messages want 3", len(messages))
+	}
+	if messages[0].Topic != "ruuvi/AA:BB:CC:DD:EE:FF/temperature" || string(messages[0].Payload) != "21.5" {
+		t.Errorf("FieldMessages[0]: got %s=%s", messages[0].Topic, messages[0].Payload)
+	}
+}
+
+func TestMQTTTemplates_Custom(t *testing.T) {
+	templates := newMQTTTemplates(config.MQTTPublisher{
+		TopicTemplate:        "home/{{.Slug}}/state",
+		PayloadTemplate:      `{"t":{{.Values.temperature}},"mac":"{{.Mac | nocolons}}"}`,
+		FieldTopicTemplate:   "home/{{.Slug}}/{{.Field}}",
+		FieldPayloadTemplate: `{"idx":1,"svalue":"{{.Value}}"}`,
+	})
+	// mqtt_publisher.fields is loaded as filter.fields, the fields are removed before the sink
+	m, _ := NewFilter(&config.SinkFilter{Fields: []string{"temperature", "rssi"}}, nil).Apply(testMeasurement())
+
+	topic, _ := templates.Topic(m)
+	if topic != "home/living-room/state" {
+		t.Errorf("Topic: got %q want %q", topic, "home/living-room/state")
+	}
+	payload, err := templates.Payload(m)
+	if err != nil || string(payload) != `{"t":21.5,"mac":"AABBCCDDEEFF"}` {
+		t.Errorf("Payload: got %s (%v)", payload, err)
+	}
+	messages, _ := templates.FieldMessages(m)
+	if len(messages) != 2 {
+		t.Fatalf("FieldMessages: got %d messages want 2", len(messages))
+	}
+	if messages[1].Topic != "home/living-room/rssi" || string(messages[1].Payload) != `{"idx":1,"svalue":"-70"}` {
+		t.Errorf("FieldMessages[1]: got %s=%s", messages[1].Topic, messages[1].Payload)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Living Room":       "living-room",
+		"Sauna  (Löyly)":    "sauna-loyly",
+		"AA:BB:CC:DD:EE:FF": "aa-bb-cc-dd-ee-ff",
+		"--Outdoor--":       "outdoor",
+	}
+	for in, want := range cases {
+		if got := slugify(in); got != want {
+			t.Errorf("slugify(%q): got %q want %q", in, got, want)
+		}
+	}
+}
+
+func TestMQTTTemplates_MissingValues(t *testing.T) {
+	templates := newMQTTTemplates(config.MQTTPublisher{
+		TopicTemplate:      "{{.Values.co2}}",
+		PayloadTemplate:    `{"co2":{{.Values.co2}}}`,
+		FieldTopicTemplate: `{{if eq .Field "rssi"}}{{else}}ruuvi/{{.Field}}{{end}}`,
+	})
+	m := testMeasurement()
+
+	if topic, err := templates.Topic(m); err == nil {
+		t.Errorf("Topic: expected an error for a missing value, got %q", topic)
+	}
+	if payload, err := templates.Payload(m); err == nil {
+		t.Errorf("Payload: expected an error for a missing value, got %s", payload)
+	}
+	// The rssi topic is empty and skipped, the other fields are still published
+	messages, err := templates.FieldMessages(m)
+	if err == nil || len(messages) != 2 {
+		t.Errorf("FieldMessages: got %d messages (%v) want 2 and an error", len(messages), err)
+	}
+
+	templates = newMQTTTemplates(config.MQTTPublisher{
+		PayloadTemplate: `{"t":{{index .Values "temperature" | default "null"}},"co2":{{index .Values "co2" | default "null"}}}`,
+	})
+	payload, err := templates.Payload(m)
+	if err != nil || string(payload) != `{"t":21.5,"co2":null}` {
+		t.Errorf("Payload: got %s (%v)", payload, err)
+	}
+
+	// The default used for an invalid template fails on missing values too
+	tmpl := parseMQTTTemplate("test", "{{", "{{.Values.co2}}")
+	if err := tmpl.Execute(io.Discard, map[string]interface{}{"Values": map[string]interface{}{}}); err == nil {
+		t.Error("fallback: expected an error for a missing value")
+	}
+}
@@ -0,0 +1,216 @@
+package data_sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultNATSSubjectTemplate = "ruuvi.{{.Mac | nocolons}}"
+
+// sanitizeNATSSubject replaces whitespace and wildcards which are not allowed in published subjects
+func sanitizeNATSSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '*' || r == '>' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(subject))
+	return strings.Trim(subject, ".")
+}
+
+type natsSink struct {
+	conn      *nats.Conn
+	js        jetstream.JetStream
+	jetstream bool
+	stream    *jetstream.StreamConfig
+	timeout   time.Duration
+	subjects  subjectTemplate
+}
+
+func natsOptions(conf config.NATSPublisher) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name("ruuvi-go-gateway"),
+		// Keep trying when the server is unreachable on startup and reconnect forever
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.WithError(err).Warn("Disconnected from NATS")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.WithField("server", nc.ConnectedUrlRedacted()).Info("Reconnected to NATS")
+		}),
+	}
+	if conf.Username != "" {
+		opts = append(opts, nats.UserInfo(conf.Username, conf.Password))
+	}
+	if conf.Token != "" {
+		opts = append(opts, nats.Token(conf.Token))
+	}
+	if conf.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(conf.CredentialsFile))
+	}
+	tlsConf, err := newTLSConfig(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		opts = append(opts, nats.Secure(tlsConf))
+	}
+	return opts, nil
+}
+
+func newNATSSink(conf config.NATSPublisher) (*natsSink, error) {
+	s := &natsSink{
+		timeout:  time.Duration(conf.Timeout),
+		subjects: newSubjectTemplate("subject_template", conf.SubjectTemplate, defaultNATSSubjectTemplate, sanitizeNATSSubject),
+	}
+	if s.timeout == 0 {
+		s.timeout = 10 * time.Second
+	}
+	switch strings.ToLower(conf.Acks) {
+	case "", "jetstream":
+		s.jetstream = true
+	case "none":
+	default:
+		return nil, fmt.Errorf("invalid acks %q, expected jetstream or none", conf.Acks)
+	}
+	if conf.Stream != "" {
+		subjects := conf.StreamSubjects
+		if len(subjects) == 0 {
+			subjects = []string{"ruuvi.>"}
+		}
+		s.stream = &jetstream.StreamConfig{
+			Name:     conf.Stream,
+			Subjects: subjects,
+			MaxAge:   time.Duration(conf.StreamMaxAge),
+		}
+	}
+
+	opts, err := natsOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := conf.Url
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	s.conn, err = nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.js, err = jetstream.New(s.conn)
+	if err != nil {
+		s.conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureStream creates or updates the configured stream, it is retried until it succeeds
+// because the server may not be reachable on startup
+func (s *natsSink) ensureStream(ctx context.Context) error {
+	if s.stream == nil {
+		return nil
+	}
+	if _, err := s.js.CreateOrUpdateStream(ctx, *s.stream); err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", s.stream.Name, err)
+	}
+	log.WithField("stream", s.stream.Name).Info("NATS stream ready")
+	s.stream = nil
+	return nil
+}
+
+// natsMessage returns the measurement as JSON on its subject
+func (s *natsSink) natsMessage(m parser.Measurement) (*nats.Msg, error) {
+	subject, err := s.subjects.render(m)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("Content-Type", "application/json")
+	msg.Header.Set("Ruuvi-Mac", m.Mac)
+	if m.MeasurementSequenceNumber != nil {
+		// The same advertisement received by several gateways is stored once within the stream duplicate window
+		msg.Header.Set(jetstream.MsgIDHeader, fmt.Sprintf("%s-%d", m.Mac, *m.MeasurementSequenceNumber))
+	}
+	return msg, nil
+}
+
+func (s *natsSink) publish(m parser.Measurement) error {
+	msg, err := s.natsMessage(m)
+	if err != nil {
+		return err
+	}
+	if !s.jetstream {
+		return s.conn.PublishMsg(msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.ensureStream(ctx); err != nil {
+		return err
+	}
+	ack, err := s.js.PublishMsg(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if ack.Duplicate {
+		log.WithFields(log.Fields{"subject": msg.Subject, "stream": ack.Stream}).Trace("Duplicate measurement ignored by NATS")
+	}
+	return nil
+}
+
+func NATS(conf config.NATSPublisher) chan<- parser.Measurement {
+	log.WithFields(log.Fields{
+		"url":              conf.Url,
+		"subject_template": conf.SubjectTemplate,
+		"acks":             conf.Acks,
+		"stream":           conf.Stream,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting NATS sink")
+
+	sink, err := newNATSSink(conf)
+	if err != nil {
+		log.WithError(err).Error("Failed to create NATS sink")
+	}
+
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
+	measurements := make(chan parser.Measurement, 1024)
+	go func() {
+		for measurement := range measurements {
+			if sink == nil {
+				continue
+			}
+			if !limiter.Check(measurement) {
+				log.WithField("mac", measurement.Mac).Trace("Skipping NATS publish due to interval limit")
+				continue
+			}
+			if err := sink.publish(measurement); err != nil {
+				log.WithError(err).WithField("mac", measurement.Mac).Error("Failed to publish to NATS")
+			}
+		}
+		if sink != nil {
+			if err := sink.conn.Drain(); err != nil {
+				sink.conn.Close()
+			}
+		}
+	}()
+	return measurements
+}
@@ -0,0 +1,95 @@
+package data_sinks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+)
+
+func TestSanitizeNATSSubject(t *testing.T) {
+	if got := sanitizeNATSSubject(" ruuvi.Living Room.*.> "); got != "ruuvi.Living_Room._._" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestNATS_JetStream(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	sink, err := newNATSSink(config.NATSPublisher{Url: server.ClientURL(), Stream: "RUUVI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.conn.Close()
+
+	// The second publish of the same sequence number is deduplicated by the stream
+	m := testMeasurement()
+	sequence := int64(42)
+	m.MeasurementSequenceNumber = &sequence
+	for i := 0; i < 2; i++ {
+		if err := sink.publish(m); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := sink.js.Stream(ctx, "RUUVI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("got %d messages want 1", info.State.Msgs)
+	}
+	msg, err := stream.GetLastMsgForSubject(ctx, "ruuvi.AABBCCDDEEFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received parser.Measurement
+	if err := json.Unmarshal(msg.Data, &received); err != nil || received.Mac != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("got %s (%v)", msg.Data, err)
+	}
+	if msg.Header.Get("Ruuvi-Mac") != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("headers: got %v", msg.Header)
+	}
+}
+
+func TestNATS_Core(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	sink, err := newNATSSink(config.NATSPublisher{Url: server.ClientURL(), Acks: "none", SubjectTemplate: "ruuvi.{{.Slug}}.measurement"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.conn.Close()
+	sub, err := sink.conn.SubscribeSync("ruuvi.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.publish(testMeasurement()); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "ruuvi.living-room.measurement" {
+		t.Errorf("subject: got %s", msg.Subject)
+	}
+}
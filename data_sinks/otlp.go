@@ -0,0 +1,218 @@
+package data_sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/common/version"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func otlpTemporality(conf config.OTLP) (sdkmetric.TemporalitySelector, error) {
+	switch strings.ToLower(conf.Temporality) {
+	case "", "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return func(sdkmetric.InstrumentKind) metricdata.Temporality { return metricdata.DeltaTemporality }, nil
+	default:
+		return nil, fmt.Errorf("invalid temporality %q, expected cumulative or delta", conf.Temporality)
+	}
+}
+
+func newOTLPExporter(ctx context.Context, conf config.OTLP) (sdkmetric.Exporter, error) {
+	temporality, err := otlpTemporality(conf)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(conf.Timeout)
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	switch strings.ToLower(conf.Protocol) {
+	case "grpc":
+		endpoint := conf.Url
+		if endpoint == "" {
+			endpoint = "http://localhost:4317"
+		}
+		return otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpointURL(endpoint),
+			otlpmetricgrpc.WithHeaders(conf.Headers),
+			otlpmetricgrpc.WithTimeout(timeout),
+			otlpmetricgrpc.WithTemporalitySelector(temporality),
+		)
+	case "", "http", "http/protobuf":
+		endpoint := conf.Url
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP url: %w", err)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/metrics"
+		}
+		return otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpointURL(u.String()),
+			otlpmetrichttp.WithHeaders(conf.Headers),
+			otlpmetrichttp.WithTimeout(timeout),
+			otlpmetrichttp.WithTemporalitySelector(temporality),
+		)
+	default:
+		return nil, fmt.Errorf("invalid OTLP protocol %q, expected http or grpc", conf.Protocol)
+	}
+}
+
+func newOTLPResource(ctx context.Context, conf config.OTLP) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", "ruuvi-go-gateway"),
+		attribute.String("service.version", version.Version),
+	}
+	for key, value := range conf.ResourceAttributes {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	return resource.New(ctx, resource.WithHost(), resource.WithOS(), resource.WithAttributes(attrs...))
+}
+
+// registerOTLPInstruments creates an observable gauge for every measurement field and a counter
+// for the number of measurements. The latest values of every tag are reported on each collection.
+// Aggregated measurements also report the <metric>_min, <metric>_max and <metric>_count gauges,
+// and smoothed measurements the <metric>_raw gauges with the unfiltered values.
+func registerOTLPInstruments(meter metric.Meter, prefix string, values *tagValues) error {
+	measurements, err := meter.Float64ObservableCounter(prefix+".measurements", metric.WithDescription("Number of received measurements"))
+	if err != nil {
+		return err
+	}
+	gauges := make([]metric.Float64ObservableGauge, len(prometheusMetrics))
+	// Gauges of the aggregateStatistics of each metric
+	statistics := make([][]metric.Float64ObservableGauge, len(prometheusMetrics))
+	raw := make([]metric.Float64ObservableGauge, len(prometheusMetrics))
+	instruments := []metric.Observable{measurements}
+	for i, m := range prometheusMetrics {
+		gauges[i], err = meter.Float64ObservableGauge(prefix+"."+m.name, metric.WithDescription(m.help))
+		if err != nil {
+			return err
+		}
+		instruments = append(instruments, gauges[i])
+		if values.fields[i].Kind == parser.BoolField {
+			continue
+		}
+		raw[i], err = meter.Float64ObservableGauge(prefix+"."+m.name+"_raw", metric.WithDescription(m.help+", unfiltered"))
+		if err != nil {
+			return err
+		}
+		instruments = append(instruments, raw[i])
+		if !aggregatedField(values.fields[i]) {
+			continue
+		}
+		for _, s := range aggregateStatistics {
+			gauge, err := meter.Float64ObservableGauge(prefix+"."+m.name+"_"+s.suffix, metric.WithDescription(m.help+", "+s.suffix+" of the aggregation window"))
+			if err != nil {
+				return err
+			}
+			statistics[i] = append(statistics[i], gauge)
+			instruments = append(instruments, gauge)
+		}
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, tag := range values.snapshot() {
+			attrs := make([]attribute.KeyValue, 0, len(prometheusTagLabels))
+			for i, label := range prometheusTagLabels {
+				attrs = append(attrs, attribute.String(label, tag.Labels[i]))
+			}
+			opt := metric.WithAttributeSet(attribute.NewSet(attrs...))
+			o.ObserveFloat64(measurements, tag.Count, opt)
+			for i, v := range tag.Values {
+				o.ObserveFloat64(gauges[i], v, opt)
+			}
+			for i, v := range tag.Raw {
+				if raw[i] != nil {
+					o.ObserveFloat64(raw[i], v, opt)
+				}
+			}
+			for i, a := range tag.Aggregates {
+				for j, gauge := range statistics[i] {
+					o.ObserveFloat64(gauge, aggregateStatistics[j].value(a), opt)
+				}
+			}
+		}
+		return nil
+	}, instruments...)
+	return err
+}
+
+func newOTLPMeterProvider(ctx context.Context, conf config.OTLP, exporter sdkmetric.Exporter, values *tagValues) (*sdkmetric.MeterProvider, error) {
+	res, err := newOTLPResource(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(conf.ExportInterval)
+	if interval == 0 {
+		interval = time.Minute
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+	)
+	prefix := conf.MetricPrefix
+	if prefix == "" {
+		prefix = "ruuvi"
+	}
+	if err := registerOTLPInstruments(provider.Meter("github.com/Saavuori/ruuvi-go-gateway"), prefix, values); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func OTLP(conf config.OTLP) chan<- parser.Measurement {
+	log.WithFields(log.Fields{
+		"target":           conf.Url,
+		"protocol":         conf.Protocol,
+		"export_interval":  conf.ExportInterval,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting OTLP sink")
+
+	// Export failures are reported through the global error handler
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.WithError(err).Error("Failed to export OTLP metrics")
+	}))
+
+	ctx := context.Background()
+	values := newTagValues(time.Duration(conf.SeriesTTL))
+	exporter, err := newOTLPExporter(ctx, conf)
+	if err == nil {
+		_, err = newOTLPMeterProvider(ctx, conf, exporter, values)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to start OTLP sink")
+	}
+
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
+	measurements := make(chan parser.Measurement, 1024)
+	go func() {
+		for measurement := range measurements {
+			if !limiter.Check(measurement) {
+				log.WithField("mac", measurement.Mac).Trace("Skipping OTLP update due to interval limit")
+				continue
+			}
+			values.record(measurement)
+		}
+	}()
+	return measurements
+}
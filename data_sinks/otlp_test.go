@@ -0,0 +1,151 @@
+package data_sinks
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type otlpReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func (r *otlpReceiver) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	export := &collectormetrics.ExportMetricsServiceRequest{}
+	if req.URL.Path != "/v1/metrics" || proto.Unmarshal(body, export) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	r.Export(req.Context(), export)
+	resp, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func otlpAttributes(attrs []*commonpb.KeyValue) map[string]string {
+	result := make(map[string]string)
+	for _, kv := range attrs {
+		result[kv.Key] = kv.Value.GetStringValue()
+	}
+	return result
+}
+
+// exportOnce records a measurement and flushes it to the receiver
+func exportOnce(t *testing.T, conf config.OTLP, receiver *otlpReceiver) map[string]*metricspb.Metric {
+	t.Helper()
+	ctx := context.Background()
+	values := newTagValues(0)
+	values.record(testMeasurement())
+	exporter, err := newOTLPExporter(ctx, conf)
+	if err != nil {
+		t.Fatalf("newOTLPExporter: %v", err)
+	}
+	provider, err := newOTLPMeterProvider(ctx, conf, exporter, values)
+	if err != nil {
+		t.Fatalf("newOTLPMeterProvider: %v", err)
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	provider.Shutdown(ctx)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.requests) == 0 {
+		t.Fatalf("no export requests received")
+	}
+	rm := receiver.requests[0].ResourceMetrics[0]
+	resource := otlpAttributes(rm.Resource.Attributes)
+	if resource["service.name"] != "ruuvi-go-gateway" || resource["location"] != "home" {
+		t.Errorf("resource attributes: got %v", resource)
+	}
+	metrics := make(map[string]*metricspb.Metric)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	return metrics
+}
+
+func TestOTLP_HTTP(t *testing.T) {
+	receiver := &otlpReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	metrics := exportOnce(t, config.OTLP{
+		Url:                srv.URL,
+		Temporality:        "delta",
+		ResourceAttributes: map[string]string{"location": "home"},
+	}, receiver)
+
+	temperature := metrics["ruuvi.temperature"].GetGauge()
+	if temperature == nil || len(temperature.DataPoints) != 1 {
+		t.Fatalf("ruuvi.temperature: got %v", metrics["ruuvi.temperature"])
+	}
+	point := temperature.DataPoints[0]
+	attrs := otlpAttributes(point.Attributes)
+	if point.GetAsDouble() != 21.5 || attrs["mac"] != "AA:BB:CC:DD:EE:FF" || attrs["name"] != "Living Room" || attrs["data_format"] != "5" {
+		t.Errorf("ruuvi.temperature: got %v %v", point.GetAsDouble(), attrs)
+	}
+	if _, ok := metrics["ruuvi.pm2p5"]; ok {
+		t.Errorf("fields missing from the measurement should not be exported")
+	}
+	sum := metrics["ruuvi.measurements"].GetSum()
+	if sum == nil || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		t.Errorf("ruuvi.measurements: got %v", metrics["ruuvi.measurements"])
+	}
+}
+
+func TestOTLP_GRPC(t *testing.T) {
+	receiver := &otlpReceiver{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(srv, receiver)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	metrics := exportOnce(t, config.OTLP{
+		Protocol:           "grpc",
+		Url:                "http://" + lis.Addr().String(),
+		MetricPrefix:       "ruuvitag",
+		ResourceAttributes: map[string]string{"location": "home"},
+	}, receiver)
+	if metrics["ruuvitag.humidity"].GetGauge().GetDataPoints()[0].GetAsDouble() != 45.25 {
+		t.Errorf("ruuvitag.humidity: got %v", metrics["ruuvitag.humidity"])
+	}
+	if sum := metrics["ruuvitag.measurements"].GetSum(); sum == nil || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("ruuvitag.measurements: got %v", metrics["ruuvitag.measurements"])
+	}
+}
+
+func TestOTLP_InvalidConfig(t *testing.T) {
+	if _, err := newOTLPExporter(context.Background(), config.OTLP{Protocol: "udp"}); err == nil {
+		t.Errorf("expected an error for an invalid protocol")
+	}
+	if _, err := newOTLPExporter(context.Background(), config.OTLP{Temporality: "sometimes"}); err == nil {
+		t.Errorf("expected an error for an invalid temporality")
+	}
+}
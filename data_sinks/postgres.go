@@ -0,0 +1,274 @@
+package data_sinks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+type postgresColumn struct {
+	fieldColumn
+	name    string
+	sqlType string
+}
+
+// postgresColumns returns a column for every measurement field, eg. accelerationX -> acceleration_x.
+// With aggregated, the numeric fields also have the columns of their statistics, eg. temperature_min,
+// otherwise the raw fields have the columns of their unfiltered values, eg. rssi_raw.
+func postgresColumns(aggregated bool, raw []string) []postgresColumn {
+	var columns []postgresColumn
+	for _, c := range fieldColumns(aggregated, raw) {
+		sqlType := "double precision"
+		switch c.kind() {
+		case parser.IntField:
+			sqlType = "bigint"
+		case parser.BoolField:
+			sqlType = "boolean"
+		}
+		columns = append(columns, postgresColumn{fieldColumn: c, name: separateWords(c.field.Name, '_') + c.suffix(), sqlType: sqlType})
+	}
+	return columns
+}
+
+// postgresIdentifier splits an optionally schema qualified table name
+func postgresIdentifier(name string) pgx.Identifier {
+	return pgx.Identifier(strings.Split(name, "."))
+}
+
+type postgresSink struct {
+	narrow    bool
+	timescale bool
+	table     pgx.Identifier
+	tagsTable pgx.Identifier
+	columns   []postgresColumn
+	tagNames  map[string]string
+
+	pool  *pgxpool.Pool
+	ready bool
+}
+
+func newPostgresSink(conf config.PostgresPublisher, tagNames map[string]string, rawFields []string) (*postgresSink, error) {
+	table := conf.Table
+	if table == "" {
+		table = "ruuvi_measurements"
+	}
+	tagsTable := conf.TagsTable
+	if tagsTable == "" {
+		tagsTable = "tags"
+	}
+	var narrow bool
+	switch strings.ToLower(conf.Layout) {
+	case "", "wide":
+	case "narrow":
+		narrow = true
+	default:
+		return nil, fmt.Errorf("invalid layout %q, expected wide or narrow", conf.Layout)
+	}
+	// The pool connects lazily and reconnects after failures
+	pool, err := pgxpool.New(context.Background(), conf.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresSink{
+		narrow:    narrow,
+		timescale: conf.Timescale,
+		table:     postgresIdentifier(table),
+		tagsTable: postgresIdentifier(tagsTable),
+		columns:   postgresColumns(conf.AggregationWindow > 0, rawFields),
+		tagNames:  tagNames,
+		pool:      pool,
+	}, nil
+}
+
+func (s *postgresSink) schemaStatements() []string {
+	table := s.table.Sanitize()
+	var statements []string
+	if s.narrow {
+		statements = append(statements, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	time timestamptz NOT NULL,
+	mac text NOT NULL,
+	name text,
+	data_format integer,
+	field text NOT NULL,
+	value double precision
+)`, table))
+	} else {
+		definitions := []string{"time timestamptz NOT NULL", "mac text NOT NULL", "name text", "data_format integer"}
+		for _, c := range s.columns {
+			definitions = append(definitions, c.name+" "+c.sqlType)
+		}
+		statements = append(statements, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", table, strings.Join(definitions, ",\n\t")))
+		// Columns of fields added after the table was created
+		for _, c := range s.columns {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, c.name, c.sqlType))
+		}
+	}
+	index := pgx.Identifier{s.table[len(s.table)-1] + "_mac_time_idx"}.Sanitize()
+	statements = append(statements,
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (mac, time DESC)", index, table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	mac text PRIMARY KEY,
+	name text,
+	data_format integer,
+	last_seen timestamptz
+)`, s.tagsTable.Sanitize()),
+	)
+	return statements
+}
+
+func (s *postgresSink) copyColumns() []string {
+	if s.narrow {
+		return []string{"time", "mac", "name", "data_format", "field", "value"}
+	}
+	columns := []string{"time", "mac", "name", "data_format"}
+	for _, c := range s.columns {
+		columns = append(columns, c.name)
+	}
+	return columns
+}
+
+func (s *postgresSink) rows(records []timedMeasurement) [][]any {
+	var rows [][]any
+	for _, r := range records {
+		m := r.measurement
+		var name any
+		if m.Name != nil && *m.Name != "" {
+			name = *m.Name
+		}
+		if s.narrow {
+			for _, c := range s.columns {
+				if v, ok := c.float(m); ok {
+					rows = append(rows, []any{r.time, m.Mac, name, m.DataFormat, c.name, v})
+				}
+			}
+			continue
+		}
+		row := []any{r.time, m.Mac, name, m.DataFormat}
+		for _, c := range s.columns {
+			v, _ := c.value(m)
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ensureSchema creates the tables when missing and stores the configured tag names
+func (s *postgresSink) ensureSchema(ctx context.Context) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, statement := range s.schemaStatements() {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	if s.timescale {
+		_, err := tx.Exec(ctx, "SELECT create_hypertable($1::regclass, 'time', if_not_exists => TRUE, migrate_data => TRUE)", s.table.Sanitize())
+		if err != nil {
+			return fmt.Errorf("failed to create hypertable: %w", err)
+		}
+	}
+	batch := &pgx.Batch{}
+	for mac, name := range s.tagNames {
+		batch.Queue(fmt.Sprintf(`INSERT INTO %s (mac, name) VALUES ($1, NULLIF($2, ''))
+ON CONFLICT (mac) DO UPDATE SET name = EXCLUDED.name`, s.tagsTable.Sanitize()), strings.ToUpper(mac), name)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to store tag names: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// write copies the records into the measurement table and updates the tags table
+func (s *postgresSink) write(ctx context.Context, records []timedMeasurement) error {
+	if !s.ready {
+		if err := s.ensureSchema(ctx); err != nil {
+			return err
+		}
+		s.ready = true
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.CopyFrom(ctx, s.table, s.copyColumns(), pgx.CopyFromRows(s.rows(records))); err != nil {
+		return err
+	}
+
+	latest := make(map[string]timedMeasurement)
+	for _, r := range records {
+		latest[r.measurement.Mac] = r
+	}
+	batch := &pgx.Batch{}
+	for mac, r := range latest {
+		var name any
+		if r.measurement.Name != nil && *r.measurement.Name != "" {
+			name = *r.measurement.Name
+		}
+		batch.Queue(fmt.Sprintf(`INSERT INTO %s (mac, name, data_format, last_seen) VALUES ($1, $2, $3, $4)
+ON CONFLICT (mac) DO UPDATE SET name = EXCLUDED.name, data_format = EXCLUDED.data_format, last_seen = EXCLUDED.last_seen`,
+			s.tagsTable.Sanitize()), mac, name, r.measurement.DataFormat, r.time)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Postgres writes the measurements to PostgreSQL. The rawFields have columns for their unfiltered
+// values, see config.Smoothing.RawFields.
+func Postgres(conf config.PostgresPublisher, tagNames map[string]string, rawFields []string) chan<- parser.Measurement {
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	flushInterval := time.Duration(conf.FlushInterval)
+	if flushInterval == 0 {
+		flushInterval = 10 * time.Second
+	}
+	log.WithFields(log.Fields{
+		"table":            conf.Table,
+		"layout":           conf.Layout,
+		"timescale":        conf.Timescale,
+		"batch_size":       batchSize,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting PostgreSQL sink")
+
+	sink, err := newPostgresSink(conf, tagNames, rawFields)
+	if err != nil {
+		log.WithError(err).Error("Failed to create PostgreSQL sink")
+	}
+
+	measurements := make(chan parser.Measurement, 1024)
+	if sink == nil {
+		go func() {
+			for range measurements {
+			}
+		}()
+		return measurements
+	}
+	go runBatches(measurements, batchOptions{
+		name:          "PostgreSQL",
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		limit:         limiterOptions(conf.SinkOptions),
+		write: func(records []timedMeasurement) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			return sink.write(ctx, records)
+		},
+		close: sink.pool.Close,
+	})
+	return measurements
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Saavuori/ruuvi-go-gateway/common/version"
 	"github.com/Saavuori/ruuvi-go-gateway/config"
@@ -13,325 +16,262 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var metrics struct {
-	info         prometheus.Gauge
-	measurements *prometheus.CounterVec
+const defaultSeriesTTL = 15 * time.Minute
 
-	temperature               *prometheus.GaugeVec
-	humidity                  *prometheus.GaugeVec
-	pressure                  *prometheus.GaugeVec
-	accelerationX             *prometheus.GaugeVec
-	accelerationY             *prometheus.GaugeVec
-	accelerationZ             *prometheus.GaugeVec
-	batteryVoltage            *prometheus.GaugeVec
-	txPower                   *prometheus.GaugeVec
-	rssi                      *prometheus.GaugeVec
-	movementCounter           *prometheus.GaugeVec
-	measurementSequenceNumber *prometheus.GaugeVec
+var prometheusTagLabels = []string{"name", "mac", "data_format"}
 
-	accelerationTotal        *prometheus.GaugeVec
-	absoluteHumidity         *prometheus.GaugeVec
-	dewPoint                 *prometheus.GaugeVec
-	equilibriumVaporPressure *prometheus.GaugeVec
-	airDensity               *prometheus.GaugeVec
-	accelerationAngleFromX   *prometheus.GaugeVec
-	accelerationAngleFromY   *prometheus.GaugeVec
-	accelerationAngleFromZ   *prometheus.GaugeVec
-
-	// New E1 fields
-	pm1p0           *prometheus.GaugeVec
-	pm2p5           *prometheus.GaugeVec
-	pm4p0           *prometheus.GaugeVec
-	pm10p0          *prometheus.GaugeVec
-	co2             *prometheus.GaugeVec
-	voc             *prometheus.GaugeVec
-	nox             *prometheus.GaugeVec
-	luminosity      *prometheus.GaugeVec
-	soundInstant    *prometheus.GaugeVec
-	soundAverage    *prometheus.GaugeVec
-	soundPeak       *prometheus.GaugeVec
-	airQualityIndex *prometheus.GaugeVec
-
-	// Diagnostics
-	calibrationInProgress *prometheus.GaugeVec
-	buttonPressedOnBoot   *prometheus.GaugeVec
-	rtcOnBoot             *prometheus.GaugeVec
+type prometheusMetric struct {
+	field string
+	name  string
+	help  string
 }
 
-func initMetrics(measurementMetricPrefix string) {
-	bridgeMetricPrefix := "ruuvibridge_"
-	tagLabels := []string{"name", "mac", "data_format"}
-
-	metrics.info = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: bridgeMetricPrefix + "info",
-		Help: "RuuviBridge info",
-		ConstLabels: prometheus.Labels{
-			"version": version.Version,
-			"os":      runtime.GOOS,
-			"arch":    runtime.GOARCH,
-		},
-	})
-
-	metrics.measurements = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: measurementMetricPrefix + "measurements",
-		Help: "Number of received measurements",
-	}, tagLabels)
+// prometheusMetrics maps the measurement fields to metric names, without the measurement metric prefix
+var prometheusMetrics = []prometheusMetric{
+	{"temperature", "temperature", "Temperature in ºC"},
+	{"humidity", "humidity", "Relative humidity in %"},
+	{"pressure", "pressure", "Pressure in Pa"},
+	{"accelerationX", "acceleration_x", "X acceleration in g"},
+	{"accelerationY", "acceleration_y", "Y acceleration in g"},
+	{"accelerationZ", "acceleration_z", "Z acceleration in g"},
+	{"batteryVoltage", "battery_voltage", "Battery voltage in V"},
+	{"txPower", "tx_power", "Transmission power in dBm"},
+	{"rssi", "rssi", "RSSI in dBm"},
+	{"movementCounter", "movement_counter", "Number of detected movements"},
+	{"measurementSequenceNumber", "measurement_sequence_number", "Measurement sequence number"},
 
-	metrics.temperature = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "temperature",
-		Help: "Temperature in ÂºC",
-	}, tagLabels)
-	metrics.humidity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "humidity",
-		Help: "Relative humidity in %",
-	}, tagLabels)
-	metrics.pressure = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "pressure",
-		Help: "Pressure in Pa",
-	}, tagLabels)
-	metrics.accelerationX = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_x",
-		Help: "X acceleration in g",
-	}, tagLabels)
-	metrics.accelerationY = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_y",
-		Help: "Y acceleration in g",
-	}, tagLabels)
-	metrics.accelerationZ = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_z",
-		Help: "Z acceleration in g",
-	}, tagLabels)
-	metrics.batteryVoltage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "battery_voltage",
-		Help: "Battery voltage in V",
-	}, tagLabels)
-	metrics.txPower = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "tx_power",
-		Help: "Transmission power in dBm",
-	}, tagLabels)
-	metrics.rssi = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "rssi",
-		Help: "RSSI in dBm",
-	}, tagLabels)
-	metrics.movementCounter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "movement_counter",
-		Help: "Number of detected movements",
-	}, tagLabels)
-	metrics.measurementSequenceNumber = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "measurement_sequence_number",
-		Help: "Measurement sequence number",
-	}, tagLabels)
+	{"accelerationTotal", "acceleration_total", "Total acceleration in g"},
+	{"absoluteHumidity", "absolute_humidity", "Absolute humidity in g/m3"},
+	{"dewPoint", "dew_point", "Dew point in ºC"},
+	{"equilibriumVaporPressure", "equilibrium_vapor_pressure", "Equilibrium vapor pressure in Pa"},
+	{"airDensity", "air_density", "Air density in kg/m3"},
+	{"accelerationAngleFromX", "acceleration_angle_from_x", "Acceleration angle from X in degrees"},
+	{"accelerationAngleFromY", "acceleration_angle_from_y", "Acceleration angle from Y in degrees"},
+	{"accelerationAngleFromZ", "acceleration_angle_from_z", "Acceleration angle from Z in degrees"},
 
-	metrics.accelerationTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_total",
-		Help: "Total acceleration in g",
-	}, tagLabels)
-	metrics.absoluteHumidity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "absolute_humidity",
-		Help: "Absolute humidity in g/m3",
-	}, tagLabels)
-	metrics.dewPoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "dew_point",
-		Help: "Dew point in ÂºC",
-	}, tagLabels)
-	metrics.equilibriumVaporPressure = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "equilibrium_vapor_pressure",
-		Help: "Equilibrium vapor pressure in Pa",
-	}, tagLabels)
-	metrics.airDensity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "air_density",
-		Help: "Air density in kg/m3",
-	}, tagLabels)
-	metrics.accelerationAngleFromX = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_angle_from_x",
-		Help: "Acceleration angle from X in degrees",
-	}, tagLabels)
-	metrics.accelerationAngleFromY = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_angle_from_y",
-		Help: "Acceleration angle from Y in degrees",
-	}, tagLabels)
-	metrics.accelerationAngleFromZ = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "acceleration_angle_from_z",
-		Help: "Acceleration angle from Z in degrees",
-	}, tagLabels)
+	// E1 fields
+	{"pm1p0", "pm1p0", "PM1.0 mass concentration (µg/m³)"},
+	{"pm2p5", "pm2p5", "PM2.5 mass concentration (µg/m³)"},
+	{"pm4p0", "pm4p0", "PM4.0 mass concentration (µg/m³)"},
+	{"pm10p0", "pm10p0", "PM10.0 mass concentration (µg/m³)"},
+	{"co2", "co2", "CO2 concentration (ppm)"},
+	{"voc", "voc", "VOC index"},
+	{"nox", "nox", "NOx index"},
+	{"illuminance", "luminosity", "Luminosity (lx)"},
+	{"soundInstant", "sound_instant", "Instant sound level (dBA)"},
+	{"soundAverage", "sound_average", "Average sound level (dBA)"},
+	{"soundPeak", "sound_peak", "Peak sound level (dBA)"},
+	{"airQualityIndex", "air_quality", "Air quality index"},
 
-	// New E1 metrics
-	metrics.pm1p0 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "pm1p0",
-		Help: "PM1.0 mass concentration (Âµg/mÂ³)",
-	}, tagLabels)
-	metrics.pm2p5 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "pm2p5",
-		Help: "PM2.5 mass concentration (Âµg/mÂ³)",
-	}, tagLabels)
-	metrics.pm4p0 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "pm4p0",
-		Help: "PM4.0 mass concentration (Âµg/mÂ³)",
-	}, tagLabels)
-	metrics.pm10p0 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "pm10p0",
-		Help: "PM10.0 mass concentration (Âµg/mÂ³)",
-	}, tagLabels)
-	metrics.co2 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "co2",
-		Help: "CO2 concentration (ppm)",
-	}, tagLabels)
-	metrics.voc = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "voc",
-		Help: "VOC index",
-	}, tagLabels)
-	metrics.nox = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "nox",
-		Help: "NOx index",
-	}, tagLabels)
-	metrics.luminosity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "luminosity",
-		Help: "Luminosity (lx)",
-	}, tagLabels)
-	metrics.soundInstant = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "sound_instant",
-		Help: "Instant sound level (dBA)",
-	}, tagLabels)
-	metrics.soundAverage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "sound_average",
-		Help: "Average sound level (dBA)",
-	}, tagLabels)
-	metrics.soundPeak = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "sound_peak",
-		Help: "Peak sound level (dBA)",
-	}, tagLabels)
-	metrics.airQualityIndex = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "air_quality",
-		Help: "Air quality index",
-	}, tagLabels)
-
-	// Diagnostic metrics
-	metrics.calibrationInProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "calibration_in_progress",
-		Help: "Calibration in progress (1/0)",
-	}, tagLabels)
-	metrics.buttonPressedOnBoot = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "button_pressed_on_boot",
-		Help: "Button pressed on boot (1/0)",
-	}, tagLabels)
-	metrics.rtcOnBoot = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: measurementMetricPrefix + "rtc_on_boot",
-		Help: "RTC was running at boot (1/0)",
-	}, tagLabels)
+	// Diagnostics
+	{"calibrationInProgress", "calibration_in_progress", "Calibration in progress (1/0)"},
+	{"buttonPressedOnBoot", "button_pressed_on_boot", "Button pressed on boot (1/0)"},
+	{"rtcOnBoot", "rtc_on_boot", "RTC was running at boot (1/0)"},
+}
 
-	prometheus.MustRegister(metrics.info)
-	prometheus.MustRegister(metrics.measurements)
+// prometheusFields returns the measurement field of each of prometheusMetrics
+func prometheusFields() []parser.Field {
+	fields := make([]parser.Field, len(prometheusMetrics))
+	for i, metric := range prometheusMetrics {
+		fields[i], _ = parser.FieldByName(metric.field)
+	}
+	return fields
+}
 
-	prometheus.MustRegister(metrics.temperature)
-	prometheus.MustRegister(metrics.humidity)
-	prometheus.MustRegister(metrics.pressure)
-	prometheus.MustRegister(metrics.accelerationX)
-	prometheus.MustRegister(metrics.accelerationY)
-	prometheus.MustRegister(metrics.accelerationZ)
-	prometheus.MustRegister(metrics.batteryVoltage)
-	prometheus.MustRegister(metrics.txPower)
-	prometheus.MustRegister(metrics.rssi)
-	prometheus.MustRegister(metrics.movementCounter)
-	prometheus.MustRegister(metrics.measurementSequenceNumber)
+// tagSnapshot is the state of a tag in tagValues
+type tagSnapshot struct {
+	// Values of prometheusTagLabels
+	Labels []string
+	Count  float64
+	// Latest value of each of prometheusMetrics, by index
+	Values map[int]float64
+	// Statistics of the latest measurement when it was aggregated, by index
+	Aggregates map[int]parser.Aggregate
+	// Unfiltered values of the latest measurement when it was smoothed, by index
+	Raw map[int]float64
+}
 
-	prometheus.MustRegister(metrics.accelerationTotal)
-	prometheus.MustRegister(metrics.absoluteHumidity)
-	prometheus.MustRegister(metrics.dewPoint)
-	prometheus.MustRegister(metrics.equilibriumVaporPressure)
-	prometheus.MustRegister(metrics.airDensity)
-	prometheus.MustRegister(metrics.accelerationAngleFromX)
-	prometheus.MustRegister(metrics.accelerationAngleFromY)
-	prometheus.MustRegister(metrics.accelerationAngleFromZ)
+type tagValuesEntry struct {
+	tagSnapshot
+	lastSeen time.Time
+}
 
-	// Register new E1 metrics
-	prometheus.MustRegister(metrics.pm1p0)
-	prometheus.MustRegister(metrics.pm2p5)
-	prometheus.MustRegister(metrics.pm4p0)
-	prometheus.MustRegister(metrics.pm10p0)
-	prometheus.MustRegister(metrics.co2)
-	prometheus.MustRegister(metrics.voc)
-	prometheus.MustRegister(metrics.nox)
-	prometheus.MustRegister(metrics.luminosity)
-	prometheus.MustRegister(metrics.soundInstant)
-	prometheus.MustRegister(metrics.soundAverage)
-	prometheus.MustRegister(metrics.soundPeak)
-	prometheus.MustRegister(metrics.airQualityIndex)
+// tagValues keeps the latest field values of every tag and forgets the tags
+// which have not been seen within the TTL
+type tagValues struct {
+	ttl    time.Duration
+	now    func() time.Time
+	fields []parser.Field
 
-	// Register diagnostics
-	prometheus.MustRegister(metrics.calibrationInProgress)
-	prometheus.MustRegister(metrics.buttonPressedOnBoot)
-	prometheus.MustRegister(metrics.rtcOnBoot)
+	mu   sync.Mutex
+	tags map[string]*tagValuesEntry
+}
 
-	metrics.info.Set(1)
+func newTagValues(ttl time.Duration) *tagValues {
+	if ttl <= 0 {
+		ttl = defaultSeriesTTL
+	}
+	return &tagValues{
+		ttl:    ttl,
+		now:    time.Now,
+		fields: prometheusFields(),
+		tags:   make(map[string]*tagValuesEntry),
+	}
 }
 
-func recordMetrics(m parser.Measurement) {
+func (v *tagValues) record(m parser.Measurement) {
 	name := ""
 	if m.Name != nil {
 		name = *m.Name
 	}
-	labels := prometheus.Labels{"name": name, "mac": m.Mac, "data_format": fmt.Sprintf("%X", m.DataFormat)}
-	safeSetF := func(gauge *prometheus.GaugeVec, v *float64) {
-		if v != nil {
-			gauge.With(labels).Set(*v)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	tag, ok := v.tags[m.Mac]
+	if !ok {
+		tag = &tagValuesEntry{tagSnapshot: tagSnapshot{Values: make(map[int]float64)}}
+		v.tags[m.Mac] = tag
+	}
+	tag.Labels = []string{name, m.Mac, fmt.Sprintf("%X", m.DataFormat)}
+	tag.Count++
+	tag.lastSeen = v.now()
+	tag.Aggregates = nil
+	tag.Raw = nil
+	for i, f := range v.fields {
+		if value, ok := f.Float(m); ok {
+			tag.Values[i] = value
+		}
+		if a, ok := m.Aggregates[f.Name]; ok {
+			if tag.Aggregates == nil {
+				tag.Aggregates = make(map[int]parser.Aggregate)
+			}
+			tag.Aggregates[i] = a
+		}
+		if value, ok := m.Raw[f.Name]; ok {
+			if tag.Raw == nil {
+				tag.Raw = make(map[int]float64)
+			}
+			tag.Raw[i] = value
 		}
 	}
-	safeSetI := func(gauge *prometheus.GaugeVec, v *int64) {
-		if v != nil {
-			gauge.With(labels).Set(float64(*v))
+}
+
+// snapshot returns a copy of every tag, sorted by MAC. Tags which have expired are removed.
+func (v *tagValues) snapshot() []tagSnapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	macs := make([]string, 0, len(v.tags))
+	for mac, tag := range v.tags {
+		if v.now().Sub(tag.lastSeen) > v.ttl {
+			log.WithField("mac", mac).Debug("Removing stale tag series")
+			delete(v.tags, mac)
+			continue
 		}
+		macs = append(macs, mac)
 	}
-	safeSetB := func(gauge *prometheus.GaugeVec, v *bool) {
-		if v != nil {
-			if *v {
-				gauge.With(labels).Set(1)
-			} else {
-				gauge.With(labels).Set(0)
+	sort.Strings(macs)
+
+	snapshot := make([]tagSnapshot, 0, len(macs))
+	for _, mac := range macs {
+		tag := v.tags[mac]
+		values := make(map[int]float64, len(tag.Values))
+		for i, value := range tag.Values {
+			values[i] = value
+		}
+		var aggregates map[int]parser.Aggregate
+		if tag.Aggregates != nil {
+			aggregates = make(map[int]parser.Aggregate, len(tag.Aggregates))
+			for i, a := range tag.Aggregates {
+				aggregates[i] = a
+			}
+		}
+		var raw map[int]float64
+		if tag.Raw != nil {
+			raw = make(map[int]float64, len(tag.Raw))
+			for i, value := range tag.Raw {
+				raw[i] = value
 			}
 		}
+		snapshot = append(snapshot, tagSnapshot{Labels: tag.Labels, Count: tag.Count, Values: values, Aggregates: aggregates, Raw: raw})
 	}
+	return snapshot
+}
 
-	metrics.measurements.With(labels).Inc()
+// tagCollector exposes tagValues as Prometheus metrics
+type tagCollector struct {
+	prefix string
+	descs  map[string]*prometheus.Desc
+	values *tagValues
+}
 
-	safeSetF(metrics.temperature, m.Temperature)
-	safeSetF(metrics.humidity, m.Humidity)
-	safeSetF(metrics.pressure, m.Pressure)
-	safeSetF(metrics.accelerationX, m.AccelerationX)
-	safeSetF(metrics.accelerationY, m.AccelerationY)
-	safeSetF(metrics.accelerationZ, m.AccelerationZ)
-	safeSetF(metrics.batteryVoltage, m.BatteryVoltage)
-	safeSetI(metrics.txPower, m.TxPower)
-	safeSetI(metrics.rssi, m.Rssi)
-	safeSetI(metrics.movementCounter, m.MovementCounter)
-	safeSetI(metrics.measurementSequenceNumber, m.MeasurementSequenceNumber)
+func newTagCollector(measurementMetricPrefix string, ttl time.Duration) *tagCollector {
+	c := &tagCollector{
+		prefix: measurementMetricPrefix,
+		descs:  make(map[string]*prometheus.Desc),
+		values: newTagValues(ttl),
+	}
+	c.descs[c.prefix+"measurements"] = prometheus.NewDesc(c.prefix+"measurements", "Number of received measurements", prometheusTagLabels, nil)
+	for i, metric := range prometheusMetrics {
+		c.descs[c.prefix+metric.name] = prometheus.NewDesc(c.prefix+metric.name, metric.help, prometheusTagLabels, nil)
+		c.descs[c.prefix+metric.name+"_raw"] = prometheus.NewDesc(c.prefix+metric.name+"_raw", metric.help+", unfiltered", prometheusTagLabels, nil)
+		if !aggregatedField(c.values.fields[i]) {
+			continue
+		}
+		for _, s := range aggregateStatistics {
+			name := c.prefix + metric.name + "_" + s.suffix
+			c.descs[name] = prometheus.NewDesc(name, metric.help+", "+s.suffix+" of the aggregation window", prometheusTagLabels, nil)
+		}
+	}
+	return c
+}
 
-	safeSetF(metrics.accelerationTotal, m.AccelerationTotal)
-	safeSetF(metrics.absoluteHumidity, m.AbsoluteHumidity)
-	safeSetF(metrics.dewPoint, m.DewPoint)
-	safeSetF(metrics.equilibriumVaporPressure, m.EquilibriumVaporPressure)
-	safeSetF(metrics.airDensity, m.AirDensity)
-	safeSetF(metrics.accelerationAngleFromX, m.AccelerationAngleFromX)
-	safeSetF(metrics.accelerationAngleFromY, m.AccelerationAngleFromY)
-	safeSetF(metrics.accelerationAngleFromZ, m.AccelerationAngleFromZ)
+func (c *tagCollector) record(m parser.Measurement) {
+	c.values.record(m)
+}
 
-	// New E1 fields
-	safeSetF(metrics.pm1p0, m.Pm1p0)
-	safeSetF(metrics.pm2p5, m.Pm2p5)
-	safeSetF(metrics.pm4p0, m.Pm4p0)
-	safeSetF(metrics.pm10p0, m.Pm10p0)
-	safeSetF(metrics.co2, m.CO2)
-	safeSetF(metrics.voc, m.VOC)
-	safeSetF(metrics.nox, m.NOX)
-	safeSetF(metrics.luminosity, m.Illuminance)
-	safeSetF(metrics.soundInstant, m.SoundInstant)
-	safeSetF(metrics.soundAverage, m.SoundAverage)
-	safeSetF(metrics.soundPeak, m.SoundPeak)
-	safeSetF(metrics.airQualityIndex, m.AirQualityIndex)
+func (c *tagCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
 
-	// Diagnostics
-	safeSetB(metrics.calibrationInProgress, m.CalibrationInProgress)
-	safeSetB(metrics.buttonPressedOnBoot, m.ButtonPressedOnBoot)
-	safeSetB(metrics.rtcOnBoot, m.RtcOnBoot)
+func (c *tagCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, tag := range c.values.snapshot() {
+		ch <- prometheus.MustNewConstMetric(c.descs[c.prefix+"measurements"], prometheus.CounterValue, tag.Count, tag.Labels...)
+		for i, metric := range prometheusMetrics {
+			if v, ok := tag.Values[i]; ok {
+				ch <- prometheus.MustNewConstMetric(c.descs[c.prefix+metric.name], prometheus.GaugeValue, v, tag.Labels...)
+			}
+			if v, ok := tag.Raw[i]; ok {
+				ch <- prometheus.MustNewConstMetric(c.descs[c.prefix+metric.name+"_raw"], prometheus.GaugeValue, v, tag.Labels...)
+			}
+			if a, ok := tag.Aggregates[i]; ok {
+				for _, s := range aggregateStatistics {
+					ch <- prometheus.MustNewConstMetric(c.descs[c.prefix+metric.name+"_"+s.suffix], prometheus.GaugeValue, s.value(a), tag.Labels...)
+				}
+			}
+		}
+	}
+}
+
+func prometheusMetricPrefix(prefix string) string {
+	if prefix == "" {
+		return "ruuvi_"
+	}
+	return fmt.Sprintf("%s_", prefix)
+}
+
+func newInfoMetric() prometheus.Gauge {
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ruuvibridge_info",
+		Help: "RuuviBridge info",
+		ConstLabels: prometheus.Labels{
+			"version": version.Version,
+			"os":      runtime.GOOS,
+			"arch":    runtime.GOARCH,
+		},
+	})
+	info.Set(1)
+	return info
 }
 
 func Prometheus(conf config.Prometheus) chan<- parser.Measurement {
@@ -339,20 +279,26 @@ func Prometheus(conf config.Prometheus) chan<- parser.Measurement {
 	if port == 0 {
 		port = 8081
 	}
-	log.WithField("port", port).Info("Starting prometheus sink")
 	measurements := make(chan parser.Measurement, 1024)
-	measurementMetricPrefix := "ruuvi_"
-	if conf.MeasurementMetricPrefix != "" {
-		measurementMetricPrefix = fmt.Sprintf("%s_", conf.MeasurementMetricPrefix)
-	}
-	initMetrics(measurementMetricPrefix)
+	collector := newTagCollector(prometheusMetricPrefix(conf.MeasurementMetricPrefix), time.Duration(conf.SeriesTTL))
+	prometheus.MustRegister(newInfoMetric())
+	prometheus.MustRegister(collector)
 	go func() {
 		for measurement := range measurements {
-			recordMetrics(measurement)
+			collector.record(measurement)
 		}
 	}()
 
-	go http.ListenAndServe(fmt.Sprintf(":%d", port), promhttp.Handler())
+	if conf.UseHTTPListener {
+		log.Info("Starting prometheus sink on the management web server")
+	} else {
+		log.WithField("port", port).Info("Starting prometheus sink")
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", port), promhttp.Handler()); err != nil {
+				log.WithError(err).Error("Prometheus server failed")
+			}
+		}()
+	}
 
 	return measurements
 }
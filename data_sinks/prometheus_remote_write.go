@@ -0,0 +1,260 @@
+package data_sinks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/limiter"
+	"github.com/Saavuori/ruuvi-go-gateway/common/version"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/klauspost/compress/snappy"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Prometheus remote write 1.0, see https://prometheus.io/docs/specs/remote_write_spec/
+//
+// The WriteRequest protobuf is small enough to be encoded by hand:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+
+type remoteWriteLabel struct {
+	Name  string
+	Value string
+}
+
+type remoteWriteSeries struct {
+	Labels    []remoteWriteLabel
+	Value     float64
+	Timestamp int64 // milliseconds
+}
+
+func encodeRemoteWriteRequest(series []remoteWriteSeries) []byte {
+	var buf []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
+
+type remoteWriter struct {
+	conf       config.PrometheusRemoteWrite
+	client     *http.Client
+	prefix     string
+	fields     []parser.Field
+	maxRetries int
+	backoff    time.Duration
+	counts     map[string]float64
+}
+
+func newRemoteWriter(conf config.PrometheusRemoteWrite) *remoteWriter {
+	timeout := time.Duration(conf.Timeout)
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	maxRetries := 3
+	if conf.MaxRetries != nil {
+		maxRetries = *conf.MaxRetries
+	}
+	return &remoteWriter{
+		conf:       conf,
+		client:     &http.Client{Timeout: timeout},
+		prefix:     prometheusMetricPrefix(conf.MeasurementMetricPrefix),
+		fields:     prometheusFields(),
+		maxRetries: maxRetries,
+		backoff:    time.Second,
+		counts:     make(map[string]float64),
+	}
+}
+
+// series converts a measurement into one series per present field, named like the Prometheus sink
+// metrics. Aggregated measurements add <metric>_min, <metric>_max and <metric>_count, and smoothed
+// measurements <metric>_raw with the unfiltered values.
+func (w *remoteWriter) series(m parser.Measurement, timestamp time.Time) []remoteWriteSeries {
+	labels := []remoteWriteLabel{
+		{"mac", m.Mac},
+		{"data_format", fmt.Sprintf("%X", m.DataFormat)},
+	}
+	if m.Name != nil && *m.Name != "" {
+		labels = append(labels, remoteWriteLabel{"name", *m.Name})
+	}
+	for name, value := range w.conf.ExternalLabels {
+		labels = append(labels, remoteWriteLabel{name, value})
+	}
+	ms := timestamp.UnixMilli()
+	newSeries := func(name string, value float64) remoteWriteSeries {
+		seriesLabels := make([]remoteWriteLabel, 0, len(labels)+1)
+		seriesLabels = append(seriesLabels, remoteWriteLabel{"__name__", name})
+		seriesLabels = append(seriesLabels, labels...)
+		// Labels must be sorted by name
+		sort.Slice(seriesLabels, func(i, j int) bool { return seriesLabels[i].Name < seriesLabels[j].Name })
+		return remoteWriteSeries{Labels: seriesLabels, Value: value, Timestamp: ms}
+	}
+
+	w.counts[m.Mac]++
+	series := []remoteWriteSeries{newSeries(w.prefix+"measurements", w.counts[m.Mac])}
+	for i, metric := range prometheusMetrics {
+		if v, ok := w.fields[i].Float(m); ok {
+			series = append(series, newSeries(w.prefix+metric.name, v))
+		}
+		if a, ok := m.Aggregates[metric.field]; ok {
+			for _, s := range aggregateStatistics {
+				series = append(series, newSeries(w.prefix+metric.name+"_"+s.suffix, s.value(a)))
+			}
+		}
+		if v, ok := m.Raw[metric.field]; ok {
+			series = append(series, newSeries(w.prefix+metric.name+"_raw", v))
+		}
+	}
+	return series
+}
+
+type remoteWriteError struct {
+	status      int
+	body        string
+	recoverable bool
+}
+
+func (e *remoteWriteError) Error() string {
+	return fmt.Sprintf("remote write failed with status %d: %s", e.status, e.body)
+}
+
+func (w *remoteWriter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "ruuvi-go-gateway/"+version.Version)
+	if w.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.conf.BearerToken)
+	} else if w.conf.Username != "" {
+		req.SetBasicAuth(w.conf.Username, w.conf.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &remoteWriteError{
+		status: resp.StatusCode,
+		body:   string(bytes.TrimSpace(msg)),
+		// Per the spec, only 5xx and 429 may be retried
+		recoverable: resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+// write sends the series, retrying recoverable errors with exponential backoff
+func (w *remoteWriter) write(series []remoteWriteSeries) error {
+	body := snappy.Encode(nil, encodeRemoteWriteRequest(series))
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		err := w.send(context.Background(), body)
+		if err == nil {
+			return nil
+		}
+		if rwErr, ok := err.(*remoteWriteError); ok && !rwErr.recoverable {
+			return err
+		}
+		if attempt >= w.maxRetries {
+			return err
+		}
+		log.WithError(err).WithField("attempt", attempt+1).Debug("Retrying Prometheus remote write")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func PrometheusRemoteWrite(conf config.PrometheusRemoteWrite) chan<- parser.Measurement {
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	flushInterval := time.Duration(conf.FlushInterval)
+	if flushInterval == 0 {
+		flushInterval = 10 * time.Second
+	}
+	log.WithFields(log.Fields{
+		"target":           conf.Url,
+		"batch_size":       batchSize,
+		"flush_interval":   flushInterval,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting Prometheus remote write sink")
+
+	writer := newRemoteWriter(conf)
+	limiter := limiter.NewWithOptions(limiterOptions(conf.SinkOptions))
+	measurements := make(chan parser.Measurement, 1024)
+	go func() {
+		var batch []remoteWriteSeries
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := writer.write(batch); err != nil {
+				log.WithError(err).WithField("series", len(batch)).Error("Failed to send measurements with Prometheus remote write")
+			} else {
+				log.WithField("series", len(batch)).Trace("Sent measurements with Prometheus remote write")
+			}
+			batch = nil
+		}
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case measurement, ok := <-measurements:
+				if !ok {
+					flush()
+					return
+				}
+				if !limiter.Check(measurement) {
+					log.WithField("mac", measurement.Mac).Trace("Skipping Prometheus remote write due to interval limit")
+					continue
+				}
+				batch = append(batch, writer.series(measurement, time.Now())...)
+				if len(batch) >= batchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return measurements
+}
@@ -0,0 +1,194 @@
+package data_sinks
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeRemoteWriteRequest is a minimal WriteRequest decoder for the test receiver
+func decodeRemoteWriteRequest(t *testing.T, data []byte) []remoteWriteSeries {
+	t.Helper()
+	fields := func(b []byte, visit func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			n = visit(num, typ, b)
+			if n < 0 {
+				t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+		}
+	}
+	var result []remoteWriteSeries
+	fields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+		var s remoteWriteSeries
+		fields(ts, func(num protowire.Number, typ protowire.Type, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				var l remoteWriteLabel
+				fields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					v, n := protowire.ConsumeString(b)
+					if num == 1 {
+						l.Name = v
+					} else {
+						l.Value = v
+					}
+					return n
+				})
+				s.Labels = append(s.Labels, l)
+			case 2:
+				fields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					if num == 1 {
+						v, n := protowire.ConsumeFixed64(b)
+						s.Value = math.Float64frombits(v)
+						return n
+					}
+					v, n := protowire.ConsumeVarint(b)
+					s.Timestamp = int64(v)
+					return n
+				})
+			}
+			return n
+		})
+		result = append(result, s)
+		return n
+	})
+	return result
+}
+
+type remoteWriteReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	series   []remoteWriteSeries
+	statuses []int
+}
+
+func (r *remoteWriteReceiver) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			if status != http.StatusNoContent {
+				http.Error(w, "failed", status)
+				return
+			}
+		}
+		body, _ := io.ReadAll(req.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("invalid snappy payload: %v", err)
+		}
+		r.series = append(r.series, decodeRemoteWriteRequest(t, data)...)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func labelValue(s remoteWriteSeries, name string) string {
+	for _, l := range s.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func TestRemoteWriter_Write(t *testing.T) {
+	receiver := &remoteWriteReceiver{}
+	srv := httptest.NewServer(receiver.handler(t))
+	defer srv.Close()
+
+	writer := newRemoteWriter(config.PrometheusRemoteWrite{
+		Url:            srv.URL,
+		Username:       "user",
+		Password:       "pass",
+		ExternalLabels: map[string]string{"location": "home"},
+	})
+	timestamp := time.UnixMilli(1700000000123)
+	if err := writer.write(writer.series(testMeasurement(), timestamp)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	req := receiver.requests[0]
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("basic auth: got %q %q", user, pass)
+	}
+	if req.Header.Get("Content-Encoding") != "snappy" || req.Header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("headers: got %v", req.Header)
+	}
+
+	values := make(map[string]float64)
+	for _, s := range receiver.series {
+		for i := 1; i < len(s.Labels); i++ {
+			if s.Labels[i-1].Name >= s.Labels[i].Name {
+				t.Errorf("labels are not sorted: %v", s.Labels)
+			}
+		}
+		if s.Timestamp != timestamp.UnixMilli() {
+			t.Errorf("timestamp: got %d", s.Timestamp)
+		}
+		if labelValue(s, "mac") != "AA:BB:CC:DD:EE:FF" || labelValue(s, "name") != "Living Room" ||
+			labelValue(s, "data_format") != "5" || labelValue(s, "location") != "home" {
+			t.Errorf("labels: got %v", s.Labels)
+		}
+		values[labelValue(s, "__name__")] = s.Value
+	}
+	expected := map[string]float64{
+		"ruuvi_measurements": 1,
+		"ruuvi_temperature":  21.5,
+		"ruuvi_humidity":     45.25,
+		"ruuvi_rssi":         -70,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("got series %v want %v", values, expected)
+	}
+	for name, want := range expected {
+		if values[name] != want {
+			t.Errorf("%s: got %v want %v", name, values[name], want)
+		}
+	}
+}
+
+func TestRemoteWriter_Retries(t *testing.T) {
+	receiver := &remoteWriteReceiver{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}}
+	srv := httptest.NewServer(receiver.handler(t))
+	defer srv.Close()
+
+	writer := newRemoteWriter(config.PrometheusRemoteWrite{Url: srv.URL, BearerToken: "secret"})
+	writer.backoff = time.Millisecond
+	if err := writer.write(writer.series(testMeasurement(), time.Now())); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if len(receiver.requests) != 3 {
+		t.Errorf("got %d requests want 3", len(receiver.requests))
+	}
+	if auth := receiver.requests[0].Header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("authorization: got %q", auth)
+	}
+
+	// Client errors are not retried
+	receiver.requests = nil
+	receiver.statuses = []int{http.StatusBadRequest}
+	if err := writer.write(writer.series(testMeasurement(), time.Now())); err == nil {
+		t.Errorf("expected an error for a bad request")
+	}
+	if len(receiver.requests) != 1 {
+		t.Errorf("got %d requests want 1", len(receiver.requests))
+	}
+}
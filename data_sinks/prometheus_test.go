@@ -0,0 +1,85 @@
+package data_sinks
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetrics_CoverAllFields(t *testing.T) {
+	for _, metric := range prometheusMetrics {
+		if _, ok := parser.FieldByName(metric.field); !ok {
+			t.Errorf("unknown field %q", metric.field)
+		}
+	}
+	if len(prometheusMetrics) != len(parser.Fields) {
+		t.Errorf("got %d metrics for %d fields", len(prometheusMetrics), len(parser.Fields))
+	}
+}
+
+func TestTagCollector_ExpiresStaleTags(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	collector := newTagCollector("ruuvi_", time.Minute)
+	collector.values.now = func() time.Time { return now }
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	m := testMeasurement()
+	collector.record(m)
+	collector.record(m)
+	expected := `
+# HELP ruuvi_temperature Temperature in ºC
+# TYPE ruuvi_temperature gauge
+ruuvi_temperature{data_format="5",mac="AA:BB:CC:DD:EE:FF",name="Living Room"} 21.5
+# HELP ruuvi_measurements Number of received measurements
+# TYPE ruuvi_measurements counter
+ruuvi_measurements{data_format="5",mac="AA:BB:CC:DD:EE:FF",name="Living Room"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "ruuvi_temperature", "ruuvi_measurements"); err != nil {
+		t.Error(err)
+	}
+
+	// Fields missing from a later measurement keep their last value
+	now = now.Add(30 * time.Second)
+	m.Temperature = nil
+	collector.record(m)
+	if count := testutil.CollectAndCount(collector, "ruuvi_temperature"); count != 1 {
+		t.Errorf("temperature series: got %d want 1", count)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("expired tag: got %d series want 0", count)
+	}
+}
+
+func TestTagCollector_Aggregates(t *testing.T) {
+	collector := newTagCollector("ruuvi_", time.Minute)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	m := testMeasurement()
+	m.Aggregates = map[string]parser.Aggregate{"temperature": {Min: 20, Max: 23, Mean: 21.5, Count: 4}}
+	collector.record(m)
+	expected := `
+# HELP ruuvi_temperature_min Temperature in ºC, min of the aggregation window
+# TYPE ruuvi_temperature_min gauge
+ruuvi_temperature_min{data_format="5",mac="AA:BB:CC:DD:EE:FF",name="Living Room"} 20
+# HELP ruuvi_temperature_count Temperature in ºC, count of the aggregation window
+# TYPE ruuvi_temperature_count gauge
+ruuvi_temperature_count{data_format="5",mac="AA:BB:CC:DD:EE:FF",name="Living Room"} 4
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "ruuvi_temperature_min", "ruuvi_temperature_count"); err != nil {
+		t.Error(err)
+	}
+
+	// The statistics are dropped with the next measurement which is not aggregated
+	collector.record(testMeasurement())
+	if count := testutil.CollectAndCount(collector, "ruuvi_temperature_max"); count != 0 {
+		t.Errorf("temperature_max series: got %d want 0", count)
+	}
+}
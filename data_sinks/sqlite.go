@@ -0,0 +1,240 @@
+package data_sinks
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// The measurement table has the same tags and fields as the InfluxDB sinks, one column each,
+// and the receive time as unix milliseconds in the time column, eg.
+//
+//	SELECT datetime(time / 1000, 'unixepoch'), name, temperature FROM ruuvi_measurements WHERE mac = 'AABBCCDDEEFF'
+
+var sqliteTagColumns = []string{"dataFormat", "mac", "name"}
+
+func sqliteQuote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+func sqliteType(kind parser.FieldKind) string {
+	if kind == parser.FloatField {
+		return "REAL"
+	}
+	// Booleans are stored as 0/1
+	return "INTEGER"
+}
+
+type sqliteSink struct {
+	db        *sql.DB
+	table     string
+	columns   []fieldColumn
+	retention time.Duration
+}
+
+func newSQLiteSink(conf config.SQLitePublisher, rawFields []string) (*sqliteSink, error) {
+	path := conf.Path
+	if path == "" {
+		path = "ruuvi.db"
+	}
+	table := conf.Table
+	if table == "" {
+		table = "ruuvi_measurements"
+	}
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, serialize everything through one connection
+	db.SetMaxOpenConns(1)
+	s := &sqliteSink{db: db, table: table, columns: fieldColumns(conf.AggregationWindow > 0, rawFields), retention: time.Duration(conf.Retention)}
+	if err := s.ensureSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureSchema creates the measurement table and adds the columns of fields added after it was
+// created, and the columns of the statistics and raw values when they are enabled later
+func (s *sqliteSink) ensureSchema() error {
+	definitions := []string{"time INTEGER NOT NULL"}
+	for _, tag := range sqliteTagColumns {
+		definitions = append(definitions, sqliteQuote(tag)+" TEXT")
+	}
+	for _, c := range s.columns {
+		definitions = append(definitions, sqliteQuote(c.fieldName())+" "+sqliteType(c.kind()))
+	}
+	table := sqliteQuote(s.table)
+	if _, err := s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(definitions, ", "))); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	index := sqliteQuote(s.table + "_mac_time_idx")
+	if _, err := s.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (mac, time)", index, table)); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info(%s)", sqliteQuoteString(s.table)))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	for _, c := range s.columns {
+		if existing[c.fieldName()] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, sqliteQuote(c.fieldName()), sqliteType(c.kind()))); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", c.fieldName(), err)
+		}
+	}
+	return nil
+}
+
+func sqliteQuoteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// write inserts the records in a single transaction
+func (s *sqliteSink) write(records []timedMeasurement) error {
+	columns := []string{"time"}
+	for _, tag := range sqliteTagColumns {
+		columns = append(columns, sqliteQuote(tag))
+	}
+	for _, c := range s.columns {
+		columns = append(columns, sqliteQuote(c.fieldName()))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqliteQuote(s.table), strings.Join(columns, ", "), placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		tags := influxTags(r.measurement, nil)
+		values := []any{r.time.UnixMilli()}
+		for _, tag := range sqliteTagColumns {
+			if value, ok := tags[tag]; ok && value != "" {
+				values = append(values, value)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		for _, c := range s.columns {
+			v, _ := c.value(r.measurement)
+			values = append(values, v)
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prune deletes the measurements older than the retention
+func (s *sqliteSink) prune(now time.Time) (int64, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE time < ?", sqliteQuote(s.table)), now.Add(-s.retention).UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// vacuum rebuilds the database file to release the space of deleted rows
+func (s *sqliteSink) vacuum() error {
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+func (s *sqliteSink) maintain(vacuumInterval time.Duration) {
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+	vacuumTicker := time.NewTicker(vacuumInterval)
+	defer vacuumTicker.Stop()
+	for {
+		select {
+		case now := <-pruneTicker.C:
+			deleted, err := s.prune(now)
+			if err != nil {
+				log.WithError(err).Error("Failed to prune old SQLite measurements")
+			} else if deleted > 0 {
+				log.WithField("deleted", deleted).Debug("Pruned old SQLite measurements")
+			}
+		case <-vacuumTicker.C:
+			if err := s.vacuum(); err != nil {
+				log.WithError(err).Error("Failed to vacuum SQLite database")
+			}
+		}
+	}
+}
+
+// SQLite writes the measurements to a SQLite database. The rawFields have columns for their
+// unfiltered values, see config.Smoothing.RawFields.
+func SQLite(conf config.SQLitePublisher, rawFields []string) chan<- parser.Measurement {
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	flushInterval := time.Duration(conf.FlushInterval)
+	if flushInterval == 0 {
+		flushInterval = 10 * time.Second
+	}
+	vacuumInterval := time.Duration(conf.VacuumInterval)
+	if vacuumInterval == 0 {
+		vacuumInterval = 24 * time.Hour
+	}
+	log.WithFields(log.Fields{
+		"path":             conf.Path,
+		"retention":        conf.Retention,
+		"batch_size":       batchSize,
+		"minimum_interval": conf.MinimumInterval,
+	}).Info("Starting SQLite sink")
+
+	measurements := make(chan parser.Measurement, 1024)
+	sink, err := newSQLiteSink(conf, rawFields)
+	if err != nil {
+		log.WithError(err).Error("Failed to open SQLite database")
+		go func() {
+			for range measurements {
+			}
+		}()
+		return measurements
+	}
+	go sink.maintain(vacuumInterval)
+	go runBatches(measurements, batchOptions{
+		name:          "SQLite",
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		limit:         limiterOptions(conf.SinkOptions),
+		write:         sink.write,
+		close:         func() { sink.db.Close() },
+	})
+	return measurements
+}
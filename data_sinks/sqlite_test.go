@@ -0,0 +1,98 @@
+package data_sinks
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ruuvi.db")
+	sink, err := newSQLiteSink(config.SQLitePublisher{Path: path, Retention: config.Duration(24 * time.Hour)}, nil)
+	if err != nil {
+		t.Fatalf("newSQLiteSink: %v", err)
+	}
+	defer sink.db.Close()
+
+	var journalMode string
+	if err := sink.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("journal_mode: got %q (%v)", journalMode, err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	records := []timedMeasurement{
+		{measurement: testMeasurement(), time: now.Add(-48 * time.Hour)},
+		{measurement: testMeasurement(), time: now},
+	}
+	if err := sink.write(records); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var (
+		timestamp   int64
+		mac, name   string
+		dataFormat  string
+		temperature float64
+		rssi        int64
+		pressure    sql.NullFloat64
+	)
+	row := sink.db.QueryRow(`SELECT time, mac, name, dataFormat, temperature, rssi, pressure FROM ruuvi_measurements ORDER BY time DESC`)
+	if err := row.Scan(&timestamp, &mac, &name, &dataFormat, &temperature, &rssi, &pressure); err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != now.UnixMilli() || mac != "AABBCCDDEEFF" || name != "Living Room" || dataFormat != "5" ||
+		temperature != 21.5 || rssi != -70 || pressure.Valid {
+		t.Errorf("got %d %s %s %s %v %d %v", timestamp, mac, name, dataFormat, temperature, rssi, pressure)
+	}
+
+	deleted, err := sink.prune(now)
+	if err != nil || deleted != 1 {
+		t.Errorf("prune: deleted %d (%v) want 1", deleted, err)
+	}
+	if err := sink.vacuum(); err != nil {
+		t.Errorf("vacuum: %v", err)
+	}
+
+	// Reopening an existing database keeps the data and adds the columns of the raw values
+	sink.db.Close()
+	sink, err = newSQLiteSink(config.SQLitePublisher{Path: path}, []string{"temperature"})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	var count int
+	if err := sink.db.QueryRow("SELECT count(*) FROM ruuvi_measurements").Scan(&count); err != nil || count != 1 {
+		t.Errorf("count: got %d (%v) want 1", count, err)
+	}
+	smoothed := testMeasurement()
+	smoothed.Raw = map[string]float64{"temperature": 21.9}
+	if err := sink.write([]timedMeasurement{{measurement: smoothed, time: now}}); err != nil {
+		t.Fatalf("write smoothed: %v", err)
+	}
+	var raw float64
+	if err := sink.db.QueryRow("SELECT temperature_raw FROM ruuvi_measurements WHERE temperature_raw IS NOT NULL").Scan(&raw); err != nil || raw != 21.9 {
+		t.Errorf("raw value: got %v (%v)", raw, err)
+	}
+
+	// An aggregation window adds the columns of the statistics to the existing table
+	sink.db.Close()
+	sink, err = newSQLiteSink(config.SQLitePublisher{Path: path, SinkOptions: config.SinkOptions{AggregationWindow: config.Duration(time.Minute)}}, nil)
+	if err != nil {
+		t.Fatalf("reopen with aggregation: %v", err)
+	}
+	defer sink.db.Close()
+	aggregated := testMeasurement()
+	aggregated.Aggregates = map[string]parser.Aggregate{"temperature": {Min: 20, Max: 23, Mean: 21.5, Count: 4}}
+	if err := sink.write([]timedMeasurement{{measurement: aggregated, time: now.Add(time.Minute)}}); err != nil {
+		t.Fatalf("write aggregated: %v", err)
+	}
+	var minimum float64
+	var samples int64
+	row = sink.db.QueryRow(`SELECT temperature_min, temperature_count FROM ruuvi_measurements ORDER BY time DESC`)
+	if err := row.Scan(&minimum, &samples); err != nil || minimum != 20 || samples != 4 {
+		t.Errorf("statistics: got %v %v (%v)", minimum, samples, err)
+	}
+}
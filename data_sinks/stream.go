@@ -0,0 +1,66 @@
+package data_sinks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+// newTLSConfig returns the client TLS configuration of the streaming sinks, nil when TLS is disabled
+func newTLSConfig(conf *config.TLS) (*tls.Config, error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+	tlsConf := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.CAFile)
+		}
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
+
+// subjectTemplate renders Kafka topics and NATS subjects with the same data as the MQTT topic templates
+type subjectTemplate struct {
+	templates *mqttTemplates
+	sanitize  func(string) string
+}
+
+func newSubjectTemplate(name string, text string, fallback string, sanitize func(string) string) subjectTemplate {
+	return subjectTemplate{
+		templates: &mqttTemplates{topic: parseMQTTTemplate(name, text, fallback)},
+		sanitize:  sanitize,
+	}
+}
+
+func (t subjectTemplate) render(m parser.Measurement) (string, error) {
+	subject, err := renderMQTTTemplate(t.templates.topic, t.templates.data(m))
+	if err != nil {
+		return "", err
+	}
+	subject = t.sanitize(subject)
+	if subject == "" {
+		return "", fmt.Errorf("template %s rendered an empty name", t.templates.topic.Name())
+	}
+	return subject, nil
+}
@@ -4,55 +4,122 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/Saavuori/ruuvi-go-gateway/common/metrics"
 	"github.com/Saavuori/ruuvi-go-gateway/config"
 	"github.com/Saavuori/ruuvi-go-gateway/data_sinks"
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
 	"github.com/Saavuori/ruuvi-go-gateway/server"
 	"github.com/Saavuori/ruuvi-go-gateway/service/matter"
 	"github.com/Saavuori/ruuvi-go-gateway/value_calculator"
+	"github.com/Saavuori/ruuvi-go-gateway/value_smoother"
 	"github.com/rigado/ble"
 	log "github.com/sirupsen/logrus"
 )
 
-func Run(config config.Config, configPath string) {
+func Run(conf config.Config, configPath string) {
 	// Start Matter Bridge
-	matterBridge := matter.New(config.Matter)
+	matterBridge := matter.New(conf.Matter)
 	if err := matterBridge.Start(); err != nil {
 		log.WithError(err).Error("Failed to start Matter bridge")
 	}
 
 	// Start Management Web UI
-	server.Start(config, configPath, matterBridge)
+	server.Start(conf, configPath, matterBridge)
 
 	// Initialize enabled tags state for live updating (no restart required)
-	server.InitEnabledTags(config.EnabledTags)
+	server.InitEnabledTags(conf.EnabledTags)
+	server.InitTagNames(conf.TagNames)
 
-	gwMac := config.GwMac
+	gwMac := conf.GwMac
 	if gwMac == "" {
 		gwMac = "00:00:00:00:00:00"
 	}
 
 	// New Sinks Setup (Legacy MQTT/HTTP senders have been removed)
-	var sinks []chan<- parser.Measurement
-	if config.MQTTPublisher != nil && (config.MQTTPublisher.Enabled == nil || *config.MQTTPublisher.Enabled) {
-		sinks = append(sinks, data_sinks.MQTT(*config.MQTTPublisher, config.TagNames))
+	var sinks []sink
+	addSink := func(name string, filter *config.SinkFilter, aggregationWindow config.Duration, ch chan<- parser.Measurement) {
+		// The queue of the sink itself, not of the aggregator in front of it
+		queue := ch
+		metrics.RegisterSinkQueue(name, func() int { return len(queue) })
+		if aggregationWindow > 0 {
+			ch = data_sinks.Aggregate(name, time.Duration(aggregationWindow), ch)
+		}
+		sinks = append(sinks, sink{name: name, filter: data_sinks.NewFilter(filter, conf.TagGroups), ch: ch})
+	}
+	enabled := func(e *bool) bool { return e == nil || *e }
+	// The SQL sinks create the columns of the unfiltered values up front
+	var rawFields []string
+	if conf.Processing != nil {
+		rawFields = conf.Processing.Smoothing.RawFields()
+	}
+	for _, p := range conf.MQTTPublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("mqtt", p.Name), p.Filter, p.AggregationWindow, data_sinks.MQTT(p, server.Control{}))
+		}
+	}
+	for _, p := range conf.KafkaPublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("kafka", p.Name), p.Filter, p.AggregationWindow, data_sinks.Kafka(p))
+		}
+	}
+	for _, p := range conf.NATSPublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("nats", p.Name), p.Filter, p.AggregationWindow, data_sinks.NATS(p))
+		}
+	}
+	for _, p := range conf.InfluxDBPublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("influxdb", p.Name), p.Filter, p.AggregationWindow, data_sinks.InfluxDB(p))
+		}
+	}
+	for _, p := range conf.InfluxDB3PublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("influxdb3", p.Name), p.Filter, p.AggregationWindow, data_sinks.InfluxDB3(p))
+		}
+	}
+	for _, p := range conf.InfluxDB1PublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("influxdb1", p.Name), p.Filter, p.AggregationWindow, data_sinks.InfluxDB1(p))
+		}
+	}
+	for _, p := range conf.PostgresPublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("postgres", p.Name), p.Filter, p.AggregationWindow, data_sinks.Postgres(p, conf.TagNames, rawFields))
+		}
+	}
+	for _, p := range conf.SQLitePublisherInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("sqlite", p.Name), p.Filter, p.AggregationWindow, data_sinks.SQLite(p, rawFields))
+		}
 	}
-	if config.InfluxDBPublisher != nil && (config.InfluxDBPublisher.Enabled == nil || *config.InfluxDBPublisher.Enabled) {
-		sinks = append(sinks, data_sinks.InfluxDB(*config.InfluxDBPublisher))
+	// The Prometheus metrics are registered globally, so there is only one instance
+	if conf.Prometheus != nil && enabled(conf.Prometheus.Enabled) {
+		addSink("prometheus", conf.Prometheus.Filter, conf.Prometheus.AggregationWindow, data_sinks.Prometheus(*conf.Prometheus))
 	}
-	if config.InfluxDB3Publisher != nil && (config.InfluxDB3Publisher.Enabled == nil || *config.InfluxDB3Publisher.Enabled) {
-		sinks = append(sinks, data_sinks.InfluxDB3(*config.InfluxDB3Publisher))
+	for _, p := range conf.PrometheusRemoteWriteInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("prometheus_remote_write", p.Name), p.Filter, p.AggregationWindow, data_sinks.PrometheusRemoteWrite(p))
+		}
 	}
-	if config.Prometheus != nil && (config.Prometheus.Enabled == nil || *config.Prometheus.Enabled) {
-		sinks = append(sinks, data_sinks.Prometheus(*config.Prometheus))
+	for _, p := range conf.OTLPInstances() {
+		if enabled(p.Enabled) {
+			addSink(config.SinkName("otlp", p.Name), p.Filter, p.AggregationWindow, data_sinks.OTLP(p))
+		}
 	}
 
 	if len(sinks) == 0 {
 		log.Warn("No sinks configured. Configure via Web UI.")
 	}
 
+	var smoother *value_smoother.Smoother
+	if conf.Processing != nil {
+		smoother = value_smoother.New(conf.Processing.Smoothing)
+	}
+
 	advHandler := func(adv ble.Advertisement) {
+		metrics.AdvertisementsReceived.Inc()
 		data := adv.ManufacturerData()
 		if len(data) > 2 {
 			isRuuvi := data[0] == 0x99 && data[1] == 0x04 // ruuvi company identifier
@@ -69,21 +136,31 @@ func Run(config config.Config, configPath string) {
 				"data":     fmt.Sprintf("%X", data),
 			}).Trace("Received data from BLE adapter")
 
-			if config.AllAdvertisements || isRuuvi {
+			if conf.AllAdvertisements || isRuuvi {
 				// Parse measurement (always needed for Web UI)
 				measurement, ok := parser.Parse(rawInput)
+				if !ok && isRuuvi {
+					metrics.ParseFailures.WithLabelValues(fmt.Sprintf("%X", data[2])).Inc()
+				}
 				if ok {
 					measurement.Mac = strings.ToUpper(adv.Addr().String())
 					measurement.Rssi = i64(int64(adv.RSSI()))
 
 					// Name priority: Config > Advertisement > Default
-					if name, ok := config.TagNames[measurement.Mac]; ok {
+					if name, ok := server.GetTagName(measurement.Mac); ok {
 						measurement.Name = &name
 					} else if adv.LocalName() != "" {
 						n := adv.LocalName()
 						measurement.Name = &n
 					}
 
+					// Smooth only the enabled tags, the smoother keeps state for every tag it is given.
+					// The extended values are calculated from the smoothed values, and the Web UI and
+					// the Matter bridge show the same values as the sinks.
+					tagEnabled := server.IsTagEnabled(measurement.Mac)
+					if tagEnabled {
+						measurement = smoother.Apply(measurement)
+					}
 					value_calculator.CalcExtendedValues(&measurement)
 
 					// Update Web UI Cache (always, for discovery)
@@ -95,11 +172,16 @@ func Run(config config.Config, configPath string) {
 					}
 
 					// Send to sinks only if tag is enabled (checked from live state)
-					if server.IsTagEnabled(measurement.Mac) {
+					if tagEnabled {
 						for _, sink := range sinks {
+							filtered, ok := sink.filter.Apply(measurement)
+							if !ok {
+								continue
+							}
 							select {
-							case sink <- measurement:
+							case sink.ch <- filtered:
 							default:
+								metrics.SinkDrops.WithLabelValues(sink.name).Inc()
 							}
 						}
 					}
@@ -108,21 +190,34 @@ func Run(config config.Config, configPath string) {
 		}
 	}
 
-	if config.UseMock {
+	if conf.UseMock {
 		MockScan(advHandler)
 		return
 	}
 
-	device, err := newDevice(config)
+	device, err := newDevice(conf)
 	if err != nil {
 		log.Fatal(err)
 	}
 	ble.SetDefaultDevice(device)
 
-	err = ble.Scan(context.Background(), true, advHandler, nil)
-	if err != nil {
-		log.WithError(err).Error("Failed to scan")
+	for {
+		err = ble.Scan(context.Background(), true, advHandler, nil)
+		if err != nil {
+			log.WithError(err).Error("Failed to scan")
+		}
+		metrics.ScanRestarts.Inc()
+		log.WithField("delay", scanRestartDelay).Warn("BLE scan stopped, restarting")
+		time.Sleep(scanRestartDelay)
 	}
 }
 
+const scanRestartDelay = 5 * time.Second
+
+type sink struct {
+	name   string
+	filter *data_sinks.Filter
+	ch     chan<- parser.Measurement
+}
+
 func i64(v int64) *int64 { return &v }
@@ -14,6 +14,12 @@ import path from "path";
 const CONFIG_PATH = process.env.CONFIG_PATH || "/app/config.yml";
 const STORAGE_PATH = process.env.STORAGE_PATH || "data";
 const GATEWAY_API = process.env.GATEWAY_API || "http://localhost:8080/api/tags";
+const GATEWAY_STREAM = process.env.GATEWAY_STREAM || GATEWAY_API.replace(/\/tags$/, "/stream");
+// A read-only API token, needed when auth is enabled in the gateway
+const GATEWAY_TOKEN = process.env.GATEWAY_TOKEN;
+const GATEWAY_HEADERS = GATEWAY_TOKEN ? { Authorization: `Bearer ${GATEWAY_TOKEN}` } : undefined;
+// The gateway sends a heartbeat every 15 seconds, reconnect when nothing arrives for longer
+const STREAM_IDLE_TIMEOUT = 45000;
 
 interface RuuviTag {
     mac: string;
@@ -56,6 +62,9 @@ async function main() {
             const yamlConfig = yaml.load(fileContents) as any;
             if (yamlConfig && yamlConfig.matter) {
                 config.matter = { ...config.matter, ...yamlConfig.matter };
+                if (yamlConfig.matter.passcode_file) {
+                    config.matter.passcode = parseInt(fs.readFileSync(yamlConfig.matter.passcode_file, 'utf8').trim(), 10);
+                }
             }
         } catch (e) {
             console.error("Failed to load config.yml, using defaults", e);
@@ -144,60 +153,95 @@ async function main() {
         return;
     }
 
-    const updateLoop = async () => {
+    const applyTag = async (tag: RuuviTag) => {
+        const uniqueId = "ruuvi-" + tag.mac.replace(/:/g, "").toLowerCase();
+        const tempVal = tag.temperature;
+
+        // Check if device exists
+        let device = bridge.parts.get(uniqueId);
+
+        if (!device && tempVal !== undefined) {
+            console.log(`Adding new device: ${tag.mac}`);
+
+            // Add new endpoint part to the bridge
+            // @ts-ignore
+            device = await bridge.parts.add({
+                type: BridgedRuuviTag,
+                id: uniqueId,
+                bridgedDeviceBasicInformation: {
+                    nodeLabel: `RuuviTag ${tag.mac}`,
+                    serialNumber: tag.mac.replace(/:/g, ""),
+                    productName: "RuuviTag",
+                    reachable: true,
+                    vendorId: config.matter.vendor_id,
+                }
+            } as any);
+        } else if (device && tempVal !== undefined) {
+            // Update state
+            // ServerNode Endpoint API
+            // @ts-ignore
+            await (device as any).set({
+                temperatureMeasurement: {
+                    measuredValue: Math.round(tempVal * 100)
+                },
+                relativeHumidityMeasurement: {
+                    measuredValue: tag.humidity !== undefined ? Math.round(tag.humidity * 100) : 0
+                },
+                pressureMeasurement: {
+                    // Pressure is in hPa from RuuviTag, Matter expects 10 Pa units (kPa * 10)
+                    measuredValue: tag.pressure !== undefined ? Math.round(tag.pressure * 10) : null
+                }
+            });
+        }
+    };
+
+    // Full state on every (re)connect, then live updates from the Server-Sent Events stream
+    const streamLoop = async () => {
+        const controller = new AbortController();
+        let idleTimer: NodeJS.Timeout | undefined;
+        const resetIdleTimer = () => {
+            clearTimeout(idleTimer);
+            idleTimer = setTimeout(() => controller.abort(), STREAM_IDLE_TIMEOUT);
+        };
         try {
-            const response = await axios.get<RuuviTag[]>(GATEWAY_API);
-            const tags = response.data;
-
-            for (const tag of tags) {
-                const uniqueId = "ruuvi-" + tag.mac.replace(/:/g, "").toLowerCase();
-                const tempVal = tag.temperature;
-
-                // Check if device exists
-                let device = bridge.parts.get(uniqueId);
-
-                if (!device && tempVal !== undefined) {
-                    console.log(`Adding new device: ${tag.mac}`);
-
-                    // Add new endpoint part to the bridge
-                    // @ts-ignore
-                    device = await bridge.parts.add({
-                        type: BridgedRuuviTag,
-                        id: uniqueId,
-                        bridgedDeviceBasicInformation: {
-                            nodeLabel: `RuuviTag ${tag.mac}`,
-                            serialNumber: tag.mac.replace(/:/g, ""),
-                            productName: "RuuviTag",
-                            reachable: true,
-                            vendorId: config.matter.vendor_id,
-                        }
-                    } as any);
-                } else if (device && tempVal !== undefined) {
-                    // Update state
-                    // ServerNode Endpoint API
-                    // @ts-ignore
-                    await (device as any).set({
-                        temperatureMeasurement: {
-                            measuredValue: Math.round(tempVal * 100)
-                        },
-                        relativeHumidityMeasurement: {
-                            measuredValue: tag.humidity !== undefined ? Math.round(tag.humidity * 100) : 0
-                        },
-                        pressureMeasurement: {
-                            // Pressure is in hPa from RuuviTag, Matter expects 10 Pa units (kPa * 10)
-                            measuredValue: tag.pressure !== undefined ? Math.round(tag.pressure * 10) : null
-                        }
-                    });
+            const response = await axios.get<RuuviTag[]>(GATEWAY_API, { headers: GATEWAY_HEADERS });
+            for (const tag of response.data) {
+                await applyTag(tag);
+            }
+
+            resetIdleTimer();
+            const stream = await axios.get(`${GATEWAY_STREAM}?fields=temperature,humidity,pressure`, {
+                responseType: "stream",
+                signal: controller.signal,
+                headers: GATEWAY_HEADERS,
+            });
+            let buffer = "";
+            for await (const chunk of stream.data) {
+                resetIdleTimer();
+                buffer += chunk.toString();
+                let end;
+                while ((end = buffer.indexOf("\n\n")) !== -1) {
+                    const lines = buffer.slice(0, end).split("\n");
+                    buffer = buffer.slice(end + 2);
+                    // Tag updates are unnamed events, heartbeats are comments
+                    if (lines.some(line => line.startsWith("event:"))) continue;
+                    const data = lines.filter(line => line.startsWith("data:")).map(line => line.slice(5).trim()).join("\n");
+                    if (data) {
+                        await applyTag(JSON.parse(data) as RuuviTag);
+                    }
                 }
             }
+            console.error("Gateway stream closed, reconnecting");
         } catch (error) {
-            console.error("Error polling Gateway:", error instanceof Error ? error.message : "Unknown error");
+            console.error("Error streaming from Gateway:", error instanceof Error ? error.message : "Unknown error");
+        } finally {
+            clearTimeout(idleTimer);
         }
 
-        setTimeout(updateLoop, 5000);
+        setTimeout(streamLoop, 5000);
     };
 
-    updateLoop();
+    streamLoop();
 
     // 4. API for Local Frontend (Proxy)
     const app = express();
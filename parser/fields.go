@@ -0,0 +1,180 @@
+package parser
+
+import "strconv"
+
+type FieldKind int
+
+const (
+	FloatField FieldKind = iota
+	IntField
+	BoolField
+)
+
+// Field describes a single optional value of a Measurement, allowing sinks to
+// iterate over the measurement values without listing every field by hand.
+// Name matches the JSON name of the field.
+type Field struct {
+	Name string
+	Kind FieldKind
+
+	float func(m *Measurement) **float64
+	int   func(m *Measurement) **int64
+	bool  func(m *Measurement) **bool
+}
+
+func floatField(name string, ptr func(m *Measurement) **float64) Field {
+	return Field{Name: name, Kind: FloatField, float: ptr}
+}
+
+func intField(name string, ptr func(m *Measurement) **int64) Field {
+	return Field{Name: name, Kind: IntField, int: ptr}
+}
+
+func boolField(name string, ptr func(m *Measurement) **bool) Field {
+	return Field{Name: name, Kind: BoolField, bool: ptr}
+}
+
+// Fields lists all measurement values in the order they are published by the sinks
+var Fields = []Field{
+	floatField("temperature", func(m *Measurement) **float64 { return &m.Temperature }),
+	floatField("humidity", func(m *Measurement) **float64 { return &m.Humidity }),
+	floatField("pressure", func(m *Measurement) **float64 { return &m.Pressure }),
+	floatField("accelerationX", func(m *Measurement) **float64 { return &m.AccelerationX }),
+	floatField("accelerationY", func(m *Measurement) **float64 { return &m.AccelerationY }),
+	floatField("accelerationZ", func(m *Measurement) **float64 { return &m.AccelerationZ }),
+	floatField("batteryVoltage", func(m *Measurement) **float64 { return &m.BatteryVoltage }),
+	intField("txPower", func(m *Measurement) **int64 { return &m.TxPower }),
+	intField("rssi", func(m *Measurement) **int64 { return &m.Rssi }),
+	intField("movementCounter", func(m *Measurement) **int64 { return &m.MovementCounter }),
+	intField("measurementSequenceNumber", func(m *Measurement) **int64 { return &m.MeasurementSequenceNumber }),
+	floatField("accelerationTotal", func(m *Measurement) **float64 { return &m.AccelerationTotal }),
+	floatField("absoluteHumidity", func(m *Measurement) **float64 { return &m.AbsoluteHumidity }),
+	floatField("dewPoint", func(m *Measurement) **float64 { return &m.DewPoint }),
+	floatField("equilibriumVaporPressure", func(m *Measurement) **float64 { return &m.EquilibriumVaporPressure }),
+	floatField("airDensity", func(m *Measurement) **float64 { return &m.AirDensity }),
+	floatField("accelerationAngleFromX", func(m *Measurement) **float64 { return &m.AccelerationAngleFromX }),
+	floatField("accelerationAngleFromY", func(m *Measurement) **float64 { return &m.AccelerationAngleFromY }),
+	floatField("accelerationAngleFromZ", func(m *Measurement) **float64 { return &m.AccelerationAngleFromZ }),
+	// Air quality fields
+	floatField("pm1p0", func(m *Measurement) **float64 { return &m.Pm1p0 }),
+	floatField("pm2p5", func(m *Measurement) **float64 { return &m.Pm2p5 }),
+	floatField("pm4p0", func(m *Measurement) **float64 { return &m.Pm4p0 }),
+	floatField("pm10p0", func(m *Measurement) **float64 { return &m.Pm10p0 }),
+	floatField("co2", func(m *Measurement) **float64 { return &m.CO2 }),
+	floatField("voc", func(m *Measurement) **float64 { return &m.VOC }),
+	floatField("nox", func(m *Measurement) **float64 { return &m.NOX }),
+	floatField("illuminance", func(m *Measurement) **float64 { return &m.Illuminance }),
+	floatField("soundInstant", func(m *Measurement) **float64 { return &m.SoundInstant }),
+	floatField("soundAverage", func(m *Measurement) **float64 { return &m.SoundAverage }),
+	floatField("soundPeak", func(m *Measurement) **float64 { return &m.SoundPeak }),
+	floatField("airQualityIndex", func(m *Measurement) **float64 { return &m.AirQualityIndex }),
+	// Diagnostics
+	boolField("calibrationInProgress", func(m *Measurement) **bool { return &m.CalibrationInProgress }),
+	boolField("buttonPressedOnBoot", func(m *Measurement) **bool { return &m.ButtonPressedOnBoot }),
+	boolField("rtcOnBoot", func(m *Measurement) **bool { return &m.RtcOnBoot }),
+}
+
+// FieldByName returns the field with the given JSON name
+func FieldByName(name string) (Field, bool) {
+	for _, f := range Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Has reports whether the field is present on the measurement
+func (f Field) Has(m Measurement) bool {
+	switch f.Kind {
+	case FloatField:
+		return *f.float(&m) != nil
+	case IntField:
+		return *f.int(&m) != nil
+	default:
+		return *f.bool(&m) != nil
+	}
+}
+
+// Value returns the field value as float64, int64 or bool
+func (f Field) Value(m Measurement) (interface{}, bool) {
+	switch f.Kind {
+	case FloatField:
+		if v := *f.float(&m); v != nil {
+			return *v, true
+		}
+	case IntField:
+		if v := *f.int(&m); v != nil {
+			return *v, true
+		}
+	default:
+		if v := *f.bool(&m); v != nil {
+			return *v, true
+		}
+	}
+	return nil, false
+}
+
+// Float returns the field value as a float64, booleans being 1 or 0
+func (f Field) Float(m Measurement) (float64, bool) {
+	v, ok := f.Value(m)
+	if !ok {
+		return 0, false
+	}
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	default:
+		if value.(bool) {
+			return 1, true
+		}
+		return 0, true
+	}
+}
+
+// Format returns the field value formatted as a plain string
+func (f Field) Format(m Measurement) (string, bool) {
+	v, ok := f.Value(m)
+	if !ok {
+		return "", false
+	}
+	switch value := v.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	default:
+		return strconv.FormatBool(value.(bool)), true
+	}
+}
+
+// SetFloat sets the field from a float64, rounding it for integer fields
+func (f Field) SetFloat(m *Measurement, value float64) {
+	switch f.Kind {
+	case FloatField:
+		*f.float(m) = f64(value)
+	case IntField:
+		if value < 0 {
+			*f.int(m) = i64(int64(value - 0.5))
+		} else {
+			*f.int(m) = i64(int64(value + 0.5))
+		}
+	default:
+		b := value >= 0.5
+		*f.bool(m) = &b
+	}
+}
+
+// Clear removes the field from the measurement
+func (f Field) Clear(m *Measurement) {
+	switch f.Kind {
+	case FloatField:
+		*f.float(m) = nil
+	case IntField:
+		*f.int(m) = nil
+	default:
+		*f.bool(m) = nil
+	}
+}
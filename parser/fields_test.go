@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFields_MatchJSONNames(t *testing.T) {
+	var m Measurement
+	for _, f := range Fields {
+		f.SetFloat(&m, 1)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	if len(values) != len(Fields) {
+		t.Errorf("JSON field count: got %d want %d", len(values), len(Fields))
+	}
+	for _, f := range Fields {
+		if _, ok := values[f.Name]; !ok {
+			t.Errorf("Field %s not found in JSON", f.Name)
+		}
+	}
+}
+
+func TestFields_ValueAndClear(t *testing.T) {
+	m := Measurement{}
+	m.Temperature = f64(21.5)
+	m.Rssi = i64(-70)
+	tru := true
+	m.CalibrationInProgress = &tru
+
+	temperature, _ := FieldByName("temperature")
+	if v, ok := temperature.Format(m); !ok || v != "21.5" {
+		t.Errorf("temperature: got %q want %q", v, "21.5")
+	}
+	rssi, _ := FieldByName("rssi")
+	if v, ok := rssi.Float(m); !ok || v != -70 {
+		t.Errorf("rssi: got %v want %v", v, -70)
+	}
+	calibration, _ := FieldByName("calibrationInProgress")
+	if v, ok := calibration.Float(m); !ok || v != 1 {
+		t.Errorf("calibrationInProgress: got %v want %v", v, 1)
+	}
+	humidity, _ := FieldByName("humidity")
+	if humidity.Has(m) {
+		t.Errorf("humidity: expected missing value")
+	}
+
+	temperature.Clear(&m)
+	if m.Temperature != nil {
+		t.Errorf("temperature: expected cleared value, got %v", *m.Temperature)
+	}
+	rssi.SetFloat(&m, -80.6)
+	if m.Rssi == nil || *m.Rssi != -81 {
+		t.Errorf("rssi: got %v want %v", m.Rssi, -81)
+	}
+	if _, ok := FieldByName("nonexistent"); ok {
+		t.Errorf("FieldByName returned a field for an unknown name")
+	}
+}
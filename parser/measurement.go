@@ -7,6 +7,8 @@ type Measurement struct {
 	DiagnosticsData
 	UnofficialData
 	CalculatedData
+	AggregatedData
+	RawData
 }
 
 // Common data for all measurements
@@ -70,3 +72,21 @@ type CalculatedData struct {
 	AccelerationAngleFromZ   *float64 `json:"accelerationAngleFromZ,omitempty"`
 	AirQualityIndex          *float64 `json:"airQualityIndex,omitempty"`
 }
+
+// Statistics of a field over an aggregation window
+type Aggregate struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	Count int64   `json:"count"`
+}
+
+// Data only on measurements aggregated over a window, the fields hold the means
+type AggregatedData struct {
+	Aggregates map[string]Aggregate `json:"aggregates,omitempty"`
+}
+
+// Unfiltered values of the smoothed fields, only when the raw values are published
+type RawData struct {
+	Raw map[string]float64 `json:"raw,omitempty"`
+}
@@ -0,0 +1,1088 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: ruuvi/gateway/v1/gateway.proto
+
+package gatewayv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Tag is the latest state of a tag. The measurement field names are the same as in the /api/tags JSON.
+type Tag struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Uppercase, colon separated MAC address, eg. AA:BB:CC:DD:EE:FF
+	Mac string `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	// Configured name, empty when the tag has no name
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Whether the measurements of the tag are sent to the sinks
+	Enabled                   bool                   `protobuf:"varint,3,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	LastSeen                  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Rssi                      int64                  `protobuf:"varint,5,opt,name=rssi,proto3" json:"rssi,omitempty"`
+	DataFormat                int64                  `protobuf:"varint,6,opt,name=data_format,json=dataFormat,proto3" json:"data_format,omitempty"`
+	Temperature               *float64               `protobuf:"fixed64,10,opt,name=temperature,proto3,oneof" json:"temperature,omitempty"`
+	Humidity                  *float64               `protobuf:"fixed64,11,opt,name=humidity,proto3,oneof" json:"humidity,omitempty"`
+	Pressure                  *float64               `protobuf:"fixed64,12,opt,name=pressure,proto3,oneof" json:"pressure,omitempty"`
+	BatteryVoltage            *float64               `protobuf:"fixed64,13,opt,name=battery_voltage,json=batteryVoltage,proto3,oneof" json:"battery_voltage,omitempty"`
+	TxPower                   *int64                 `protobuf:"varint,14,opt,name=tx_power,json=txPower,proto3,oneof" json:"tx_power,omitempty"`
+	MovementCounter           *int64                 `protobuf:"varint,15,opt,name=movement_counter,json=movementCounter,proto3,oneof" json:"movement_counter,omitempty"`
+	MeasurementSequenceNumber *int64                 `protobuf:"varint,16,opt,name=measurement_sequence_number,json=measurementSequenceNumber,proto3,oneof" json:"measurement_sequence_number,omitempty"`
+	// Ruuvi Air (data formats 6 and E1)
+	Pm1P0           *float64 `protobuf:"fixed64,20,opt,name=pm1p0,proto3,oneof" json:"pm1p0,omitempty"`
+	Pm2P5           *float64 `protobuf:"fixed64,21,opt,name=pm2p5,proto3,oneof" json:"pm2p5,omitempty"`
+	Pm4P0           *float64 `protobuf:"fixed64,22,opt,name=pm4p0,proto3,oneof" json:"pm4p0,omitempty"`
+	Pm10P0          *float64 `protobuf:"fixed64,23,opt,name=pm10p0,proto3,oneof" json:"pm10p0,omitempty"`
+	Co2             *float64 `protobuf:"fixed64,24,opt,name=co2,proto3,oneof" json:"co2,omitempty"`
+	Voc             *float64 `protobuf:"fixed64,25,opt,name=voc,proto3,oneof" json:"voc,omitempty"`
+	Nox             *float64 `protobuf:"fixed64,26,opt,name=nox,proto3,oneof" json:"nox,omitempty"`
+	Illuminance     *float64 `protobuf:"fixed64,27,opt,name=illuminance,proto3,oneof" json:"illuminance,omitempty"`
+	SoundInstant    *float64 `protobuf:"fixed64,28,opt,name=sound_instant,json=soundInstant,proto3,oneof" json:"sound_instant,omitempty"`
+	SoundAverage    *float64 `protobuf:"fixed64,29,opt,name=sound_average,json=soundAverage,proto3,oneof" json:"sound_average,omitempty"`
+	SoundPeak       *float64 `protobuf:"fixed64,30,opt,name=sound_peak,json=soundPeak,proto3,oneof" json:"sound_peak,omitempty"`
+	AirQualityIndex *float64 `protobuf:"fixed64,31,opt,name=air_quality_index,json=airQualityIndex,proto3,oneof" json:"air_quality_index,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Tag) Reset() {
+	*x = Tag{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tag) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tag) ProtoMessage() {}
+
+func (x *Tag) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tag.ProtoReflect.Descriptor instead.
+func (*Tag) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Tag) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *Tag) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Tag) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *Tag) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *Tag) GetRssi() int64 {
+	if x != nil {
+		return x.Rssi
+	}
+	return 0
+}
+
+func (x *Tag) GetDataFormat() int64 {
+	if x != nil {
+		return x.DataFormat
+	}
+	return 0
+}
+
+func (x *Tag) GetTemperature() float64 {
+	if x != nil && x.Temperature != nil {
+		return *x.Temperature
+	}
+	return 0
+}
+
+func (x *Tag) GetHumidity() float64 {
+	if x != nil && x.Humidity != nil {
+		return *x.Humidity
+	}
+	return 0
+}
+
+func (x *Tag) GetPressure() float64 {
+	if x != nil && x.Pressure != nil {
+		return *x.Pressure
+	}
+	return 0
+}
+
+func (x *Tag) GetBatteryVoltage() float64 {
+	if x != nil && x.BatteryVoltage != nil {
+		return *x.BatteryVoltage
+	}
+	return 0
+}
+
+func (x *Tag) GetTxPower() int64 {
+	if x != nil && x.TxPower != nil {
+		return *x.TxPower
+	}
+	return 0
+}
+
+func (x *Tag) GetMovementCounter() int64 {
+	if x != nil && x.MovementCounter != nil {
+		return *x.MovementCounter
+	}
+	return 0
+}
+
+func (x *Tag) GetMeasurementSequenceNumber() int64 {
+	if x != nil && x.MeasurementSequenceNumber != nil {
+		return *x.MeasurementSequenceNumber
+	}
+	return 0
+}
+
+func (x *Tag) GetPm1P0() float64 {
+	if x != nil && x.Pm1P0 != nil {
+		return *x.Pm1P0
+	}
+	return 0
+}
+
+func (x *Tag) GetPm2P5() float64 {
+	if x != nil && x.Pm2P5 != nil {
+		return *x.Pm2P5
+	}
+	return 0
+}
+
+func (x *Tag) GetPm4P0() float64 {
+	if x != nil && x.Pm4P0 != nil {
+		return *x.Pm4P0
+	}
+	return 0
+}
+
+func (x *Tag) GetPm10P0() float64 {
+	if x != nil && x.Pm10P0 != nil {
+		return *x.Pm10P0
+	}
+	return 0
+}
+
+func (x *Tag) GetCo2() float64 {
+	if x != nil && x.Co2 != nil {
+		return *x.Co2
+	}
+	return 0
+}
+
+func (x *Tag) GetVoc() float64 {
+	if x != nil && x.Voc != nil {
+		return *x.Voc
+	}
+	return 0
+}
+
+func (x *Tag) GetNox() float64 {
+	if x != nil && x.Nox != nil {
+		return *x.Nox
+	}
+	return 0
+}
+
+func (x *Tag) GetIlluminance() float64 {
+	if x != nil && x.Illuminance != nil {
+		return *x.Illuminance
+	}
+	return 0
+}
+
+func (x *Tag) GetSoundInstant() float64 {
+	if x != nil && x.SoundInstant != nil {
+		return *x.SoundInstant
+	}
+	return 0
+}
+
+func (x *Tag) GetSoundAverage() float64 {
+	if x != nil && x.SoundAverage != nil {
+		return *x.SoundAverage
+	}
+	return 0
+}
+
+func (x *Tag) GetSoundPeak() float64 {
+	if x != nil && x.SoundPeak != nil {
+		return *x.SoundPeak
+	}
+	return 0
+}
+
+func (x *Tag) GetAirQualityIndex() float64 {
+	if x != nil && x.AirQualityIndex != nil {
+		return *x.AirQualityIndex
+	}
+	return 0
+}
+
+type StreamMeasurementsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only these tags, all tags when empty
+	Macs []string `protobuf:"bytes,1,rep,name=macs,proto3" json:"macs,omitempty"`
+	// Only these measurement fields, eg. temperature, all fields when empty.
+	// mac, name, enabled and last_seen are always included.
+	Fields []string `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty"`
+	// Send the current state of the matching tags first
+	Snapshot      bool `protobuf:"varint,3,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMeasurementsRequest) Reset() {
+	*x = StreamMeasurementsRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMeasurementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMeasurementsRequest) ProtoMessage() {}
+
+func (x *StreamMeasurementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMeasurementsRequest.ProtoReflect.Descriptor instead.
+func (*StreamMeasurementsRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamMeasurementsRequest) GetMacs() []string {
+	if x != nil {
+		return x.Macs
+	}
+	return nil
+}
+
+func (x *StreamMeasurementsRequest) GetFields() []string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *StreamMeasurementsRequest) GetSnapshot() bool {
+	if x != nil {
+		return x.Snapshot
+	}
+	return false
+}
+
+type StreamMeasurementsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Tag   *Tag                   `protobuf:"bytes,1,opt,name=tag,proto3" json:"tag,omitempty"`
+	// Number of updates replaced by newer ones before this client received them, since the previous response
+	Coalesced     uint64 `protobuf:"varint,2,opt,name=coalesced,proto3" json:"coalesced,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMeasurementsResponse) Reset() {
+	*x = StreamMeasurementsResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMeasurementsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMeasurementsResponse) ProtoMessage() {}
+
+func (x *StreamMeasurementsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMeasurementsResponse.ProtoReflect.Descriptor instead.
+func (*StreamMeasurementsResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamMeasurementsResponse) GetTag() *Tag {
+	if x != nil {
+		return x.Tag
+	}
+	return nil
+}
+
+func (x *StreamMeasurementsResponse) GetCoalesced() uint64 {
+	if x != nil {
+		return x.Coalesced
+	}
+	return 0
+}
+
+type ListTagsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTagsRequest) Reset() {
+	*x = ListTagsRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTagsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTagsRequest) ProtoMessage() {}
+
+func (x *ListTagsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTagsRequest.ProtoReflect.Descriptor instead.
+func (*ListTagsRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{3}
+}
+
+type ListTagsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tags          []*Tag                 `protobuf:"bytes,1,rep,name=tags,proto3" json:"tags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTagsResponse) Reset() {
+	*x = ListTagsResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTagsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTagsResponse) ProtoMessage() {}
+
+func (x *ListTagsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTagsResponse.ProtoReflect.Descriptor instead.
+func (*ListTagsResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListTagsResponse) GetTags() []*Tag {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+type GetTagRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mac           string                 `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTagRequest) Reset() {
+	*x = GetTagRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTagRequest) ProtoMessage() {}
+
+func (x *GetTagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTagRequest.ProtoReflect.Descriptor instead.
+func (*GetTagRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetTagRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+type GetTagResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tag           *Tag                   `protobuf:"bytes,1,opt,name=tag,proto3" json:"tag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTagResponse) Reset() {
+	*x = GetTagResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTagResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTagResponse) ProtoMessage() {}
+
+func (x *GetTagResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTagResponse.ProtoReflect.Descriptor instead.
+func (*GetTagResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetTagResponse) GetTag() *Tag {
+	if x != nil {
+		return x.Tag
+	}
+	return nil
+}
+
+type SetTagNameRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mac           string                 `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTagNameRequest) Reset() {
+	*x = SetTagNameRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTagNameRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTagNameRequest) ProtoMessage() {}
+
+func (x *SetTagNameRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTagNameRequest.ProtoReflect.Descriptor instead.
+func (*SetTagNameRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetTagNameRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *SetTagNameRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type SetTagNameResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// All tag names by MAC after the change
+	TagNames      map[string]string `protobuf:"bytes,1,rep,name=tag_names,json=tagNames,proto3" json:"tag_names,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTagNameResponse) Reset() {
+	*x = SetTagNameResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTagNameResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTagNameResponse) ProtoMessage() {}
+
+func (x *SetTagNameResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTagNameResponse.ProtoReflect.Descriptor instead.
+func (*SetTagNameResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetTagNameResponse) GetTagNames() map[string]string {
+	if x != nil {
+		return x.TagNames
+	}
+	return nil
+}
+
+type SetTagEnabledRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mac           string                 `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	Enabled       bool                   `protobuf:"varint,2,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTagEnabledRequest) Reset() {
+	*x = SetTagEnabledRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTagEnabledRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTagEnabledRequest) ProtoMessage() {}
+
+func (x *SetTagEnabledRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTagEnabledRequest.ProtoReflect.Descriptor instead.
+func (*SetTagEnabledRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SetTagEnabledRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *SetTagEnabledRequest) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+type SetTagEnabledResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// All enabled tags after the change, empty means every tag is enabled
+	EnabledTags   []string `protobuf:"bytes,1,rep,name=enabled_tags,json=enabledTags,proto3" json:"enabled_tags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTagEnabledResponse) Reset() {
+	*x = SetTagEnabledResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTagEnabledResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTagEnabledResponse) ProtoMessage() {}
+
+func (x *SetTagEnabledResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTagEnabledResponse.ProtoReflect.Descriptor instead.
+func (*SetTagEnabledResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SetTagEnabledResponse) GetEnabledTags() []string {
+	if x != nil {
+		return x.EnabledTags
+	}
+	return nil
+}
+
+type GetConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigRequest) Reset() {
+	*x = GetConfigRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigRequest) ProtoMessage() {}
+
+func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{11}
+}
+
+type GetConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Config        *structpb.Struct       `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse) Reset() {
+	*x = GetConfigResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse) ProtoMessage() {}
+
+func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetConfigResponse) GetConfig() *structpb.Struct {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type UpdateConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Config        *structpb.Struct       `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateConfigRequest) Reset() {
+	*x = UpdateConfigRequest{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateConfigRequest) ProtoMessage() {}
+
+func (x *UpdateConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateConfigRequest.ProtoReflect.Descriptor instead.
+func (*UpdateConfigRequest) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UpdateConfigRequest) GetConfig() *structpb.Struct {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type UpdateConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateConfigResponse) Reset() {
+	*x = UpdateConfigResponse{}
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateConfigResponse) ProtoMessage() {}
+
+func (x *UpdateConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ruuvi_gateway_v1_gateway_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateConfigResponse.ProtoReflect.Descriptor instead.
+func (*UpdateConfigResponse) Descriptor() ([]byte, []int) {
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP(), []int{14}
+}
+
+var File_ruuvi_gateway_v1_gateway_proto protoreflect.FileDescriptor
+
+const file_ruuvi_gateway_v1_gateway_proto_rawDesc = "" +
+	"\n" +
+	"\x1eruuvi/gateway/v1/gateway.proto\x12\x10ruuvi.gateway.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xfc\b\n" +
+	"\x03Tag\x12\x10\n" +
+	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\aenabled\x18\x03 \x01(\bR\aenabled\x127\n" +
+	"\tlast_seen\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\x12\x12\n" +
+	"\x04rssi\x18\x05 \x01(\x03R\x04rssi\x12\x1f\n" +
+	"\vdata_format\x18\x06 \x01(\x03R\n" +
+	"dataFormat\x12%\n" +
+	"\vtemperature\x18\n" +
+	" \x01(\x01H\x00R\vtemperature\x88\x01\x01\x12\x1f\n" +
+	"\bhumidity\x18\v \x01(\x01H\x01R\bhumidity\x88\x01\x01\x12\x1f\n" +
+	"\bpressure\x18\f \x01(\x01H\x02R\bpressure\x88\x01\x01\x12,\n" +
+	"\x0fbattery_voltage\x18\r \x01(\x01H\x03R\x0ebatteryVoltage\x88\x01\x01\x12\x1e\n" +
+	"\btx_power\x18\x0e \x01(\x03H\x04R\atxPower\x88\x01\x01\x12.\n" +
+	"\x10movement_counter\x18\x0f \x01(\x03H\x05R\x0fmovementCounter\x88\x01\x01\x12C\n" +
+	"\x1bmeasurement_sequence_number\x18\x10 \x01(\x03H\x06R\x19measurementSequenceNumber\x88\x01\x01\x12\x19\n" +
+	"\x05pm1p0\x18\x14 \x01(\x01H\aR\x05pm1p0\x88\x01\x01\x12\x19\n" +
+	"\x05pm2p5\x18\x15 \x01(\x01H\bR\x05pm2p5\x88\x01\x01\x12\x19\n" +
+	"\x05pm4p0\x18\x16 \x01(\x01H\tR\x05pm4p0\x88\x01\x01\x12\x1b\n" +
+	"\x06pm10p0\x18\x17 \x01(\x01H\n" +
+	"R\x06pm10p0\x88\x01\x01\x12\x15\n" +
+	"\x03co2\x18\x18 \x01(\x01H\vR\x03co2\x88\x01\x01\x12\x15\n" +
+	"\x03voc\x18\x19 \x01(\x01H\fR\x03voc\x88\x01\x01\x12\x15\n" +
+	"\x03nox\x18\x1a \x01(\x01H\rR\x03nox\x88\x01\x01\x12%\n" +
+	"\villuminance\x18\x1b \x01(\x01H\x0eR\villuminance\x88\x01\x01\x12(\n" +
+	"\rsound_instant\x18\x1c \x01(\x01H\x0fR\fsoundInstant\x88\x01\x01\x12(\n" +
+	"\rsound_average\x18\x1d \x01(\x01H\x10R\fsoundAverage\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"sound_peak\x18\x1e \x01(\x01H\x11R\tsoundPeak\x88\x01\x01\x12/\n" +
+	"\x11air_quality_index\x18\x1f \x01(\x01H\x12R\x0fairQualityIndex\x88\x01\x01B\x0e\n" +
+	"\f_temperatureB\v\n" +
+	"\t_humidityB\v\n" +
+	"\t_pressureB\x12\n" +
+	"\x10_battery_voltageB\v\n" +
+	"\t_tx_powerB\x13\n" +
+	"\x11_movement_counterB\x1e\n" +
+	"\x1c_measurement_sequence_numberB\b\n" +
+	"\x06_pm1p0B\b\n" +
+	"\x06_pm2p5B\b\n" +
+	"\x06_pm4p0B\t\n" +
+	"\a_pm10p0B\x06\n" +
+	"\x04_co2B\x06\n" +
+	"\x04_vocB\x06\n" +
+	"\x04_noxB\x0e\n" +
+	"\f_illuminanceB\x10\n" +
+	"\x0e_sound_instantB\x10\n" +
+	"\x0e_sound_averageB\r\n" +
+	"\v_sound_peakB\x14\n" +
+	"\x12_air_quality_index\"c\n" +
+	"\x19StreamMeasurementsRequest\x12\x12\n" +
+	"\x04macs\x18\x01 \x03(\tR\x04macs\x12\x16\n" +
+	"\x06fields\x18\x02 \x03(\tR\x06fields\x12\x1a\n" +
+	"\bsnapshot\x18\x03 \x01(\bR\bsnapshot\"c\n" +
+	"\x1aStreamMeasurementsResponse\x12'\n" +
+	"\x03tag\x18\x01 \x01(\v2\x15.ruuvi.gateway.v1.TagR\x03tag\x12\x1c\n" +
+	"\tcoalesced\x18\x02 \x01(\x04R\tcoalesced\"\x11\n" +
+	"\x0fListTagsRequest\"=\n" +
+	"\x10ListTagsResponse\x12)\n" +
+	"\x04tags\x18\x01 \x03(\v2\x15.ruuvi.gateway.v1.TagR\x04tags\"!\n" +
+	"\rGetTagRequest\x12\x10\n" +
+	"\x03mac\x18\x01 \x01(\tR\x03mac\"9\n" +
+	"\x0eGetTagResponse\x12'\n" +
+	"\x03tag\x18\x01 \x01(\v2\x15.ruuvi.gateway.v1.TagR\x03tag\"9\n" +
+	"\x11SetTagNameRequest\x12\x10\n" +
+	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\xa2\x01\n" +
+	"\x12SetTagNameResponse\x12O\n" +
+	"\ttag_names\x18\x01 \x03(\v22.ruuvi.gateway.v1.SetTagNameResponse.TagNamesEntryR\btagNames\x1a;\n" +
+	"\rTagNamesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"B\n" +
+	"\x14SetTagEnabledRequest\x12\x10\n" +
+	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x18\n" +
+	"\aenabled\x18\x02 \x01(\bR\aenabled\":\n" +
+	"\x15SetTagEnabledResponse\x12!\n" +
+	"\fenabled_tags\x18\x01 \x03(\tR\venabledTags\"\x12\n" +
+	"\x10GetConfigRequest\"D\n" +
+	"\x11GetConfigResponse\x12/\n" +
+	"\x06config\x18\x01 \x01(\v2\x17.google.protobuf.StructR\x06config\"F\n" +
+	"\x13UpdateConfigRequest\x12/\n" +
+	"\x06config\x18\x01 \x01(\v2\x17.google.protobuf.StructR\x06config\"\x16\n" +
+	"\x14UpdateConfigResponse2\x93\x05\n" +
+	"\x0eGatewayService\x12q\n" +
+	"\x12StreamMeasurements\x12+.ruuvi.gateway.v1.StreamMeasurementsRequest\x1a,.ruuvi.gateway.v1.StreamMeasurementsResponse0\x01\x12Q\n" +
+	"\bListTags\x12!.ruuvi.gateway.v1.ListTagsRequest\x1a\".ruuvi.gateway.v1.ListTagsResponse\x12K\n" +
+	"\x06GetTag\x12\x1f.ruuvi.gateway.v1.GetTagRequest\x1a .ruuvi.gateway.v1.GetTagResponse\x12W\n" +
+	"\n" +
+	"SetTagName\x12#.ruuvi.gateway.v1.SetTagNameRequest\x1a$.ruuvi.gateway.v1.SetTagNameResponse\x12`\n" +
+	"\rSetTagEnabled\x12&.ruuvi.gateway.v1.SetTagEnabledRequest\x1a'.ruuvi.gateway.v1.SetTagEnabledResponse\x12T\n" +
+	"\tGetConfig\x12\".ruuvi.gateway.v1.GetConfigRequest\x1a#.ruuvi.gateway.v1.GetConfigResponse\x12]\n" +
+	"\fUpdateConfig\x12%.ruuvi.gateway.v1.UpdateConfigRequest\x1a&.ruuvi.gateway.v1.UpdateConfigResponseBGZEgithub.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1;gatewayv1b\x06proto3"
+
+var (
+	file_ruuvi_gateway_v1_gateway_proto_rawDescOnce sync.Once
+	file_ruuvi_gateway_v1_gateway_proto_rawDescData []byte
+)
+
+func file_ruuvi_gateway_v1_gateway_proto_rawDescGZIP() []byte {
+	file_ruuvi_gateway_v1_gateway_proto_rawDescOnce.Do(func() {
+		file_ruuvi_gateway_v1_gateway_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ruuvi_gateway_v1_gateway_proto_rawDesc), len(file_ruuvi_gateway_v1_gateway_proto_rawDesc)))
+	})
+	return file_ruuvi_gateway_v1_gateway_proto_rawDescData
+}
+
+var file_ruuvi_gateway_v1_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_ruuvi_gateway_v1_gateway_proto_goTypes = []any{
+	(*Tag)(nil),                        // 0: ruuvi.gateway.v1.Tag
+	(*StreamMeasurementsRequest)(nil),  // 1: ruuvi.gateway.v1.StreamMeasurementsRequest
+	(*StreamMeasurementsResponse)(nil), // 2: ruuvi.gateway.v1.StreamMeasurementsResponse
+	(*ListTagsRequest)(nil),            // 3: ruuvi.gateway.v1.ListTagsRequest
+	(*ListTagsResponse)(nil),           // 4: ruuvi.gateway.v1.ListTagsResponse
+	(*GetTagRequest)(nil),              // 5: ruuvi.gateway.v1.GetTagRequest
+	(*GetTagResponse)(nil),             // 6: ruuvi.gateway.v1.GetTagResponse
+	(*SetTagNameRequest)(nil),          // 7: ruuvi.gateway.v1.SetTagNameRequest
+	(*SetTagNameResponse)(nil),         // 8: ruuvi.gateway.v1.SetTagNameResponse
+	(*SetTagEnabledRequest)(nil),       // 9: ruuvi.gateway.v1.SetTagEnabledRequest
+	(*SetTagEnabledResponse)(nil),      // 10: ruuvi.gateway.v1.SetTagEnabledResponse
+	(*GetConfigRequest)(nil),           // 11: ruuvi.gateway.v1.GetConfigRequest
+	(*GetConfigResponse)(nil),          // 12: ruuvi.gateway.v1.GetConfigResponse
+	(*UpdateConfigRequest)(nil),        // 13: ruuvi.gateway.v1.UpdateConfigRequest
+	(*UpdateConfigResponse)(nil),       // 14: ruuvi.gateway.v1.UpdateConfigResponse
+	nil,                                // 15: ruuvi.gateway.v1.SetTagNameResponse.TagNamesEntry
+	(*timestamppb.Timestamp)(nil),      // 16: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),            // 17: google.protobuf.Struct
+}
+var file_ruuvi_gateway_v1_gateway_proto_depIdxs = []int32{
+	16, // 0: ruuvi.gateway.v1.Tag.last_seen:type_name -> google.protobuf.Timestamp
+	0,  // 1: ruuvi.gateway.v1.StreamMeasurementsResponse.tag:type_name -> ruuvi.gateway.v1.Tag
+	0,  // 2: ruuvi.gateway.v1.ListTagsResponse.tags:type_name -> ruuvi.gateway.v1.Tag
+	0,  // 3: ruuvi.gateway.v1.GetTagResponse.tag:type_name -> ruuvi.gateway.v1.Tag
+	15, // 4: ruuvi.gateway.v1.SetTagNameResponse.tag_names:type_name -> ruuvi.gateway.v1.SetTagNameResponse.TagNamesEntry
+	17, // 5: ruuvi.gateway.v1.GetConfigResponse.config:type_name -> google.protobuf.Struct
+	17, // 6: ruuvi.gateway.v1.UpdateConfigRequest.config:type_name -> google.protobuf.Struct
+	1,  // 7: ruuvi.gateway.v1.GatewayService.StreamMeasurements:input_type -> ruuvi.gateway.v1.StreamMeasurementsRequest
+	3,  // 8: ruuvi.gateway.v1.GatewayService.ListTags:input_type -> ruuvi.gateway.v1.ListTagsRequest
+	5,  // 9: ruuvi.gateway.v1.GatewayService.GetTag:input_type -> ruuvi.gateway.v1.GetTagRequest
+	7,  // 10: ruuvi.gateway.v1.GatewayService.SetTagName:input_type -> ruuvi.gateway.v1.SetTagNameRequest
+	9,  // 11: ruuvi.gateway.v1.GatewayService.SetTagEnabled:input_type -> ruuvi.gateway.v1.SetTagEnabledRequest
+	11, // 12: ruuvi.gateway.v1.GatewayService.GetConfig:input_type -> ruuvi.gateway.v1.GetConfigRequest
+	13, // 13: ruuvi.gateway.v1.GatewayService.UpdateConfig:input_type -> ruuvi.gateway.v1.UpdateConfigRequest
+	2,  // 14: ruuvi.gateway.v1.GatewayService.StreamMeasurements:output_type -> ruuvi.gateway.v1.StreamMeasurementsResponse
+	4,  // 15: ruuvi.gateway.v1.GatewayService.ListTags:output_type -> ruuvi.gateway.v1.ListTagsResponse
+	6,  // 16: ruuvi.gateway.v1.GatewayService.GetTag:output_type -> ruuvi.gateway.v1.GetTagResponse
+	8,  // 17: ruuvi.gateway.v1.GatewayService.SetTagName:output_type -> ruuvi.gateway.v1.SetTagNameResponse
+	10, // 18: ruuvi.gateway.v1.GatewayService.SetTagEnabled:output_type -> ruuvi.gateway.v1.SetTagEnabledResponse
+	12, // 19: ruuvi.gateway.v1.GatewayService.GetConfig:output_type -> ruuvi.gateway.v1.GetConfigResponse
+	14, // 20: ruuvi.gateway.v1.GatewayService.UpdateConfig:output_type -> ruuvi.gateway.v1.UpdateConfigResponse
+	14, // [14:21] is the sub-list for method output_type
+	7,  // [7:14] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_ruuvi_gateway_v1_gateway_proto_init() }
+func file_ruuvi_gateway_v1_gateway_proto_init() {
+	if File_ruuvi_gateway_v1_gateway_proto != nil {
+		return
+	}
+	file_ruuvi_gateway_v1_gateway_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ruuvi_gateway_v1_gateway_proto_rawDesc), len(file_ruuvi_gateway_v1_gateway_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ruuvi_gateway_v1_gateway_proto_goTypes,
+		DependencyIndexes: file_ruuvi_gateway_v1_gateway_proto_depIdxs,
+		MessageInfos:      file_ruuvi_gateway_v1_gateway_proto_msgTypes,
+	}.Build()
+	File_ruuvi_gateway_v1_gateway_proto = out.File
+	file_ruuvi_gateway_v1_gateway_proto_goTypes = nil
+	file_ruuvi_gateway_v1_gateway_proto_depIdxs = nil
+}
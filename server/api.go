@@ -1,12 +1,15 @@
 ﻿package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +18,8 @@ import (
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
 	"github.com/Saavuori/ruuvi-go-gateway/service/matter"
 	"github.com/Saavuori/ruuvi-go-gateway/web"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 )
 
 type Tag struct {
@@ -49,7 +52,6 @@ type Tag struct {
 var (
 	recentTags = make(map[string]Tag)
 	tagsLock   sync.RWMutex
-	configFile = "config.yml" // Default, can be overridden
 )
 
 func UpdateTag(m parser.Measurement) {
@@ -90,21 +92,45 @@ func UpdateTag(m parser.Measurement) {
 
 	tags.LastSeen = time.Now().UnixMilli()
 	recentTags[m.Mac] = tags
+	hub.publish(tags)
 }
 
 func Start(conf config.Config, confFile string, matterBridge *matter.Bridge) {
 	if confFile != "" {
-		configFile = confFile
+		store = config.NewStore(confFile, conf.ConfigBackups)
+	}
+
+	var err error
+	auth, err = newAuthenticator(conf.Auth)
+	if err != nil {
+		// Never serve the API unprotected when the auth config is broken
+		log.WithError(err).Fatal("Invalid auth config")
 	}
 
 	mux := http.NewServeMux()
 
+	// Authentication
+	mux.HandleFunc("/api/auth/login", handleLogin)
+	mux.HandleFunc("/api/auth/logout", handleLogout)
+	mux.HandleFunc("/api/auth/me", handleMe)
+
 	// API Endpoints
 	mux.HandleFunc("/api/config", handleConfig)
+	mux.HandleFunc("/api/config/validate", handleConfigValidate)
+	mux.HandleFunc("/api/config/effective", handleConfigEffective)
+	mux.HandleFunc("/api/config/history", handleConfigHistory)
+	mux.HandleFunc("/api/config/rollback", handleConfigRollback)
 	mux.HandleFunc("/api/tags", handleTags)
 	mux.HandleFunc("/api/tags/enable", handleTagEnable)
 	mux.HandleFunc("/api/tags/name", handleTagName)
 	mux.HandleFunc("/api/restart", handleRestart)
+	mux.HandleFunc("/api/stream", handleStream)
+	mux.HandleFunc("/api/ws", handleWebSocket)
+
+	// Prometheus metrics, when not served on a separate port
+	if conf.Prometheus != nil && (conf.Prometheus.Enabled == nil || *conf.Prometheus.Enabled) && conf.Prometheus.UseHTTPListener {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
 
 	// Matter API
 	mux.HandleFunc("/api/matter", func(w http.ResponseWriter, r *http.Request) {
@@ -116,7 +142,7 @@ func Start(conf config.Config, confFile string, matterBridge *matter.Bridge) {
 	if err != nil {
 		log.WithError(err).Error("Failed to load embedded web assets")
 	} else {
-		mux.Handle("/", http.FileServer(http.FS(fsys)))
+		mux.Handle("/", staticHandler(fsys))
 	}
 
 	port := 8080
@@ -124,31 +150,72 @@ func Start(conf config.Config, confFile string, matterBridge *matter.Bridge) {
 		port = conf.HTTPListener.Port
 	}
 	addr := fmt.Sprintf(":%d", port)
-	log.WithField("addr", addr).Info("Starting Management Web UI")
+	srv := &http.Server{Addr: addr, Handler: requireAuth(mux)}
 
-	go func() {
-		if err := http.ListenAndServe(addr, mux); err != nil {
-			log.WithError(err).Error("Web UI server failed")
+	if conf.HTTPListener != nil && conf.HTTPListener.TLS != nil && conf.HTTPListener.TLS.Enabled {
+		tlsConf := conf.HTTPListener.TLS
+		srv.TLSConfig, err = newTLSConfig(tlsConf)
+		if err != nil {
+			// Do not fall back to plain HTTP, the user asked for credentials to be protected
+			log.WithError(err).Fatal("Failed to set up HTTPS for the Web UI")
 		}
-	}()
+		log.WithField("addr", addr).Info("Starting Management Web UI with HTTPS")
+		go func() {
+			if err := srv.ListenAndServeTLS("", ""); err != nil {
+				log.WithError(err).Error("Web UI server failed")
+			}
+		}()
+		if tlsConf.RedirectPort != 0 {
+			redirectAddr := fmt.Sprintf(":%d", tlsConf.RedirectPort)
+			log.WithField("addr", redirectAddr).Info("Redirecting HTTP to HTTPS")
+			go func() {
+				if err := http.ListenAndServe(redirectAddr, redirectToHTTPS(port)); err != nil {
+					log.WithError(err).Error("HTTP redirect server failed")
+				}
+			}()
+		}
+	} else {
+		log.WithField("addr", addr).Info("Starting Management Web UI")
+		go func() {
+			if err := srv.ListenAndServe(); err != nil {
+				log.WithError(err).Error("Web UI server failed")
+			}
+		}()
+	}
+
+	var grpcTLS *tls.Config
+	if srv.TLSConfig != nil {
+		grpcTLS = srv.TLSConfig.Clone()
+	}
+	startGRPC(conf.GRPCListener, grpcTLS)
+}
+
+// staticHandler serves the exported UI pages also without the .html extension, eg. /login serves login.html
+func staticHandler(fsys fs.FS) http.Handler {
+	files := http.FileServer(http.FS(fsys))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(r.URL.Path, "/")
+		if name != "" && path.Ext(name) == "" {
+			if _, err := fs.Stat(fsys, name+".html"); err == nil {
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = "/" + name + ".html"
+				files.ServeHTTP(w, r2)
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
 }
 
 func handleConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		// Read config file directly to return exactly what's on disk (including comments if we parse loosely, but here we just re-read)
-		// Actually, standard json marshal of the struct is safer for the UI contract.
-		// We'll read the file, unmarshal, and return JSON.
-		data, err := os.ReadFile(configFile)
+		// Return the config file as JSON for the frontend
+		c, err := GetConfig()
 		if err != nil {
+			log.WithError(err).Error("Failed to read config")
 			http.Error(w, "Failed to read config", http.StatusInternalServerError)
 			return
 		}
-		// Convert YAML to JSON for the frontend
-		var c config.Config
-		if err := yaml.Unmarshal(data, &c); err != nil {
-			http.Error(w, "Failed to parse config", http.StatusInternalServerError)
-			return
-		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(c)
 
@@ -160,14 +227,12 @@ func handleConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Save back to YAML
-		data, err := yaml.Marshal(newConfig)
-		if err != nil {
-			http.Error(w, "Failed to marshal config", http.StatusInternalServerError)
-			return
-		}
-
-		if err := os.WriteFile(configFile, data, 0644); err != nil {
+		if err := UpdateConfig(newConfig); err != nil {
+			if errors.Is(err, ErrInvalidConfig) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.WithError(err).Error("Failed to save config")
 			http.Error(w, "Failed to write config file", http.StatusInternalServerError)
 			return
 		}
@@ -179,90 +244,130 @@ func handleConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleTags(w http.ResponseWriter, r *http.Request) {
-	tagsLock.RLock()
-	defer tagsLock.RUnlock()
+// handleConfigValidate checks a config without saving it. The response is 200 with the errors
+// of each field, eg. {"valid": false, "errors": [{"path": "influxdb_publisher.url", "message": "missing scheme"}]}
+func handleConfigValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	result := struct {
+		Valid  bool                `json:"valid"`
+		Errors []config.FieldError `json:"errors"`
+	}{Errors: []config.FieldError{}}
 
-	list := make([]Tag, 0, len(recentTags))
-	for _, t := range recentTags {
-		list = append(list, t)
+	var c config.Config
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.As(err, &typeErr):
+			result.Errors = append(result.Errors, config.FieldError{Path: typeErr.Field, Message: "expected " + typeErr.Type.String() + ", got " + typeErr.Value})
+		case errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		default:
+			// Errors of the custom types, eg. an invalid duration, do not have the path
+			result.Errors = append(result.Errors, config.FieldError{Message: err.Error()})
+		}
+	} else if err := ValidateConfig(c); err != nil {
+		var invalid config.ValidationError
+		if !errors.As(err, &invalid) {
+			log.WithError(err).Error("Failed to validate config")
+			http.Error(w, "Failed to read config file", http.StatusInternalServerError)
+			return
+		}
+		result.Errors = invalid
 	}
+	result.Valid = len(result.Errors) == 0
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
+// handleConfigEffective returns the running config merged from the defaults, the file, the RUUVI_
+// environment variables and the -set flags, eg. [{"path": "mqtt_publisher.broker_url", "value": "tcp://broker:1883",
+// "source": {"layer": "env", "name": "RUUVI_MQTT_PUBLISHER__BROKER_URL"}}]
+func handleConfigEffective(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	values, err := EffectiveConfig()
+	if err != nil {
+		log.WithError(err).Error("Failed to list the effective config")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(list)
+	json.NewEncoder(w).Encode(values)
 }
 
-func handleTagEnable(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+func handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	history, err := ConfigHistory()
+	if err != nil {
+		log.WithError(err).Error("Failed to list config backups")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
 
+// handleConfigRollback restores a backup listed by /api/config/history, eg. {"id": "20240102T150405.000000Z"}
+func handleConfigRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 	var req struct {
-		Mac     string `json:"mac"`
-		Enabled bool   `json:"enabled"`
+		ID string `json:"id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-
-	req.Mac = strings.ToUpper(req.Mac)
-
-	// Read current config
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+	if err := RollbackConfig(req.ID); err != nil {
+		writeControlError(w, err)
 		return
 	}
-	var c config.Config
-	if err := yaml.Unmarshal(data, &c); err != nil {
-		http.Error(w, "Failed to parse config", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func handleTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListTags())
+}
+
+func handleTagEnable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Update enabled tags
-	if req.Enabled {
-		// Add to list if not present
-		found := false
-		for _, mac := range c.EnabledTags {
-			if strings.EqualFold(mac, req.Mac) {
-				found = true
-				break
-			}
-		}
-		if !found {
-			c.EnabledTags = append(c.EnabledTags, req.Mac)
-		}
-	} else {
-		// Remove from list
-		newList := make([]string, 0, len(c.EnabledTags))
-		for _, mac := range c.EnabledTags {
-			if !strings.EqualFold(mac, req.Mac) {
-				newList = append(newList, mac)
-			}
-		}
-		c.EnabledTags = newList
+	var req struct {
+		Mac     string `json:"mac"`
+		Enabled bool   `json:"enabled"`
 	}
-
-	// Save back
-	newData, err := yaml.Marshal(c)
-	if err != nil {
-		http.Error(w, "Failed to marshal config", http.StatusInternalServerError)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if err := os.WriteFile(configFile, newData, 0644); err != nil {
-		http.Error(w, "Failed to write config", http.StatusInternalServerError)
+
+	enabledTags, err := SetTagEnabled(req.Mac, req.Enabled)
+	if err != nil {
+		writeControlError(w, err)
 		return
 	}
 
-	// Update in-memory state for immediate effect (no restart required)
-	UpdateEnabledTags(c.EnabledTags)
-
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":      true,
-		"enabled_tags": c.EnabledTags,
+		"enabled_tags": enabledTags,
 	})
 }
 
@@ -300,39 +405,9 @@ func handleTagName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Mac = strings.ToUpper(req.Mac)
-
-	// Read current config
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		http.Error(w, "Failed to read config", http.StatusInternalServerError)
-		return
-	}
-	var c config.Config
-	if err := yaml.Unmarshal(data, &c); err != nil {
-		http.Error(w, "Failed to parse config", http.StatusInternalServerError)
-		return
-	}
-
-	// Update tag names
-	if c.TagNames == nil {
-		c.TagNames = make(map[string]string)
-	}
-
-	if req.Name == "" {
-		delete(c.TagNames, req.Mac)
-	} else {
-		c.TagNames[req.Mac] = req.Name
-	}
-
-	// Save back
-	newData, err := yaml.Marshal(c)
+	tagNames, err := SetTagName(req.Mac, req.Name)
 	if err != nil {
-		http.Error(w, "Failed to marshal config", http.StatusInternalServerError)
-		return
-	}
-	if err := os.WriteFile(configFile, newData, 0644); err != nil {
-		http.Error(w, "Failed to write config", http.StatusInternalServerError)
+		writeControlError(w, err)
 		return
 	}
 
@@ -340,7 +415,7 @@ func handleTagName(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"tag_names": c.TagNames,
+		"tag_names": tagNames,
 	})
 }
 
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+)
+
+func TestHandleConfig_Secrets(t *testing.T) {
+	useTestConfigFile(t, `gw_mac: 00:00:00:00:00:00
+mqtt_publisher:
+  broker_url: tcp://localhost:1883
+  username: ruuvi
+  password: mqtt-secret
+influxdb_publisher:
+  url: http://localhost:8086
+  auth_token: ${INFLUX_TOKEN}
+`)
+
+	w := httptest.NewRecorder()
+	handleConfig(w, httptest.NewRequest("GET", "/api/config", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "mqtt-secret") {
+		t.Fatalf("GET returned the secret: %s", body)
+	}
+	var c config.Config
+	if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.MQTTPublisher.Password != config.SecretMask || c.InfluxDBPublisher.AuthToken != "${INFLUX_TOKEN}" {
+		t.Errorf("got %+v %+v", c.MQTTPublisher, c.InfluxDBPublisher)
+	}
+
+	// Posting the masked config back keeps the stored secrets
+	c.MQTTPublisher.Username = "changed"
+	data, _ := json.Marshal(c)
+	w = httptest.NewRecorder()
+	handleConfig(w, httptest.NewRequest("POST", "/api/config", bytes.NewReader(data)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST: got %d %s", w.Code, w.Body)
+	}
+	stored, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stored), "password: mqtt-secret") || !strings.Contains(string(stored), "username: changed") ||
+		!strings.Contains(string(stored), "${INFLUX_TOKEN}") {
+		t.Errorf("stored config: %s", stored)
+	}
+
+	// A masked secret without a stored value is rejected
+	c.NATSPublisher = &config.NATSPublisher{Url: "nats://localhost:4222", Token: config.SecretMask}
+	data, _ = json.Marshal(c)
+	w = httptest.NewRecorder()
+	handleConfig(w, httptest.NewRequest("POST", "/api/config", bytes.NewReader(data)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("masked secret without a stored value: got %d", w.Code)
+	}
+}
+
+func TestHandleConfig_HistoryAndRollback(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: 00:00:00:00:00:00\n# Names shown in the UI\ntag_names: {}\n")
+
+	if _, err := SetTagName("AA:BB:CC:DD:EE:FF", "Sauna"); err != nil {
+		t.Fatal(err)
+	}
+	// An invalid config is rejected and not written
+	w := httptest.NewRecorder()
+	handleConfig(w, httptest.NewRequest("POST", "/api/config", strings.NewReader(`{"gw_mac": "00:00:00:00:00:00", "http_listener": {"port": 123456}}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "http_listener.port") {
+		t.Fatalf("invalid config: got %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handleConfigHistory(w, httptest.NewRequest("GET", "/api/config/history", nil))
+	var history []config.Backup
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d backups", len(history))
+	}
+
+	w = httptest.NewRecorder()
+	handleConfigRollback(w, httptest.NewRequest("POST", "/api/config/rollback", strings.NewReader(`{"id": "`+history[0].ID+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback: got %d %s", w.Code, w.Body)
+	}
+	stored, _ := os.ReadFile(store.Path())
+	if strings.Contains(string(stored), "Sauna") || !strings.Contains(string(stored), "# Names shown in the UI") {
+		t.Errorf("after rollback: %s", stored)
+	}
+
+	w = httptest.NewRecorder()
+	handleConfigRollback(w, httptest.NewRequest("POST", "/api/config/rollback", strings.NewReader(`{"id": "unknown"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown backup: got %d", w.Code)
+	}
+}
+
+func TestHandleConfigValidate(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: 00:00:00:00:00:00\nmqtt_publisher:\n  broker_url: tcp://localhost:1883\n  password: mqtt-secret\n"+
+		"influxdb3_publisher:\n  enabled: false\n  url: localhost:8181\n")
+
+	validate := func(body string) (int, map[string]string) {
+		w := httptest.NewRecorder()
+		handleConfigValidate(w, httptest.NewRequest("POST", "/api/config/validate", strings.NewReader(body)))
+		var result struct {
+			Valid  bool                `json:"valid"`
+			Errors []config.FieldError `json:"errors"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		paths := make(map[string]string)
+		for _, e := range result.Errors {
+			paths[e.Path] = e.Message
+		}
+		if w.Code == http.StatusOK && result.Valid != (len(paths) == 0) {
+			t.Errorf("valid is %v with errors %v", result.Valid, paths)
+		}
+		return w.Code, paths
+	}
+
+	// The masked secret is checked with the stored value
+	code, paths := validate(`{"gw_mac": "00:00:00:00:00:00", "mqtt_publisher": {"broker_url": "tcp://localhost:1883", "password": "********"}}`)
+	if code != http.StatusOK || len(paths) != 0 {
+		t.Errorf("valid config: got %d %v", code, paths)
+	}
+
+	code, paths = validate(`{"gw_mac": "00:00:00:00:00:00", "influxdb_publisher": {"url": "localhost:8086"}, "nats_publisher": {"url": "nats://localhost:4222", "token": "********"}}`)
+	if code != http.StatusOK || paths["influxdb_publisher.url"] != "missing scheme, eg. http://localhost:8086" ||
+		paths["nats_publisher.token"] != "the secret is masked but there is no stored value" {
+		t.Errorf("invalid config: got %d %v", code, paths)
+	}
+
+	// The stored config has the same bad URL, saving it is allowed
+	code, paths = validate(`{"gw_mac": "00:00:00:00:00:00", "influxdb3_publisher": {"enabled": false, "url": "localhost:8181"}}`)
+	if code != http.StatusOK || len(paths) != 0 {
+		t.Errorf("pre-existing error: got %d %v", code, paths)
+	}
+
+	code, paths = validate(`{"http_listener": {"port": "8080"}}`)
+	if code != http.StatusOK || paths["http_listener.port"] == "" {
+		t.Errorf("wrong type: got %d %v", code, paths)
+	}
+
+	if code, _ := validate(`{"gw_mac": `); code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: got %d", code)
+	}
+	// Nothing is written
+	stored, _ := os.ReadFile(store.Path())
+	if strings.Contains(string(stored), "influxdb_publisher") {
+		t.Errorf("config was written: %s", stored)
+	}
+}
+
+func TestHandleConfigEffective(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: AA:BB:CC:DD:EE:FF\nmqtt_publisher:\n  broker_url: tcp://localhost:1883\n  password: mqtt-secret\n")
+	layers := config.Layers{Path: store.Path(), Environ: []string{"RUUVI_MQTT_PUBLISHER__TOPIC_PREFIX=home"}}
+	c, sources, err := layers.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetConfigLayers(layers, c, sources)
+	t.Cleanup(func() { SetConfigLayers(config.Layers{}, config.Config{}, nil) })
+
+	w := httptest.NewRecorder()
+	handleConfigEffective(w, httptest.NewRequest("GET", "/api/config/effective", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "mqtt-secret") {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var values []config.EffectiveValue
+	if err := json.Unmarshal(w.Body.Bytes(), &values); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]config.EffectiveValue)
+	for _, v := range values {
+		found[v.Path] = v
+	}
+	if v := found["mqtt_publisher.topic_prefix"]; v.Value != "home" || v.Source.Name != "RUUVI_MQTT_PUBLISHER__TOPIC_PREFIX" {
+		t.Errorf("topic_prefix: %+v", v)
+	}
+	if v := found["gw_mac"]; v.Source.Layer != config.LayerFile {
+		t.Errorf("gw_mac: %+v", v)
+	}
+}
@@ -0,0 +1,567 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	gatewayv1 "github.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleReadOnly = "read-only"
+
+	sessionCookie = "ruuvi_session"
+	csrfCookie    = "ruuvi_csrf"
+	csrfHeader    = "X-CSRF-Token"
+
+	loginMaxFailures   = 5
+	loginFailureWindow = 5 * time.Minute
+)
+
+// principal is an authenticated user or API token
+type principal struct {
+	Name string `json:"username"`
+	Role string `json:"role"`
+	// "session", "token", "proxy" or "none" when auth is disabled
+	Method string `json:"method"`
+	csrf   string
+}
+
+func (p *principal) isAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+type principalKey struct{}
+
+type apiToken struct {
+	name string
+	hash []byte
+	role string
+}
+
+type session struct {
+	username string
+	role     string
+	csrf     string
+	expires  time.Time
+}
+
+type loginFailures struct {
+	count int
+	first time.Time
+}
+
+// authenticator checks the credentials of the HTTP and gRPC requests, nil when auth is disabled
+type authenticator struct {
+	users      map[string]config.AuthUser
+	tokens     []apiToken
+	sessionTTL time.Duration
+	secure     bool
+	dummyHash  []byte
+
+	proxyHeader   string
+	proxyRole     string
+	proxyNetworks []*net.IPNet
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	failures map[string]*loginFailures
+}
+
+var auth *authenticator
+
+func normalizeRole(role string, fallback string) (string, error) {
+	switch strings.ToLower(role) {
+	case "":
+		return fallback, nil
+	case RoleAdmin:
+		return RoleAdmin, nil
+	case RoleReadOnly, "readonly", "read":
+		return RoleReadOnly, nil
+	}
+	return "", fmt.Errorf("invalid role %q, expected admin or read-only", role)
+}
+
+// parseNetworks parses addresses and CIDRs, a plain address matches only itself
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func newAuthenticator(conf *config.Auth) (*authenticator, error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+	a := &authenticator{
+		users:      make(map[string]config.AuthUser),
+		sessionTTL: time.Duration(conf.SessionTTL),
+		secure:     conf.SecureCookies,
+		sessions:   make(map[string]*session),
+		failures:   make(map[string]*loginFailures),
+	}
+	if a.sessionTTL == 0 {
+		a.sessionTTL = 24 * time.Hour
+	}
+	for _, u := range conf.Users {
+		role, err := normalizeRole(u.Role, RoleAdmin)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Username, err)
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("user %s: password_hash is not a bcrypt hash", u.Username)
+		}
+		u.Role = role
+		a.users[u.Username] = u
+	}
+	for _, t := range conf.Tokens {
+		role, err := normalizeRole(t.Role, RoleReadOnly)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", t.Name, err)
+		}
+		hash, err := hex.DecodeString(t.TokenSHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("token %s: token_sha256 is not a hex encoded SHA-256 hash", t.Name)
+		}
+		a.tokens = append(a.tokens, apiToken{name: t.Name, hash: hash, role: role})
+	}
+	if conf.Proxy != nil && conf.Proxy.Enabled {
+		networks, err := parseNetworks(conf.Proxy.TrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("proxy trusted_proxies: %w", err)
+		}
+		if len(networks) == 0 {
+			return nil, fmt.Errorf("proxy auth requires trusted_proxies")
+		}
+		role, err := normalizeRole(conf.Proxy.DefaultRole, RoleReadOnly)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		a.proxyHeader = conf.Proxy.Header
+		if a.proxyHeader == "" {
+			a.proxyHeader = "Remote-User"
+		}
+		a.proxyRole = role
+		a.proxyNetworks = networks
+	}
+	// Compared against on unknown usernames so that the response time does not reveal which users exist
+	a.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("ruuvi"), bcrypt.DefaultCost)
+	return a, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashToken returns the token_sha256 value of an API token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateToken returns a new random API token
+func GenerateToken() string {
+	return randomToken()
+}
+
+func (a *authenticator) checkToken(token string) *principal {
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			return &principal{Name: t.name, Role: t.role, Method: "token"}
+		}
+	}
+	return nil
+}
+
+func (a *authenticator) session(id string) *principal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[id]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, id)
+		return nil
+	}
+	return &principal{Name: s.username, Role: s.role, Method: "session", csrf: s.csrf}
+}
+
+func (a *authenticator) trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.proxyNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authenticator) proxyUser(username string) *principal {
+	role := a.proxyRole
+	if u, ok := a.users[username]; ok {
+		role = u.Role
+	}
+	return &principal{Name: username, Role: role, Method: "proxy"}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// authenticate returns the principal of a request, or nil when it has no valid credentials
+func (a *authenticator) authenticate(r *http.Request) *principal {
+	if token, ok := bearerToken(r.Header.Get("Authorization")); ok {
+		return a.checkToken(token)
+	}
+	// Browsers cannot set headers on EventSource and WebSocket requests. Other routes do not accept
+	// the token in the URL, where it would end up in proxy and access logs.
+	if token := r.URL.Query().Get("access_token"); token != "" && r.Method == http.MethodGet && acceptsQueryToken(r.URL.Path) {
+		return a.checkToken(token)
+	}
+	if a.proxyNetworks != nil && a.trustedProxy(r.RemoteAddr) {
+		if username := r.Header.Get(a.proxyHeader); username != "" {
+			return a.proxyUser(username)
+		}
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return a.session(cookie.Value)
+	}
+	return nil
+}
+
+// acceptsQueryToken returns whether the route accepts the API token in the access_token parameter
+func acceptsQueryToken(path string) bool {
+	return path == "/api/stream" || path == "/api/ws"
+}
+
+// checkCSRF verifies that a state changing request with cookie or proxy credentials was made by the UI
+func checkCSRF(r *http.Request, p *principal) bool {
+	if p.Method == "token" {
+		// Tokens are never sent automatically by the browser
+		return true
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+	expected := p.csrf
+	if p.Method == "proxy" {
+		// Double submit cookie, proxy users have no session
+		cookie, err := r.Cookie(csrfCookie)
+		if err != nil {
+			return false
+		}
+		expected = cookie.Value
+	}
+	token := r.Header.Get(csrfHeader)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// requiresAdmin returns whether a request changes something or reads the config, which contains
+// credentials, or the Matter status, which contains the pairing code of the bridge
+func requiresAdmin(r *http.Request) bool {
+	return !isSafeMethod(r.Method) || strings.HasPrefix(r.URL.Path, "/api/config") || r.URL.Path == "/api/matter"
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func (a *authenticator) setCookie(w http.ResponseWriter, r *http.Request, name string, value string, httpOnly bool, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   a.secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// requireAuth protects the API and metrics endpoints. The static UI files, including the login page, are public.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := auth
+		path := r.URL.Path
+		if a == nil || !(strings.HasPrefix(path, "/api/") || path == "/metrics") ||
+			path == "/api/auth/login" || path == "/api/auth/logout" || path == "/api/auth/me" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p := a.authenticate(r)
+		if p == nil {
+			writeJSONError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if requiresAdmin(r) && !p.isAdmin() {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		if !isSafeMethod(r.Method) && !checkCSRF(r, p) {
+			log.WithFields(log.Fields{"user": p.Name, "path": path}).Warn("Rejected request with invalid CSRF token")
+			writeJSONError(w, http.StatusForbidden, "invalid CSRF token")
+			return
+		}
+		if p.Method == "proxy" {
+			if _, err := r.Cookie(csrfCookie); err != nil {
+				a.setCookie(w, r, csrfCookie, randomToken(), false, 0)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowLogin returns false while an address has too many recent failed logins
+func (a *authenticator) allowLogin(ip string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[ip]
+	if !ok {
+		return true
+	}
+	if time.Since(f.first) > loginFailureWindow {
+		delete(a.failures, ip)
+		return true
+	}
+	return f.count < loginMaxFailures
+}
+
+func (a *authenticator) loginFailed(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[ip]
+	if !ok || time.Since(f.first) > loginFailureWindow {
+		f = &loginFailures{first: time.Now()}
+		a.failures[ip] = f
+	}
+	f.count++
+}
+
+// login checks the password and returns a new session
+func (a *authenticator) login(username string, password string) (string, *session, bool) {
+	u, ok := a.users[username]
+	hash := a.dummyHash
+	if ok {
+		hash = []byte(u.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return "", nil, false
+	}
+	s := &session{username: u.Username, role: u.Role, csrf: randomToken(), expires: time.Now().Add(a.sessionTTL)}
+	id := randomToken()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for key, old := range a.sessions {
+		if now.After(old.expires) {
+			delete(a.sessions, key)
+		}
+	}
+	a.sessions[id] = s
+	return id, s, true
+}
+
+func (a *authenticator) logout(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a := auth
+	if a == nil {
+		writeJSONError(w, http.StatusNotFound, "authentication is disabled")
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	ip := clientIP(r)
+	if !a.allowLogin(ip) {
+		writeJSONError(w, http.StatusTooManyRequests, "too many failed logins, try again later")
+		return
+	}
+	id, s, ok := a.login(req.Username, req.Password)
+	if !ok {
+		a.loginFailed(ip)
+		log.WithFields(log.Fields{"username": req.Username, "address": ip}).Warn("Failed login")
+		writeJSONError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+	log.WithFields(log.Fields{"username": s.username, "address": ip}).Info("User logged in")
+	maxAge := int(a.sessionTTL.Seconds())
+	a.setCookie(w, r, sessionCookie, id, true, maxAge)
+	// Read by the UI and sent back in the X-CSRF-Token header
+	a.setCookie(w, r, csrfCookie, s.csrf, false, maxAge)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(principal{Name: s.username, Role: s.role, Method: "session"})
+}
+
+// handleLogout ends the session. Like the other state changing requests, a logged in user needs the
+// CSRF token, so a cross-site form cannot log the user out.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a := auth; a != nil {
+		if p := a.authenticate(r); p != nil && !checkCSRF(r, p) {
+			log.WithFields(log.Fields{"user": p.Name, "path": r.URL.Path}).Warn("Rejected request with invalid CSRF token")
+			writeJSONError(w, http.StatusForbidden, "invalid CSRF token")
+			return
+		}
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			a.logout(cookie.Value)
+		}
+		a.setCookie(w, r, sessionCookie, "", true, -1)
+		a.setCookie(w, r, csrfCookie, "", false, -1)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe returns the current user, the UI uses it to decide whether to show the login page
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		AuthEnabled   bool `json:"auth_enabled"`
+		Authenticated bool `json:"authenticated"`
+		*principal
+	}{}
+	if a := auth; a == nil {
+		resp.Authenticated = true
+		resp.principal = &principal{Role: RoleAdmin, Method: "none"}
+	} else {
+		resp.AuthEnabled = true
+		resp.principal = a.authenticate(r)
+		resp.Authenticated = resp.principal != nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// grpcAdminMethods change the gateway state or return the config, the other methods only read tags
+var grpcAdminMethods = map[string]bool{
+	gatewayv1.GatewayService_SetTagName_FullMethodName:    true,
+	gatewayv1.GatewayService_SetTagEnabled_FullMethodName: true,
+	gatewayv1.GatewayService_GetConfig_FullMethodName:     true,
+	gatewayv1.GatewayService_UpdateConfig_FullMethodName:  true,
+}
+
+// authorizeGRPC checks the API token in the "authorization: Bearer <token>" metadata
+func authorizeGRPC(ctx context.Context, method string) error {
+	a := auth
+	if a == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var p *principal
+	for _, value := range md.Get("authorization") {
+		if token, ok := bearerToken(value); ok {
+			p = a.checkToken(token)
+			break
+		}
+	}
+	if p == nil {
+		return status.Error(codes.Unauthenticated, "valid API token required")
+	}
+	if grpcAdminMethods[method] && !p.isAdmin() {
+		return status.Error(codes.PermissionDenied, "admin role required")
+	}
+	return nil
+}
+
+func authUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := authorizeGRPC(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := authorizeGRPC(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	gatewayv1 "github.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testAdminToken    = "admin-token"
+	testReadOnlyToken = "read-only-token"
+)
+
+// useTestAuth enables auth with an admin user "admin" / "secret", a read-only user "viewer" / "secret"
+// and an admin and a read-only token
+func useTestAuth(t *testing.T, proxy *config.ProxyAuth) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAuthenticator(&config.Auth{
+		Enabled: true,
+		Users: []config.AuthUser{
+			{Username: "admin", PasswordHash: string(hash)},
+			{Username: "viewer", PasswordHash: string(hash), Role: "read-only"},
+		},
+		Tokens: []config.APIToken{
+			{Name: "ci", TokenSHA256: HashToken(testAdminToken), Role: "admin"},
+			{Name: "grafana", TokenSHA256: HashToken(testReadOnlyToken)},
+		},
+		Proxy: proxy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := auth
+	auth = a
+	t.Cleanup(func() { auth = previous })
+}
+
+func newTestAuthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth/login", handleLogin)
+	mux.HandleFunc("/api/auth/logout", handleLogout)
+	mux.HandleFunc("/api/auth/me", handleMe)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	})
+	ts := httptest.NewServer(requireAuth(mux))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doRequest(t *testing.T, client *http.Client, method string, target string, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func cookieValue(resp *http.Response, name string) string {
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestAuth_Session(t *testing.T) {
+	useTestAuth(t, nil)
+	ts := newTestAuthServer(t)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	if resp := doRequest(t, client, "GET", ts.URL+"/", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("static page: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without session: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/auth/login", `{"username":"admin","password":"wrong"}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d", resp.StatusCode)
+	}
+
+	resp := doRequest(t, client, "POST", ts.URL+"/api/auth/login", `{"username":"admin","password":"secret"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: got %d", resp.StatusCode)
+	}
+	csrf := cookieValue(resp, csrfCookie)
+	if csrf == "" || cookieValue(resp, sessionCookie) == "" {
+		t.Fatal("login did not set the session and CSRF cookies")
+	}
+
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/config", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("config with session: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/tags/name", "{}", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST without CSRF token: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/tags/name", "{}", map[string]string{csrfHeader: csrf, "Origin": "http://evil.example"}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST from another origin: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/tags/name", "{}", map[string]string{csrfHeader: csrf, "Origin": ts.URL}); resp.StatusCode != http.StatusOK {
+		t.Errorf("POST with CSRF token: got %d", resp.StatusCode)
+	}
+
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/auth/logout", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("logout without CSRF token: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("session after rejected logout: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/auth/logout", "", map[string]string{csrfHeader: csrf}); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("logout: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("after logout: got %d", resp.StatusCode)
+	}
+}
+
+func TestAuth_ReadOnlyUser(t *testing.T) {
+	useTestAuth(t, nil)
+	ts := newTestAuthServer(t)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	resp := doRequest(t, client, "POST", ts.URL+"/api/auth/login", `{"username":"viewer","password":"secret"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: got %d", resp.StatusCode)
+	}
+	csrf := cookieValue(resp, csrfCookie)
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("tags: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/config", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("config: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/tags/name", "{}", map[string]string{csrfHeader: csrf}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST: got %d", resp.StatusCode)
+	}
+}
+
+func TestAuth_Tokens(t *testing.T) {
+	useTestAuth(t, nil)
+	ts := newTestAuthServer(t)
+	client := ts.Client()
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"GET", "/api/tags", bearer(testReadOnlyToken), http.StatusOK},
+		{"GET", "/api/tags", bearer("wrong"), http.StatusUnauthorized},
+		{"GET", "/api/config", bearer(testReadOnlyToken), http.StatusForbidden},
+		{"POST", "/api/config", bearer(testReadOnlyToken), http.StatusForbidden},
+		// Tokens are not sent by browsers automatically, so no CSRF token is needed
+		{"POST", "/api/config", bearer(testAdminToken), http.StatusOK},
+		// The Matter status contains the pairing code of the bridge
+		{"GET", "/api/matter", bearer(testReadOnlyToken), http.StatusForbidden},
+		{"GET", "/api/matter", bearer(testAdminToken), http.StatusOK},
+		{"GET", "/api/stream?access_token=" + testReadOnlyToken, nil, http.StatusOK},
+		{"GET", "/api/ws?access_token=" + testReadOnlyToken, nil, http.StatusOK},
+		// Only the streams accept the token in the URL
+		{"GET", "/api/tags?access_token=" + testReadOnlyToken, nil, http.StatusUnauthorized},
+		{"POST", "/api/tags/name?access_token=" + testAdminToken, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if resp := doRequest(t, client, tt.method, ts.URL+tt.path, "{}", tt.header); resp.StatusCode != tt.want {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestAuth_Proxy(t *testing.T) {
+	useTestAuth(t, &config.ProxyAuth{Enabled: true, TrustedProxies: []string{"127.0.0.1"}})
+	ts := newTestAuthServer(t)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", map[string]string{"Remote-User": "someone"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("proxy user: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/config", "", map[string]string{"Remote-User": "someone"}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unknown proxy user gets the default role: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/config", "", map[string]string{"Remote-User": "admin"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("proxy admin: got %d", resp.StatusCode)
+	}
+	var csrf string
+	u, _ := url.Parse(ts.URL)
+	for _, c := range jar.Cookies(u) {
+		if c.Name == csrfCookie {
+			csrf = c.Value
+		}
+	}
+	if csrf == "" {
+		t.Fatal("CSRF cookie not set for proxy user")
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/config", "{}", map[string]string{"Remote-User": "admin"}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST without CSRF token: got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, client, "POST", ts.URL+"/api/config", "{}", map[string]string{"Remote-User": "admin", csrfHeader: csrf}); resp.StatusCode != http.StatusOK {
+		t.Errorf("POST with CSRF token: got %d", resp.StatusCode)
+	}
+
+	untrusted, err := newAuthenticator(&config.Auth{Enabled: true, Proxy: &config.ProxyAuth{Enabled: true, TrustedProxies: []string{"10.0.0.0/8"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = untrusted
+	if resp := doRequest(t, client, "GET", ts.URL+"/api/tags", "", map[string]string{"Remote-User": "admin"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("header from an untrusted address: got %d", resp.StatusCode)
+	}
+}
+
+func TestAuth_LoginRateLimit(t *testing.T) {
+	useTestAuth(t, nil)
+	ts := newTestAuthServer(t)
+	for i := 0; i < loginMaxFailures; i++ {
+		doRequest(t, ts.Client(), "POST", ts.URL+"/api/auth/login", `{"username":"admin","password":"wrong"}`, nil)
+	}
+	if resp := doRequest(t, ts.Client(), "POST", ts.URL+"/api/auth/login", `{"username":"admin","password":"secret"}`, nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got %d", resp.StatusCode)
+	}
+}
+
+func TestNewAuthenticator_Invalid(t *testing.T) {
+	tests := []config.Auth{
+		{Enabled: true, Users: []config.AuthUser{{Username: "admin", PasswordHash: "plaintext"}}},
+		{Enabled: true, Tokens: []config.APIToken{{Name: "ci", TokenSHA256: "abc"}}},
+		{Enabled: true, Tokens: []config.APIToken{{Name: "ci", TokenSHA256: HashToken("x"), Role: "owner"}}},
+		{Enabled: true, Proxy: &config.ProxyAuth{Enabled: true}},
+	}
+	for i, conf := range tests {
+		if _, err := newAuthenticator(&conf); err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+	}
+}
+
+func TestGRPC_Auth(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: 00:00:00:00:00:00\n")
+	useTestAuth(t, nil)
+	client := newTestGRPCClient(t)
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	if _, err := client.ListTags(context.Background(), &gatewayv1.ListTagsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("without token: got %v", err)
+	}
+	if _, err := client.ListTags(withToken(testReadOnlyToken), &gatewayv1.ListTagsRequest{}); err != nil {
+		t.Errorf("read-only token: got %v", err)
+	}
+	if _, err := client.GetConfig(withToken(testReadOnlyToken), &gatewayv1.GetConfigRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetConfig with read-only token: got %v", err)
+	}
+	if _, err := client.GetConfig(withToken(testAdminToken), &gatewayv1.GetConfigRequest{}); err != nil {
+		t.Errorf("GetConfig with admin token: got %v", err)
+	}
+}
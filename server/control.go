@@ -0,0 +1,308 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/version"
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidMac is returned when a tag management request has a malformed MAC address
+	ErrInvalidMac = errors.New("invalid MAC address")
+	// ErrTagNotFound is returned when a tag has not been seen since the gateway was started
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrInvalidConfig is returned when a config sent by a client cannot be saved
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+var (
+	macPattern = regexp.MustCompile(`^([0-9A-F]{2}:){5}[0-9A-F]{2}$`)
+	startTime  = time.Now()
+	// store reads and writes the config file for the web UI and the APIs
+	store = config.NewStore("config.yml", nil)
+	// Layers and result of loading the config the gateway was started with
+	configLayers     config.Layers
+	effectiveConfig  config.Config
+	effectiveSources config.Sources
+)
+
+// SetConfigLayers sets how the running config was loaded, for ReloadConfig and EffectiveConfig
+func SetConfigLayers(layers config.Layers, c config.Config, sources config.Sources) {
+	configLayers = layers
+	effectiveConfig = c
+	effectiveSources = sources
+}
+
+// EffectiveConfig returns the values of the running config with the layer each came from,
+// the secrets are masked
+func EffectiveConfig() ([]config.EffectiveValue, error) {
+	return config.Effective(effectiveConfig, effectiveSources)
+}
+
+// Status is a snapshot of the gateway state, as reported by the MQTT control plane
+type Status struct {
+	Version       string            `json:"version"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	EnabledTags   []string          `json:"enabled_tags"`
+	TagNames      map[string]string `json:"tag_names"`
+	Tags          []Tag             `json:"tags"`
+}
+
+// Control exposes the tag management operations of the REST API to other integrations,
+// such as the MQTT control plane. Changes are persisted to the config file and applied live.
+type Control struct{}
+
+func (Control) SetTagName(mac string, name string) (map[string]string, error) {
+	return SetTagName(mac, name)
+}
+
+func (Control) SetTagEnabled(mac string, enabled bool) ([]string, error) {
+	return SetTagEnabled(mac, enabled)
+}
+
+func (Control) ReloadConfig() error {
+	return ReloadConfig()
+}
+
+func (Control) Status() interface{} {
+	return GetStatus()
+}
+
+func normalizeMac(mac string) (string, error) {
+	mac = strings.ToUpper(strings.TrimSpace(mac))
+	if !macPattern.MatchString(mac) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidMac, mac)
+	}
+	return mac, nil
+}
+
+// invalidConfigError is a config.ValidationError which matches ErrInvalidConfig
+type invalidConfigError struct {
+	config.ValidationError
+}
+
+func (e invalidConfigError) Is(target error) bool { return target == ErrInvalidConfig }
+
+func (e invalidConfigError) Unwrap() error { return e.ValidationError }
+
+// configError marks the validation errors of the config store as ErrInvalidConfig
+func configError(err error) error {
+	var invalid config.ValidationError
+	if errors.As(err, &invalid) {
+		return invalidConfigError{invalid}
+	}
+	return err
+}
+
+// updateConfigFile reads the config file, applies modify to it and writes it back
+func updateConfigFile(modify func(c *config.Config)) (config.Config, error) {
+	c, err := store.Update(func(c *config.Config) error {
+		modify(c)
+		return nil
+	})
+	return c, configError(err)
+}
+
+// GetConfig returns the config file with the secrets masked, for the API clients
+func GetConfig() (config.Config, error) {
+	c, err := store.Read()
+	if err != nil {
+		return c, err
+	}
+	config.MaskSecrets(&c)
+	return c, nil
+}
+
+// UpdateConfig replaces the config file. Masked secrets keep their stored values.
+// The gateway does not reload it, a restart is required.
+func UpdateConfig(c config.Config) error {
+	_, err := store.Update(func(stored *config.Config) error {
+		if err := config.RestoreSecrets(&c, *stored); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		*stored = c
+		return nil
+	})
+	return configError(err)
+}
+
+// ValidateConfig checks a config posted by the API clients without saving it. Masked secrets are
+// checked with their stored values. Like with UpdateConfig, the values which are invalid in the
+// stored config too are not reported.
+func ValidateConfig(c config.Config) error {
+	stored, err := store.Read()
+	if err != nil {
+		return err
+	}
+	var invalid config.ValidationError
+	if err := config.RestoreSecrets(&c, stored); err != nil {
+		var field config.FieldError
+		if !errors.As(err, &field) {
+			return err
+		}
+		invalid = append(invalid, field)
+	}
+	if err := config.ValidateChange(stored, c); err != nil {
+		var changed config.ValidationError
+		if !errors.As(err, &changed) {
+			return err
+		}
+		invalid = append(invalid, changed...)
+	}
+	if len(invalid) > 0 {
+		return configError(invalid)
+	}
+	return nil
+}
+
+// ConfigHistory returns the backups of the config file, newest first
+func ConfigHistory() ([]config.Backup, error) {
+	return store.History()
+}
+
+// RollbackConfig restores a backup of the config file, a restart is required to apply it
+func RollbackConfig(id string) error {
+	_, err := store.Rollback(id)
+	if err != nil {
+		return configError(err)
+	}
+	log.WithField("backup", id).Info("Config rolled back")
+	return nil
+}
+
+// ListTags returns the tags seen since the gateway was started, sorted by MAC
+func ListTags() []Tag {
+	tagsLock.RLock()
+	tags := make([]Tag, 0, len(recentTags))
+	for _, t := range recentTags {
+		tags = append(tags, t)
+	}
+	tagsLock.RUnlock()
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Mac < tags[j].Mac })
+	return tags
+}
+
+// GetTag returns the latest state of a tag
+func GetTag(mac string) (Tag, error) {
+	mac, err := normalizeMac(mac)
+	if err != nil {
+		return Tag{}, err
+	}
+	tagsLock.RLock()
+	defer tagsLock.RUnlock()
+	t, ok := recentTags[mac]
+	if !ok {
+		return Tag{}, fmt.Errorf("%w: %s", ErrTagNotFound, mac)
+	}
+	return t, nil
+}
+
+// SetTagEnabled adds or removes a tag from the enabled tags list, persists it to the config
+// file and applies it immediately. Returns the new list of enabled tags.
+func SetTagEnabled(mac string, enabled bool) ([]string, error) {
+	mac, err := normalizeMac(mac)
+	if err != nil {
+		return nil, err
+	}
+	c, err := updateConfigFile(func(c *config.Config) {
+		if enabled {
+			// Add to list if not present
+			for _, m := range c.EnabledTags {
+				if strings.EqualFold(m, mac) {
+					return
+				}
+			}
+			c.EnabledTags = append(c.EnabledTags, mac)
+		} else {
+			// Remove from list
+			newList := make([]string, 0, len(c.EnabledTags))
+			for _, m := range c.EnabledTags {
+				if !strings.EqualFold(m, mac) {
+					newList = append(newList, m)
+				}
+			}
+			c.EnabledTags = newList
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Update in-memory state for immediate effect (no restart required)
+	UpdateEnabledTags(c.EnabledTags)
+	log.WithFields(log.Fields{"mac": mac, "enabled": enabled}).Info("Tag enabled state updated")
+	return c.EnabledTags, nil
+}
+
+// SetTagName sets the name of a tag, or removes it when name is empty, persists it to the
+// config file and applies it immediately. Returns the new tag names.
+func SetTagName(mac string, name string) (map[string]string, error) {
+	mac, err := normalizeMac(mac)
+	if err != nil {
+		return nil, err
+	}
+	c, err := updateConfigFile(func(c *config.Config) {
+		if c.TagNames == nil {
+			c.TagNames = make(map[string]string)
+		}
+		if name == "" {
+			delete(c.TagNames, mac)
+		} else {
+			c.TagNames[mac] = name
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	UpdateTagNames(c.TagNames)
+	log.WithFields(log.Fields{"mac": mac, "name": name}).Info("Tag name updated")
+	return c.TagNames, nil
+}
+
+// ReloadConfig re-reads the config file and the overrides and applies the settings which can be
+// changed without a restart: enabled tags and tag names.
+func ReloadConfig() error {
+	layers := configLayers
+	layers.Path = store.Path()
+	c, _, err := layers.Load()
+	if err != nil {
+		return err
+	}
+	UpdateEnabledTags(c.EnabledTags)
+	UpdateTagNames(c.TagNames)
+	log.WithField("configfile", store.Path()).Info("Config reloaded")
+	return nil
+}
+
+// GetStatus returns a snapshot of the gateway state
+func GetStatus() Status {
+	return Status{
+		Version:       version.Version,
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+		EnabledTags:   GetEnabledTags(),
+		TagNames:      GetTagNames(),
+		Tags:          ListTags(),
+	}
+}
+
+func writeControlError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidMac) || errors.Is(err, ErrInvalidConfig) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrTagNotFound) || errors.Is(err, config.ErrBackupNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.WithError(err).Error("Failed to update config")
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	gatewayv1 "github.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcService implements the gRPC API with the same functions as the REST handlers
+type grpcService struct {
+	gatewayv1.UnimplementedGatewayServiceServer
+}
+
+// grpcError converts the errors of the shared handler functions to gRPC status errors
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidMac), errors.Is(err, errUnknownField), errors.Is(err, ErrInvalidConfig):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrTagNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		log.WithError(err).Error("gRPC request failed")
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// tagProto converts a tag, the name and enabled state are read from the live tag state
+func tagProto(t Tag) *gatewayv1.Tag {
+	name, _ := GetTagName(t.Mac)
+	return &gatewayv1.Tag{
+		Mac:                       t.Mac,
+		Name:                      name,
+		Enabled:                   IsTagEnabled(t.Mac),
+		LastSeen:                  timestamppb.New(time.UnixMilli(t.LastSeen)),
+		Rssi:                      t.Rssi,
+		DataFormat:                t.DataFormat,
+		Temperature:               t.Temperature,
+		Humidity:                  t.Humidity,
+		Pressure:                  t.Pressure,
+		BatteryVoltage:            t.BatteryVoltage,
+		TxPower:                   t.TxPower,
+		MovementCounter:           t.MovementCounter,
+		MeasurementSequenceNumber: t.MeasurementSequenceNumber,
+		Pm1P0:                     t.Pm1p0,
+		Pm2P5:                     t.Pm2p5,
+		Pm4P0:                     t.Pm4p0,
+		Pm10P0:                    t.Pm10p0,
+		Co2:                       t.CO2,
+		Voc:                       t.VOC,
+		Nox:                       t.NOX,
+		Illuminance:               t.Illuminance,
+		SoundInstant:              t.SoundInstant,
+		SoundAverage:              t.SoundAverage,
+		SoundPeak:                 t.SoundPeak,
+		AirQualityIndex:           t.AirQualityIndex,
+	}
+}
+
+// grpcIdentityFields are always sent regardless of the fields filter
+var grpcIdentityFields = map[protoreflect.Name]bool{"mac": true, "name": true, "enabled": true, "last_seen": true}
+
+// filterFields clears the measurement fields which were not selected, the proto field names are the same as the JSON names
+func (f streamFilter) filterFields(t *gatewayv1.Tag) {
+	if len(f.fields) == 0 {
+		return
+	}
+	m := t.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		name := fields.Get(i).Name()
+		if !grpcIdentityFields[name] && !f.fields[string(name)] {
+			m.Clear(fields.Get(i))
+		}
+	}
+}
+
+func (grpcService) StreamMeasurements(req *gatewayv1.StreamMeasurementsRequest, stream grpc.ServerStreamingServer[gatewayv1.StreamMeasurementsResponse]) error {
+	filter, err := parseStreamFilter(url.Values{"mac": req.Macs, "fields": req.Fields})
+	if err != nil {
+		return grpcError(err)
+	}
+	client := hub.subscribe(filter, "grpc")
+	defer hub.unsubscribe(client)
+	if req.Snapshot {
+		client.snapshot()
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-client.notify:
+			tags, coalesced := client.take()
+			for _, t := range tags {
+				tag := tagProto(t)
+				filter.filterFields(tag)
+				// HTTP/2 flow control blocks Send for slow clients, meanwhile updates are coalesced in the client buffer
+				if err := stream.Send(&gatewayv1.StreamMeasurementsResponse{Tag: tag, Coalesced: coalesced}); err != nil {
+					return err
+				}
+				coalesced = 0
+			}
+		}
+	}
+}
+
+func (grpcService) ListTags(context.Context, *gatewayv1.ListTagsRequest) (*gatewayv1.ListTagsResponse, error) {
+	tags := ListTags()
+	resp := &gatewayv1.ListTagsResponse{Tags: make([]*gatewayv1.Tag, len(tags))}
+	for i, t := range tags {
+		resp.Tags[i] = tagProto(t)
+	}
+	return resp, nil
+}
+
+func (grpcService) GetTag(_ context.Context, req *gatewayv1.GetTagRequest) (*gatewayv1.GetTagResponse, error) {
+	t, err := GetTag(req.Mac)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewayv1.GetTagResponse{Tag: tagProto(t)}, nil
+}
+
+func (grpcService) SetTagName(_ context.Context, req *gatewayv1.SetTagNameRequest) (*gatewayv1.SetTagNameResponse, error) {
+	names, err := SetTagName(req.Mac, req.Name)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewayv1.SetTagNameResponse{TagNames: names}, nil
+}
+
+func (grpcService) SetTagEnabled(_ context.Context, req *gatewayv1.SetTagEnabledRequest) (*gatewayv1.SetTagEnabledResponse, error) {
+	tags, err := SetTagEnabled(req.Mac, req.Enabled)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewayv1.SetTagEnabledResponse{EnabledTags: tags}, nil
+}
+
+func (grpcService) GetConfig(context.Context, *gatewayv1.GetConfigRequest) (*gatewayv1.GetConfigResponse, error) {
+	c, err := GetConfig()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	// The struct has the same JSON structure as GET /api/config
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	s := &structpb.Struct{}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewayv1.GetConfigResponse{Config: s}, nil
+}
+
+func (grpcService) UpdateConfig(_ context.Context, req *gatewayv1.UpdateConfigRequest) (*gatewayv1.UpdateConfigResponse, error) {
+	if req.Config == nil {
+		return nil, status.Error(codes.InvalidArgument, "config is required")
+	}
+	data, err := req.Config.MarshalJSON()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var c config.Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid config: %v", err)
+	}
+	if err := UpdateConfig(c); err != nil {
+		return nil, grpcError(err)
+	}
+	return &gatewayv1.UpdateConfigResponse{}, nil
+}
+
+// newGRPCServer returns a gRPC server with the gateway service and server reflection for tools like grpcurl.
+// With a TLS config the server only accepts TLS connections.
+func newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			// Detect dead streaming clients
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+		// The same API tokens as the REST API when auth is enabled
+		grpc.UnaryInterceptor(authUnaryInterceptor),
+		grpc.StreamInterceptor(authStreamInterceptor),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := grpc.NewServer(opts...)
+	gatewayv1.RegisterGatewayServiceServer(s, grpcService{})
+	reflection.Register(s)
+	return s
+}
+
+// startGRPC serves the gRPC API when it is enabled in the config. The API tokens are sent on every
+// call, so the API uses the same certificate as the web UI when HTTPS is enabled.
+func startGRPC(conf *config.GRPCListener, tlsConfig *tls.Config) {
+	if conf == nil || (conf.Enabled != nil && !*conf.Enabled) {
+		return
+	}
+	port := conf.Port
+	if port == 0 {
+		port = 9090
+	}
+	addr := fmt.Sprintf(":%d", port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.WithError(err).WithField("addr", addr).Error("Failed to start gRPC server")
+		return
+	}
+	log.WithFields(log.Fields{
+		"addr": addr,
+		"tls":  tlsConfig != nil,
+	}).Info("Starting gRPC API")
+	go func() {
+		if err := newGRPCServer(tlsConfig).Serve(listener); err != nil {
+			log.WithError(err).Error("gRPC server failed")
+		}
+	}()
+}
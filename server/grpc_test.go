@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	gatewayv1 "github.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestGRPCClient(t *testing.T) gatewayv1.GatewayServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	s := newGRPCServer(nil)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gatewayv1.NewGatewayServiceClient(conn)
+}
+
+// useTestConfigFile points the config file to a temporary copy for the test
+func useTestConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := store
+	store = config.NewStore(path, nil)
+	InitEnabledTags(nil)
+	InitTagNames(nil)
+	t.Cleanup(func() {
+		store = previous
+		InitEnabledTags(nil)
+		InitTagNames(nil)
+	})
+}
+
+func TestGRPC_Tags(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: 00:00:00:00:00:00\n")
+	client := newTestGRPCClient(t)
+	ctx := context.Background()
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:10", 19.5))
+
+	resp, err := client.GetTag(ctx, &gatewayv1.GetTagRequest{Mac: "aa:bb:cc:dd:ee:10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tag.Mac != "AA:BB:CC:DD:EE:10" || resp.Tag.GetTemperature() != 19.5 || !resp.Tag.Enabled {
+		t.Errorf("got %v", resp.Tag)
+	}
+
+	if _, err := client.GetTag(ctx, &gatewayv1.GetTagRequest{Mac: "AA:BB:CC:DD:EE:99"}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown tag: got %v", err)
+	}
+	if _, err := client.GetTag(ctx, &gatewayv1.GetTagRequest{Mac: "invalid"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid MAC: got %v", err)
+	}
+
+	list, err := client.ListTags(ctx, &gatewayv1.ListTagsRequest{})
+	if err != nil || len(list.Tags) == 0 {
+		t.Fatalf("ListTags: %v %v", list, err)
+	}
+
+	names, err := client.SetTagName(ctx, &gatewayv1.SetTagNameRequest{Mac: "AA:BB:CC:DD:EE:10", Name: "Sauna"})
+	if err != nil || names.TagNames["AA:BB:CC:DD:EE:10"] != "Sauna" {
+		t.Fatalf("SetTagName: %v %v", names, err)
+	}
+	enabled, err := client.SetTagEnabled(ctx, &gatewayv1.SetTagEnabledRequest{Mac: "AA:BB:CC:DD:EE:11", Enabled: true})
+	if err != nil || len(enabled.EnabledTags) != 1 {
+		t.Fatalf("SetTagEnabled: %v %v", enabled, err)
+	}
+	resp, err = client.GetTag(ctx, &gatewayv1.GetTagRequest{Mac: "AA:BB:CC:DD:EE:10"})
+	if err != nil || resp.Tag.Name != "Sauna" || resp.Tag.Enabled {
+		t.Errorf("after update: got %v %v", resp, err)
+	}
+}
+
+func TestGRPC_StreamMeasurements(t *testing.T) {
+	client := newTestGRPCClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:20", 1))
+
+	stream, err := client.StreamMeasurements(ctx, &gatewayv1.StreamMeasurementsRequest{
+		Macs:     []string{"AA:BB:CC:DD:EE:20"},
+		Fields:   []string{"temperature"},
+		Snapshot: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tag.GetTemperature() != 1 || resp.Tag.Humidity != nil || resp.Tag.LastSeen == nil {
+		t.Errorf("snapshot: got %v", resp.Tag)
+	}
+
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:21", 2))
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:20", 3))
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tag.Mac != "AA:BB:CC:DD:EE:20" || resp.Tag.GetTemperature() != 3 {
+		t.Errorf("update: got %v", resp.Tag)
+	}
+
+	invalid, err := client.StreamMeasurements(ctx, &gatewayv1.StreamMeasurementsRequest{Fields: []string{"unknown"}})
+	if err == nil {
+		_, err = invalid.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid filter: got %v", err)
+	}
+}
+
+func TestGRPC_Config(t *testing.T) {
+	useTestConfigFile(t, "gw_mac: 00:00:00:00:00:00\ntag_names:\n  AA:BB:CC:DD:EE:FF: Garage\n")
+	client := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	resp, err := client.GetConfig(ctx, &gatewayv1.GetConfigRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Config.Fields["tag_names"].GetStructValue().Fields["AA:BB:CC:DD:EE:FF"].GetStringValue() != "Garage" {
+		t.Errorf("got %v", resp.Config)
+	}
+
+	resp.Config.Fields["debug"] = structpb.NewBoolValue(true)
+	if _, err := client.UpdateConfig(ctx, &gatewayv1.UpdateConfigRequest{Config: resp.Config}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetConfig()
+	if err != nil || !c.Debug || c.TagNames["AA:BB:CC:DD:EE:FF"] != "Garage" {
+		t.Errorf("after update: got %+v %v", c, err)
+	}
+
+	if _, err := client.UpdateConfig(ctx, &gatewayv1.UpdateConfigRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("missing config: got %v", err)
+	}
+}
+
+// The fields filter uses the same names for the JSON and gRPC streams
+func TestGRPC_FieldNames(t *testing.T) {
+	fields := (&gatewayv1.Tag{}).ProtoReflect().Descriptor().Fields()
+	for name := range streamFields {
+		if fields.ByName(protoreflect.Name(name)) == nil {
+			t.Errorf("field %s is missing from the Tag message", name)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/common/metrics"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+)
+
+var errUnknownField = errors.New("unknown field")
+
+// streamFields are the JSON names of the Tag fields which can be selected with the fields filter
+var streamFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Tag{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// streamFilter selects the tags and fields sent to a live stream client, empty sets match everything
+type streamFilter struct {
+	macs   map[string]bool
+	fields map[string]bool
+}
+
+// splitQuery returns the values of a repeatable, comma separated query parameter
+func splitQuery(query url.Values, key string) []string {
+	var values []string
+	for _, value := range query[key] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseStreamFilter reads the filter from the mac and fields query parameters, eg.
+// ?mac=AA:BB:CC:DD:EE:FF,11:22:33:44:55:66&fields=temperature,humidity
+func parseStreamFilter(query url.Values) (streamFilter, error) {
+	filter := streamFilter{macs: make(map[string]bool), fields: make(map[string]bool)}
+	for _, value := range splitQuery(query, "mac") {
+		mac, err := normalizeMac(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.macs[mac] = true
+	}
+	for _, field := range splitQuery(query, "fields") {
+		if !streamFields[field] {
+			return filter, fmt.Errorf("%w: %q", errUnknownField, field)
+		}
+		filter.fields[field] = true
+	}
+	return filter, nil
+}
+
+func (f streamFilter) match(t Tag) bool {
+	return len(f.macs) == 0 || f.macs[t.Mac]
+}
+
+// encode returns the tag as JSON with only the selected fields, the MAC and last seen time are always included
+func (f streamFilter) encode(t Tag) ([]byte, error) {
+	data, err := json.Marshal(t)
+	if err != nil || len(f.fields) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := map[string]json.RawMessage{"mac": all["mac"], "last_seen": all["last_seen"]}
+	for field := range f.fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return json.Marshal(selected)
+}
+
+// streamClient buffers the updates of one live stream client. Only the latest update of every tag
+// is kept, so a slow client gets the current values instead of blocking the gateway or growing
+// an unbounded queue.
+type streamClient struct {
+	filter    streamFilter
+	transport string
+	notify    chan struct{}
+
+	mu        sync.Mutex
+	pending   map[string]Tag
+	order     []string
+	coalesced uint64
+}
+
+func (c *streamClient) offer(t Tag) {
+	if !c.filter.match(t) {
+		return
+	}
+	c.mu.Lock()
+	if _, ok := c.pending[t.Mac]; ok {
+		c.coalesced++
+		metrics.StreamCoalesced.WithLabelValues(c.transport).Inc()
+	} else {
+		c.order = append(c.order, t.Mac)
+	}
+	c.pending[t.Mac] = t
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the buffered updates in arrival order and the number of updates replaced since the last call
+func (c *streamClient) take() ([]Tag, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags := make([]Tag, 0, len(c.order))
+	for _, mac := range c.order {
+		tags = append(tags, c.pending[mac])
+	}
+	coalesced := c.coalesced
+	c.pending = make(map[string]Tag)
+	c.order = nil
+	c.coalesced = 0
+	return tags, coalesced
+}
+
+// streamHub fans out the tag updates to the live stream clients
+type streamHub struct {
+	mu      sync.RWMutex
+	clients map[*streamClient]struct{}
+}
+
+var hub = &streamHub{clients: make(map[*streamClient]struct{})}
+
+func (h *streamHub) subscribe(filter streamFilter, transport string) *streamClient {
+	c := &streamClient{
+		filter:    filter,
+		transport: transport,
+		notify:    make(chan struct{}, 1),
+		pending:   make(map[string]Tag),
+	}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	metrics.StreamClients.WithLabelValues(transport).Inc()
+	return c
+}
+
+func (h *streamHub) unsubscribe(c *streamClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	metrics.StreamClients.WithLabelValues(c.transport).Dec()
+}
+
+func (h *streamHub) publish(t Tag) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		c.offer(t)
+	}
+}
+
+// snapshot queues the current state of the matching tags, for clients which asked for it with ?snapshot=true
+func (c *streamClient) snapshot() {
+	list := ListTags()
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen < list[j].LastSeen })
+	for _, t := range list {
+		c.offer(t)
+	}
+}
+
+func writeStreamFilterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidMac) || errors.Is(err, errUnknownField) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// handleStream sends the tag updates as Server-Sent Events. Every update is a message with the same JSON
+// as the /api/tags entries, updates which a slow client missed are reported with a "coalesced" event.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseStreamFilter(r.URL.Query())
+	if err != nil {
+		writeStreamFilterError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	client := hub.subscribe(filter, "sse")
+	defer hub.unsubscribe(client)
+	if r.URL.Query().Get("snapshot") == "true" {
+		client.snapshot()
+	}
+
+	write := func(format string, args ...interface{}) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := write("retry: %d\n\n", (5 * time.Second).Milliseconds()); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-client.notify:
+			tags, coalesced := client.take()
+			if coalesced > 0 {
+				if err := write("event: coalesced\ndata: {\"count\":%d}\n\n", coalesced); err != nil {
+					return
+				}
+			}
+			for _, t := range tags {
+				data, err := filter.encode(t)
+				if err != nil {
+					log.WithError(err).Error("Failed to encode stream message")
+					continue
+				}
+				if err := write("id: %d\ndata: %s\n\n", t.LastSeen, data); err != nil {
+					log.WithError(err).Debug("Live stream client disconnected")
+					return
+				}
+			}
+		}
+	}
+}
+
+// streamMessage is a WebSocket message, Data is the tag for "measurement" messages
+// and {"count": n} for "coalesced" messages
+type streamMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// handleWebSocket sends the tag updates as WebSocket text messages with the same filters as handleStream
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r.URL.Query())
+	if err != nil {
+		writeStreamFilterError(w, err)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied to the client
+		return
+	}
+	defer conn.Close()
+
+	client := hub.subscribe(filter, "websocket")
+	defer hub.unsubscribe(client)
+	if r.URL.Query().Get("snapshot") == "true" {
+		client.snapshot()
+	}
+
+	// The read loop handles pongs and close frames, messages from the client are ignored
+	closed := make(chan struct{})
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeatInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeatInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(messageType string, data []byte) error {
+		message, err := json.Marshal(streamMessage{Type: messageType, Data: data})
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, message)
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case <-client.notify:
+			tags, coalesced := client.take()
+			if coalesced > 0 {
+				if err := send("coalesced", []byte(fmt.Sprintf(`{"count":%d}`, coalesced))); err != nil {
+					return
+				}
+			}
+			for _, t := range tags {
+				data, err := filter.encode(t)
+				if err != nil {
+					log.WithError(err).Error("Failed to encode stream message")
+					continue
+				}
+				if err := send("measurement", data); err != nil {
+					log.WithError(err).Debug("Live stream client disconnected")
+					return
+				}
+			}
+		}
+	}
+}
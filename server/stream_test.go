@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	"github.com/gorilla/websocket"
+)
+
+func testMeasurement(mac string, temperature float64) parser.Measurement {
+	humidity := 40.0
+	m := parser.Measurement{}
+	m.Mac = mac
+	m.DataFormat = 5
+	m.Temperature = &temperature
+	m.Humidity = &humidity
+	return m
+}
+
+func TestParseStreamFilter(t *testing.T) {
+	filter, err := parseStreamFilter(url.Values{"mac": {"aa:bb:cc:dd:ee:ff,11:22:33:44:55:66"}, "fields": {"temperature", "humidity"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.macs["AA:BB:CC:DD:EE:FF"] || !filter.macs["11:22:33:44:55:66"] || len(filter.fields) != 2 {
+		t.Errorf("got %+v", filter)
+	}
+	for _, query := range []url.Values{{"mac": {"invalid"}}, {"fields": {"temperature,unknown"}}} {
+		if _, err := parseStreamFilter(query); err == nil {
+			t.Errorf("%v: expected an error", query)
+		}
+	}
+}
+
+func TestStreamClient_Coalesce(t *testing.T) {
+	c := hub.subscribe(streamFilter{}, "test")
+	defer hub.unsubscribe(c)
+	c.offer(Tag{Mac: "AA:BB:CC:DD:EE:FF", LastSeen: 1})
+	c.offer(Tag{Mac: "11:22:33:44:55:66", LastSeen: 2})
+	c.offer(Tag{Mac: "AA:BB:CC:DD:EE:FF", LastSeen: 3})
+	tags, coalesced := c.take()
+	if len(tags) != 2 || coalesced != 1 || tags[0].LastSeen != 3 || tags[1].Mac != "11:22:33:44:55:66" {
+		t.Errorf("got %+v, %d coalesced", tags, coalesced)
+	}
+}
+
+func TestHandleStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?mac=AA:BB:CC:DD:EE:01&fields=temperature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("content type: got %s", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	// The retry line is written after the client has subscribed
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("got %q (%v)", line, err)
+	}
+
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:02", 10))
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:01", 21.5))
+
+	var data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ = strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if strings.HasPrefix(line, "id:") {
+			data = ""
+		}
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message["mac"] != "AA:BB:CC:DD:EE:01" || message["temperature"] != 21.5 || message["last_seen"] == nil || message["humidity"] != nil {
+		t.Errorf("got %s", data)
+	}
+
+	resp, err = http.Get(srv.URL + "?fields=unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid filter: got status %d", resp.StatusCode)
+	}
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	UpdateTag(testMeasurement("AA:BB:CC:DD:EE:03", 5))
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?mac=AA:BB:CC:DD:EE:03&snapshot=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message streamMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	var tag Tag
+	if err := json.Unmarshal(message.Data, &tag); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "measurement" || tag.Mac != "AA:BB:CC:DD:EE:03" || *tag.Temperature != 5 {
+		t.Errorf("got %s %s", message.Type, message.Data)
+	}
+}
@@ -80,3 +80,45 @@ func GetEnabledTags() []string {
 	copy(result, enabledTags)
 	return result
 }
+
+var (
+	tagNames     map[string]string
+	tagNamesLock sync.RWMutex
+)
+
+// InitTagNames initializes the tag names from config at startup.
+func InitTagNames(names map[string]string) {
+	UpdateTagNames(names)
+}
+
+// UpdateTagNames replaces the tag names (called by API after config change).
+func UpdateTagNames(names map[string]string) {
+	tagNamesLock.Lock()
+	defer tagNamesLock.Unlock()
+
+	tagNames = make(map[string]string, len(names))
+	for mac, name := range names {
+		tagNames[strings.ToUpper(mac)] = name
+	}
+}
+
+// GetTagName returns the configured name of the tag with the given MAC.
+func GetTagName(mac string) (string, bool) {
+	tagNamesLock.RLock()
+	defer tagNamesLock.RUnlock()
+
+	name, ok := tagNames[strings.ToUpper(mac)]
+	return name, ok && name != ""
+}
+
+// GetTagNames returns a copy of the current tag names.
+func GetTagNames() map[string]string {
+	tagNamesLock.RLock()
+	defer tagNamesLock.RUnlock()
+
+	result := make(map[string]string, len(tagNames))
+	for mac, name := range tagNames {
+		result[mac] = name
+	}
+	return result
+}
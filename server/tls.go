@@ -0,0 +1,259 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+	// Self-signed certificates are renewed when they expire sooner than this
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// certReloader serves the certificate from the files and loads it again when the files change,
+// so that certificates rotated by eg. certbot are used without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	// Regenerates the self-signed certificate before it expires, nil for user provided certificates
+	renew func() error
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if r.interval == 0 {
+		r.interval = time.Minute
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// filesModTime returns the latest modification time of the certificate and key files
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	return nil
+}
+
+// reload loads the files again if they have changed since the last check, the current certificate
+// is kept when the new files are invalid, eg. while only one of them has been replaced
+func (r *certReloader) reload() {
+	r.checked = time.Now()
+	if r.renew != nil && time.Until(r.cert.Leaf.NotAfter) < selfSignedRenewBefore {
+		if err := r.renew(); err != nil {
+			log.WithError(err).Error("Failed to renew the self-signed certificate")
+		}
+	}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		log.WithError(err).Warn("Failed to check the TLS certificate files")
+		return
+	}
+	if modTime.Equal(r.modTime) {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.WithError(err).Warn("Failed to reload the TLS certificate, keeping the current one")
+		return
+	}
+	log.WithFields(log.Fields{"cert_file": r.certFile, "expires": r.cert.Leaf.NotAfter}).Info("Reloaded the TLS certificate")
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= r.interval {
+		r.reload()
+	}
+	return r.cert, nil
+}
+
+// selfSignedHosts returns the names and addresses of the self-signed certificate: localhost,
+// the hostname, the addresses of the network interfaces and the configured hosts
+func selfSignedHosts(extra []string) ([]string, []net.IP) {
+	names := []string{"localhost"}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		names = append(names, hostname, hostname+".local")
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	for _, host := range extra {
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			names = append(names, host)
+		}
+	}
+	return names, ips
+}
+
+// writeSelfSigned generates a self-signed certificate and writes it to the files, the key is only readable by the owner
+func writeSelfSigned(certFile string, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	names, ips := selfSignedHosts(hosts)
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Ruuvi Gateway", Organization: []string{"ruuvi-go-gateway"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	// Write the key first, the reloader only picks up the pair after the certificate has changed too
+	if err := writeFileAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"cert_file": certFile, "names": names, "addresses": ips}).Info("Generated a self-signed TLS certificate")
+	return nil
+}
+
+// writeFileAtomic replaces the file with a rename so that readers never see a partially written file
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ensureSelfSigned returns the files of the persisted self-signed certificate, it is generated
+// when it does not exist yet or expires soon
+func ensureSelfSigned(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, "selfsigned.crt")
+	keyFile := filepath.Join(dir, "selfsigned.key")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil && time.Until(cert.Leaf.NotAfter) > selfSignedRenewBefore {
+		return certFile, keyFile, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithError(err).Warn("Invalid self-signed TLS certificate, generating a new one")
+	}
+	if err := writeSelfSigned(certFile, keyFile, hosts); err != nil {
+		return "", "", fmt.Errorf("failed to generate a self-signed certificate: %w", err)
+	}
+	return certFile, keyFile, nil
+}
+
+// newTLSConfig returns the TLS config of the management server with either the configured or a self-signed certificate
+func newTLSConfig(conf *config.HTTPTLS) (*tls.Config, error) {
+	var reloader *certReloader
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		if conf.CertFile == "" || conf.KeyFile == "" {
+			return nil, errors.New("both cert_file and key_file are required")
+		}
+		var err error
+		if reloader, err = newCertReloader(conf.CertFile, conf.KeyFile, time.Duration(conf.ReloadInterval)); err != nil {
+			return nil, fmt.Errorf("failed to load the TLS certificate: %w", err)
+		}
+	} else {
+		dir := conf.CertDir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(store.Path()), "tls")
+		}
+		certFile, keyFile, err := ensureSelfSigned(dir, conf.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		if reloader, err = newCertReloader(certFile, keyFile, time.Duration(conf.ReloadInterval)); err != nil {
+			return nil, fmt.Errorf("failed to load the self-signed certificate: %w", err)
+		}
+		reloader.renew = func() error { return writeSelfSigned(certFile, keyFile, conf.Hosts) }
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// redirectToHTTPS redirects plain HTTP requests to the same host on the HTTPS port
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(httpsPort)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	gatewayv1 "github.com/Saavuori/ruuvi-go-gateway/proto/ruuvi/gateway/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, err := ensureSelfSigned(dir, []string{"gateway.example", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("gateway.example"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("192.0.2.10"); err != nil {
+		t.Error(err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode: %v %v", info.Mode(), err)
+	}
+
+	// The persisted certificate is reused
+	if _, _, err := ensureSelfSigned(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	again, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+		t.Error("self-signed certificate was regenerated")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := writeSelfSigned(certFile, keyFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := newCertReloader(certFile, keyFile, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := r.GetCertificate(nil)
+
+	// An invalid file keeps the current certificate
+	if err := os.WriteFile(certFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := r.GetCertificate(nil); cert != first {
+		t.Error("invalid certificate was loaded")
+	}
+
+	if err := writeSelfSigned(certFile, keyFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure that the modification time changes on file systems with a coarse resolution
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	cert, _ := r.GetCertificate(nil)
+	if cert == first || cert.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Error("rotated certificate was not loaded")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	if _, err := newTLSConfig(&config.HTTPTLS{Enabled: true, CertFile: "cert.pem"}); err == nil {
+		t.Error("expected an error without key_file")
+	}
+	tlsConf, err := newTLSConfig(&config.HTTPTLS{Enabled: true, CertDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "Ruuvi Gateway" {
+		t.Errorf("got %v", resp.TLS)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	w := httptest.NewRecorder()
+	redirectToHTTPS(8443).ServeHTTP(w, httptest.NewRequest("POST", "http://gateway.local:8080/api/tags?x=1", nil))
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://gateway.local:8443/api/tags?x=1" {
+		t.Errorf("got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestGRPC_TLS(t *testing.T) {
+	tlsConf, err := newTLSConfig(&config.HTTPTLS{Enabled: true, CertDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newGRPCServer(tlsConf)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	call := func(creds credentials.TransportCredentials) error {
+		conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = gatewayv1.NewGatewayServiceClient(conn).ListTags(ctx, &gatewayv1.ListTagsRequest{})
+		return err
+	}
+	if err := call(insecure.NewCredentials()); err == nil {
+		t.Error("plaintext call succeeded")
+	}
+	if err := call(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})); err != nil {
+		t.Errorf("TLS call: %v", err)
+	}
+}
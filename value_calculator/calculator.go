@@ -6,6 +6,19 @@ import (
 	"github.com/Saavuori/ruuvi-go-gateway/parser"
 )
 
+// CalculatedFields are the fields set by CalcExtendedValues, by their JSON names
+var CalculatedFields = []string{
+	"accelerationTotal",
+	"accelerationAngleFromX",
+	"accelerationAngleFromY",
+	"accelerationAngleFromZ",
+	"equilibriumVaporPressure",
+	"absoluteHumidity",
+	"dewPoint",
+	"airDensity",
+	"airQualityIndex",
+}
+
 func CalcExtendedValues(m *parser.Measurement) {
 	// from https://github.com/Scrin/RuuviCollector/blob/master/src/main/java/fi/tkgwf/ruuvi/utils/MeasurementValueCalculator.java
 	f64 := func(value float64) *float64 { return &value }
@@ -0,0 +1,197 @@
+package value_smoother
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWindow = 5
+	defaultAlpha  = 0.3
+)
+
+// filter smooths the values of one field of one tag
+type filter interface {
+	next(v float64) float64
+}
+
+type movingAverage struct {
+	window int
+	values []float64
+	sum    float64
+}
+
+func (f *movingAverage) next(v float64) float64 {
+	f.values = append(f.values, v)
+	f.sum += v
+	if len(f.values) > f.window {
+		f.sum -= f.values[0]
+		f.values = f.values[1:]
+	}
+	return f.sum / float64(len(f.values))
+}
+
+type ewma struct {
+	alpha   float64
+	value   float64
+	started bool
+}
+
+func (f *ewma) next(v float64) float64 {
+	if !f.started {
+		f.value = v
+		f.started = true
+	} else {
+		f.value = f.alpha*v + (1-f.alpha)*f.value
+	}
+	return f.value
+}
+
+// median rejects spikes shorter than half of the window
+type median struct {
+	window int
+	values []float64
+	sorted []float64
+}
+
+func (f *median) next(v float64) float64 {
+	f.values = append(f.values, v)
+	if len(f.values) > f.window {
+		f.values = f.values[1:]
+	}
+	f.sorted = append(f.sorted[:0], f.values...)
+	sort.Float64s(f.sorted)
+	n := len(f.sorted)
+	if n%2 == 1 {
+		return f.sorted[n/2]
+	}
+	return (f.sorted[n/2-1] + f.sorted[n/2]) / 2
+}
+
+func newFilter(conf config.SmoothingFilter) filter {
+	window := conf.Window
+	if window <= 0 {
+		window = defaultWindow
+	}
+	switch strings.ToLower(conf.Type) {
+	case "moving_average":
+		return &movingAverage{window: window}
+	case "ewma":
+		alpha := conf.Alpha
+		if alpha <= 0 || alpha > 1 {
+			alpha = defaultAlpha
+		}
+		return &ewma{alpha: alpha}
+	case "median":
+		return &median{window: window}
+	default:
+		return nil
+	}
+}
+
+type smoothedField struct {
+	field   parser.Field
+	filters []config.SmoothingFilter
+}
+
+// Smoother runs the smoothing filters of each field per tag. The state of a tag is kept
+// from its first measurement, so it should only be given the enabled tags.
+type Smoother struct {
+	fields     []smoothedField
+	publishRaw bool
+
+	mu sync.Mutex
+	// Filters of each tag, indexed like fields
+	tags map[string][][]filter
+}
+
+// New returns nil when no field is smoothed, a nil Smoother passes the measurements unchanged
+func New(conf *config.Smoothing) *Smoother {
+	if conf == nil || len(conf.Fields) == 0 {
+		return nil
+	}
+	s := &Smoother{publishRaw: conf.PublishRaw, tags: make(map[string][][]filter)}
+	// In the order of parser.Fields, so the filters are applied in the same order every time
+	for _, f := range parser.Fields {
+		filters, ok := conf.Fields[f.Name]
+		if !ok || len(filters) == 0 {
+			continue
+		}
+		if f.Kind == parser.BoolField {
+			log.WithField("field", f.Name).Warn("Ignoring smoothing of a field which is not numeric")
+			continue
+		}
+		s.fields = append(s.fields, smoothedField{field: f, filters: filters})
+	}
+	for name := range conf.Fields {
+		if _, ok := parser.FieldByName(name); !ok {
+			log.WithField("field", name).Warn("Ignoring smoothing of an unknown field")
+		}
+	}
+	if len(s.fields) == 0 {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"fields":      len(s.fields),
+		"publish_raw": s.publishRaw,
+	}).Info("Smoothing measurements")
+	return s
+}
+
+func (s *Smoother) tagFilters(mac string) [][]filter {
+	filters, ok := s.tags[mac]
+	if ok {
+		return filters
+	}
+	filters = make([][]filter, len(s.fields))
+	for i, f := range s.fields {
+		for _, conf := range f.filters {
+			if filter := newFilter(conf); filter != nil {
+				filters[i] = append(filters[i], filter)
+			} else {
+				log.WithFields(log.Fields{
+					"field": f.field.Name,
+					"type":  conf.Type,
+				}).Warn("Ignoring unknown smoothing filter")
+			}
+		}
+	}
+	s.tags[mac] = filters
+	return filters
+}
+
+// Apply returns the measurement with the smoothed values, and the unfiltered values in Raw
+// when they are published
+func (s *Smoother) Apply(m parser.Measurement) parser.Measurement {
+	if s == nil {
+		return m
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filters := s.tagFilters(strings.ToUpper(m.Mac))
+	var raw map[string]float64
+	for i, f := range s.fields {
+		v, ok := f.field.Float(m)
+		if !ok {
+			continue
+		}
+		if s.publishRaw {
+			if raw == nil {
+				raw = make(map[string]float64)
+			}
+			raw[f.field.Name] = v
+		}
+		smoothed := v
+		for _, filter := range filters[i] {
+			smoothed = filter.next(smoothed)
+		}
+		f.field.SetFloat(&m, smoothed)
+	}
+	m.Raw = raw
+	return m
+}
@@ -0,0 +1,80 @@
+package value_smoother
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Saavuori/ruuvi-go-gateway/config"
+	"github.com/Saavuori/ruuvi-go-gateway/parser"
+)
+
+func measurement(mac string, pm2p5 float64, rssi int64) parser.Measurement {
+	m := parser.Measurement{}
+	m.Mac = mac
+	m.Pm2p5 = &pm2p5
+	m.Rssi = &rssi
+	return m
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   config.SmoothingFilter
+		values []float64
+		want   []float64
+	}{
+		{"moving average", config.SmoothingFilter{Type: "moving_average", Window: 3}, []float64{3, 6, 9, 12}, []float64{3, 4.5, 6, 9}},
+		{"ewma", config.SmoothingFilter{Type: "ewma", Alpha: 0.5}, []float64{10, 20, 20}, []float64{10, 15, 17.5}},
+		{"median", config.SmoothingFilter{Type: "median", Window: 3}, []float64{5, 100, 6, 7, 5}, []float64{5, 52.5, 6, 7, 6}},
+		{"default window", config.SmoothingFilter{Type: "MEDIAN"}, []float64{1, 9, 2, 3, 8, 4}, []float64{1, 5, 2, 2.5, 3, 4}},
+	}
+	for _, tt := range tests {
+		f := newFilter(tt.conf)
+		for i, v := range tt.values {
+			if got := f.next(v); math.Abs(got-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: sample %d got %v, want %v", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+	if newFilter(config.SmoothingFilter{Type: "kalman"}) != nil {
+		t.Error("expected no filter for an unknown type")
+	}
+}
+
+func TestSmoother(t *testing.T) {
+	var nilSmoother *Smoother
+	if m := nilSmoother.Apply(measurement("AA:BB:CC:DD:EE:01", 10, -70)); *m.Pm2p5 != 10 {
+		t.Error("nil smoother changed the measurement")
+	}
+	if New(&config.Smoothing{PublishRaw: true}) != nil {
+		t.Error("expected a nil smoother without fields")
+	}
+
+	s := New(&config.Smoothing{
+		PublishRaw: true,
+		Fields: map[string][]config.SmoothingFilter{
+			"pm2p5": {{Type: "median", Window: 3}, {Type: "moving_average", Window: 2}},
+			"rssi":  {{Type: "ewma", Alpha: 0.5}},
+		},
+	})
+	s.Apply(measurement("AA:BB:CC:DD:EE:01", 10, -70))
+	s.Apply(measurement("AA:BB:CC:DD:EE:01", 12, -80))
+	m := s.Apply(measurement("aa:bb:cc:dd:ee:01", 90, -81))
+	// Median 10, 11 and 12, then the mean of the last two
+	if *m.Pm2p5 != 11.5 {
+		t.Errorf("pm2p5: got %v, want 11.5", *m.Pm2p5)
+	}
+	// -70, -75, -78 rounded
+	if *m.Rssi != -78 {
+		t.Errorf("rssi: got %v, want -78", *m.Rssi)
+	}
+	if m.Raw["pm2p5"] != 90 || m.Raw["rssi"] != -81 {
+		t.Errorf("raw values: %v", m.Raw)
+	}
+
+	// Every tag has its own filters
+	m = s.Apply(measurement("AA:BB:CC:DD:EE:02", 50, -60))
+	if *m.Pm2p5 != 50 || *m.Rssi != -60 {
+		t.Errorf("second tag: pm2p5 %v, rssi %v", *m.Pm2p5, *m.Rssi)
+	}
+}
@@ -0,0 +1,79 @@
+'use client';
+
+import { FormEvent, useState } from 'react';
+import { login } from '@/lib/api';
+import { Settings, LogIn } from 'lucide-react';
+
+export default function Login() {
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [submitting, setSubmitting] = useState(false);
+
+  const handleSubmit = async (e: FormEvent) => {
+    e.preventDefault();
+    setSubmitting(true);
+    setError(null);
+    try {
+      await login(username, password);
+      window.location.href = '/';
+    } catch (err) {
+      setError(err instanceof Error ? err.message : String(err));
+      setSubmitting(false);
+    }
+  };
+
+  const inputClass = "w-full px-3 py-2 bg-ruuvi-dark border border-ruuvi-text-muted/20 rounded-lg focus:ring-2 focus:ring-ruuvi-success/50 focus:border-ruuvi-success text-sm text-white placeholder-ruuvi-text-muted/30";
+
+  return (
+    <div className="min-h-screen bg-ruuvi-dark text-ruuvi-text flex items-center justify-center px-4">
+      <form onSubmit={handleSubmit} className="w-full max-w-sm bg-ruuvi-card rounded-xl p-8 space-y-6 shadow-lg">
+        <div className="flex items-center justify-center gap-2">
+          <Settings className="w-6 h-6 text-ruuvi-success" />
+          <h1 className="text-xl font-bold text-white">Ruuvi Gateway</h1>
+        </div>
+
+        <div className="space-y-4">
+          <div>
+            <label htmlFor="username" className="block text-sm font-medium text-ruuvi-text-muted mb-1">Username</label>
+            <input
+              id="username"
+              type="text"
+              autoComplete="username"
+              autoFocus
+              required
+              value={username}
+              onChange={(e) => setUsername(e.target.value)}
+              className={inputClass}
+            />
+          </div>
+          <div>
+            <label htmlFor="password" className="block text-sm font-medium text-ruuvi-text-muted mb-1">Password</label>
+            <input
+              id="password"
+              type="password"
+              autoComplete="current-password"
+              required
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              className={inputClass}
+            />
+          </div>
+        </div>
+
+        {error && (
+          <p className="text-sm text-red-400">{error}</p>
+        )}
+
+        <button
+          type="submit"
+          disabled={submitting}
+          className="w-full flex items-center justify-center gap-2 px-4 py-2 text-sm font-bold text-ruuvi-dark bg-ruuvi-success hover:bg-ruuvi-success/90 disabled:opacity-50 rounded-lg transition-all"
+        >
+          <LogIn className="w-4 h-4" />
+          {submitting ? 'Logging in...' : 'Log in'}
+        </button>
+      </form>
+    </div>
+  );
+}
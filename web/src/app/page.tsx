@@ -1,8 +1,8 @@
 'use client';
 
 import { useEffect, useState } from 'react';
-import { fetchConfig, fetchTags, updateConfig, enableTag, restartGateway, setTagName } from '@/lib/api';
-import { Config, Tag, MQTTPublisherConfig, InfluxDBPublisherConfig, InfluxDB3PublisherConfig, MatterConfig } from '@/types';
+import { fetchConfig, fetchTags, fetchCurrentUser, logout, subscribeTags, updateConfig, validateConfig, enableTag, restartGateway, setTagName } from '@/lib/api';
+import { Config, CurrentUser, FieldError, SinkInstance, Tag, MQTTPublisherConfig, InfluxDBPublisherConfig, InfluxDB3PublisherConfig, MatterConfig, PrometheusConfig } from '@/types';
 import { IntegrationCard } from '@/components/IntegrationCard';
 import { Modal } from '@/components/Modal';
 import { MQTTForm } from '@/components/MQTTForm';
@@ -10,19 +10,59 @@ import { InfluxDBForm } from '@/components/InfluxDBForm';
 import { InfluxDB3Form } from '@/components/InfluxDB3Form';
 import { MatterForm } from '@/components/MatterForm';
 import { RuuviTagForm } from '@/components/RuuviTagForm';
-import { Bluetooth, Radio, Cloud, Database, BarChart3, Settings, Plus, Check, RefreshCw, QrCode } from 'lucide-react';
+import { SinkInstanceFields } from '@/components/SinkInstanceFields';
+import { Bluetooth, Radio, Cloud, Database, BarChart3, Settings, Plus, Check, RefreshCw, QrCode, LogOut } from 'lucide-react';
+
+// Lists of the named instances next to the single object form of the sinks
+const instanceLists: Record<string, 'mqtt_publishers' | 'influxdb_publishers' | 'influxdb3_publishers'> = {
+  mqtt_publisher: 'mqtt_publishers',
+  influxdb_publisher: 'influxdb_publishers',
+  influxdb3_publisher: 'influxdb3_publishers',
+};
+
+const sinkDefaults: Record<string, any> = {
+  mqtt_publisher: {
+    enabled: false,
+    broker_url: 'tcp://localhost:1883',
+    client_id: 'ruuvi-gateway',
+    topic_prefix: 'ruuvi',
+    send_decoded: true,
+    minimum_interval: '1s'
+  },
+  influxdb_publisher: {
+    enabled: false,
+    url: 'http://localhost:8086',
+    auth_token: '',
+    org: 'my-org',
+    bucket: 'ruuvi',
+    measurement: 'ruuvi_measurements',
+    minimum_interval: '1s'
+  },
+  influxdb3_publisher: {
+    enabled: false,
+    url: 'https://us-east-1-1.aws.cloud2.influxdata.com',
+    auth_token: '',
+    database: 'ruuvi',
+    measurement: 'ruuvi_measurements',
+    minimum_interval: '1s'
+  },
+};
 
 export default function Home() {
   const [config, setConfig] = useState<Config | null>(null);
   const [tags, setTags] = useState<Tag[]>([]);
   const [loading, setLoading] = useState(true);
+  const [user, setUser] = useState<CurrentUser | null>(null);
 
   // Modal State
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [activeSinkId, setActiveSinkId] = useState<string | null>(null);
+  // Index in the list of named instances, null for the single object form
+  const [activeInstance, setActiveInstance] = useState<number | null>(null);
   const [isSaving, setIsSaving] = useState(false);
   const [formData, setFormData] = useState<any>(null);
   const [initialFormData, setInitialFormData] = useState<any>(null);
+  const [formErrors, setFormErrors] = useState<FieldError[]>([]);
 
   // Restart Confirmation State
   const [showRestartPrompt, setShowRestartPrompt] = useState(false);
@@ -39,8 +79,15 @@ export default function Home() {
   useEffect(() => {
     const fetchData = async () => {
       try {
+        const currentUser = await fetchCurrentUser();
+        if (!currentUser.authenticated) {
+          window.location.href = '/login';
+          return;
+        }
+        setUser(currentUser);
+        // Only admins can read the config
         const [configData, tagsData] = await Promise.all([
-          fetchConfig(),
+          currentUser.role === 'admin' ? fetchConfig() : Promise.resolve(null),
           fetchTags()
         ]);
         setConfig(configData);
@@ -54,16 +101,19 @@ export default function Home() {
 
     fetchData();
 
-    const interval = setInterval(async () => {
-      try {
-        const tagsData = await fetchTags();
-        setTags(tagsData);
-      } catch (error) {
-        console.error('Error polling tags:', error);
-      }
-    }, 2500);
-
-    return () => clearInterval(interval);
+    // Live updates, merged into the tag list by MAC
+    const unsubscribe = subscribeTags(
+      (tag) => setTags(prev => {
+        const index = prev.findIndex(t => t.mac === tag.mac);
+        if (index === -1) return [...prev, tag];
+        const next = [...prev];
+        next[index] = tag;
+        return next;
+      }),
+      (error) => console.error('Tag stream error, reconnecting:', error)
+    );
+
+    return () => unsubscribe();
   }, []);
 
   const handleSave = async () => {
@@ -74,16 +124,27 @@ export default function Home() {
       // ... (config construction remains same)
       const newConfig = { ...config };
 
-      if (activeSinkId === 'mqtt_publisher') {
+      const list = instanceLists[activeSinkId];
+      if (list && activeInstance !== null) {
+        const instances: any[] = [...(config[list] ?? [])];
+        instances[activeInstance] = formData;
+        newConfig[list] = instances;
+      } else if (activeSinkId === 'mqtt_publisher') {
         newConfig.mqtt_publisher = formData as MQTTPublisherConfig;
       } else if (activeSinkId === 'influxdb_publisher') {
         newConfig.influxdb_publisher = formData as InfluxDBPublisherConfig;
       } else if (activeSinkId === 'influxdb3_publisher') {
         newConfig.influxdb3_publisher = formData as InfluxDB3PublisherConfig;
+      } else if (activeSinkId === 'prometheus' && formData) {
+        newConfig.prometheus = formData as PrometheusConfig;
       } else if (activeSinkId === 'matter') {
         newConfig.matter = formData as MatterConfig;
       }
 
+      const validation = await validateConfig(newConfig);
+      setFormErrors(validation.errors);
+      if (!validation.valid) return;
+
       await updateConfig(newConfig);
       setConfig(newConfig);
       setIsModalOpen(false);
@@ -96,6 +157,42 @@ export default function Home() {
     }
   };
 
+  // Saves the named instances of a sink after they are toggled or removed
+  const saveInstances = async (id: string, instances: any[]) => {
+    const list = instanceLists[id];
+    if (!config || !list) return;
+    const newConfig = { ...config, [list]: instances };
+    try {
+      const validation = await validateConfig(newConfig);
+      if (!validation.valid) {
+        alert('Invalid config:\n' + validation.errors.map(e => `${e.path}: ${e.message}`).join('\n'));
+        return;
+      }
+      await updateConfig(newConfig);
+      setConfig(newConfig);
+      setConfigChanged(true);
+    } catch (e) {
+      alert('Failed to save config: ' + e);
+    }
+  };
+
+  const handleToggleInstance = (id: string, index: number, enabled: boolean) => {
+    const list = instanceLists[id];
+    if (!config || !list) return;
+    const instances: any[] = [...(config[list] ?? [])];
+    instances[index] = { ...instances[index], enabled };
+    saveInstances(id, instances);
+  };
+
+  const handleRemoveInstance = (id: string, index: number) => {
+    const list = instanceLists[id];
+    if (!config || !list) return;
+    const instances: any[] = [...(config[list] ?? [])];
+    if (!confirm(`Remove the instance "${instances[index]?.name}"?`)) return;
+    instances.splice(index, 1);
+    saveInstances(id, instances);
+  };
+
   const handleRestart = async () => {
     if (!confirm('Are you sure you want to restart the gateway?')) return;
 
@@ -163,39 +260,22 @@ export default function Home() {
     setInitialTagEnabled(enabled);
   };
 
-  const handleConfigure = (id: string) => {
+  const handleConfigure = (id: string, instance: number | null = null) => {
     setActiveSinkId(id);
+    setActiveInstance(instance);
     if (!config) return;
 
     let data: any = null;
-    if (id === 'mqtt_publisher') {
-      data = config.mqtt_publisher || {
-        enabled: false,
-        broker_url: 'tcp://localhost:1883',
-        client_id: 'ruuvi-gateway',
-        topic_prefix: 'ruuvi',
-        send_decoded: true,
-        minimum_interval: '1s'
-      };
+    const list = instanceLists[id];
+    if (list && instance !== null) {
+      // A new instance starts from the defaults, not from the secrets of another instance
+      data = config[list]?.[instance] || { ...sinkDefaults[id], enabled: true, name: '' };
+    } else if (id === 'mqtt_publisher') {
+      data = config.mqtt_publisher || sinkDefaults.mqtt_publisher;
     } else if (id === 'influxdb_publisher') {
-      data = config.influxdb_publisher || {
-        enabled: false,
-        url: 'http://localhost:8086',
-        auth_token: '',
-        org: 'my-org',
-        bucket: 'ruuvi',
-        measurement: 'ruuvi_measurements',
-        minimum_interval: '1s'
-      };
+      data = config.influxdb_publisher || sinkDefaults.influxdb_publisher;
     } else if (id === 'influxdb3_publisher') {
-      data = config.influxdb3_publisher || {
-        enabled: false,
-        url: 'https://us-east-1-1.aws.cloud2.influxdata.com',
-        auth_token: '',
-        database: 'ruuvi',
-        measurement: 'ruuvi_measurements',
-        minimum_interval: '1s'
-      };
+      data = config.influxdb3_publisher || sinkDefaults.influxdb3_publisher;
     } else if (id === 'matter') {
       data = config.matter || {
         enabled: false,
@@ -206,13 +286,12 @@ export default function Home() {
         storage_path: "./matter_data"
       };
     } else if (id === 'prometheus') {
-      // Prometheus usually just has enabled/disabled in this simple config, 
-      // but let's check the schema. It has port and prefix.
-      // For now, we don't have a form for it in the modal (based on lines 216-220), 
-      // it just shows a message. But we set ID so the modal opens.
+      // Only the filter of a configured Prometheus sink is edited here
+      data = config.prometheus ?? null;
     }
     setFormData(data);
     setInitialFormData(JSON.parse(JSON.stringify(data))); // Deep clone for comparison
+    setFormErrors([]);
     setIsModalOpen(true);
   };
 
@@ -281,6 +360,20 @@ export default function Home() {
                 Restart to Apply Changes
               </button>
             )}
+            {user?.auth_enabled && (
+              <div className="flex items-center gap-3 text-sm text-ruuvi-text-muted">
+                <span>{user.username} ({user.role})</span>
+                {user.method === 'session' && (
+                  <button
+                    onClick={() => logout()}
+                    className="flex items-center gap-1.5 px-3 py-1.5 text-sm text-ruuvi-text-muted hover:text-white hover:bg-ruuvi-dark rounded-lg transition-colors"
+                  >
+                    <LogOut className="w-4 h-4" />
+                    Log out
+                  </button>
+                )}
+              </div>
+            )}
           </div>
         </div>
       </header>
@@ -351,16 +444,25 @@ export default function Home() {
           </div>
 
           <div className="flex flex-wrap gap-6 justify-center">
-            {sinks.map((sink) => (
-              <IntegrationCard
-                key={sink.id}
-                title={sink.title}
-                description={sink.desc}
-                icon={sink.icon}
-                status={sink.enabled ? 'active' : 'inactive'}
-                onConfigure={() => handleConfigure(sink.id)}
-              />
-            ))}
+            {sinks.map((sink) => {
+              const list = instanceLists[sink.id];
+              const instances: SinkInstance[] | undefined = list ? config?.[list] ?? [] : undefined;
+              return (
+                <IntegrationCard
+                  key={sink.id}
+                  title={sink.title}
+                  description={sink.desc}
+                  icon={sink.icon}
+                  status={sink.enabled || instances?.some(i => i.enabled ?? true) ? 'active' : 'inactive'}
+                  onConfigure={() => handleConfigure(sink.id)}
+                  instances={instances?.map(i => ({ name: i.name ?? '', enabled: i.enabled ?? true }))}
+                  onAddInstance={list && config ? () => handleConfigure(sink.id, instances?.length ?? 0) : undefined}
+                  onEditInstance={list ? (index) => handleConfigure(sink.id, index) : undefined}
+                  onToggleInstance={list ? (index, enabled) => handleToggleInstance(sink.id, index, enabled) : undefined}
+                  onRemoveInstance={list ? (index) => handleRemoveInstance(sink.id, index) : undefined}
+                />
+              );
+            })}
           </div>
         </section>
       </main>
@@ -370,6 +472,7 @@ export default function Home() {
         isOpen={isModalOpen}
         onClose={() => setIsModalOpen(false)}
         title={
+          activeInstance !== null ? `Configure Instance ${formData?.name || `#${activeInstance + 1}`}` :
           activeSinkId === 'mqtt_publisher' ? 'Configure MQTT Publisher' :
             activeSinkId === 'influxdb_publisher' ? 'Configure InfluxDB Publisher' :
               activeSinkId === 'influxdb3_publisher' ? 'Configure InfluxDB v3 Publisher' :
@@ -379,7 +482,17 @@ export default function Home() {
         onSubmit={handleSave}
         isSaving={isSaving}
         isFormDirty={isConfigFormDirty}
+        errors={formErrors}
       >
+        {activeSinkId && (instanceLists[activeSinkId] || activeSinkId === 'prometheus') && formData && (
+          <SinkInstanceFields
+            key={`${activeSinkId}-${activeInstance}`}
+            config={formData}
+            named={activeInstance !== null}
+            changeBased={activeSinkId !== 'prometheus'}
+            onChange={setFormData}
+          />
+        )}
         {activeSinkId === 'mqtt_publisher' && (
           <MQTTForm
             initialConfig={formData}
@@ -1,4 +1,5 @@
 import { InfluxDB3PublisherConfig } from '@/types';
+import { SecretInput } from '@/components/SecretInput';
 
 interface InfluxDB3FormProps {
     initialConfig?: InfluxDB3PublisherConfig;
@@ -47,10 +48,9 @@ export function InfluxDB3Form({ initialConfig, onChange }: InfluxDB3FormProps) {
 
             <div className="space-y-1">
                 <label className="text-sm font-medium text-gray-700">Auth Token</label>
-                <input
-                    type="password"
+                <SecretInput
                     value={config.auth_token}
-                    onChange={(e) => handleChange('auth_token', e.target.value)}
+                    onChange={(value) => handleChange('auth_token', value)}
                     className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-blue-500 text-sm"
                 />
             </div>
@@ -1,4 +1,5 @@
 import { InfluxDBPublisherConfig } from '@/types';
+import { SecretInput } from '@/components/SecretInput';
 
 interface InfluxDBFormProps {
     initialConfig?: InfluxDBPublisherConfig;
@@ -51,10 +52,9 @@ export function InfluxDBForm({ initialConfig, onChange }: InfluxDBFormProps) {
 
             <div className="space-y-1">
                 <label className={labelClasses}>Auth Token</label>
-                <input
-                    type="password"
+                <SecretInput
                     value={config.auth_token}
-                    onChange={(e) => handleChange('auth_token', e.target.value)}
+                    onChange={(value) => handleChange('auth_token', value)}
                     className={inputClasses}
                 />
             </div>
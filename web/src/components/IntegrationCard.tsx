@@ -1,4 +1,4 @@
-import { LucideIcon, Pencil, Thermometer, Droplets, Gauge, Signal, Battery, Sun, Activity } from 'lucide-react';
+import { LucideIcon, Pencil, Plus, Trash2, Thermometer, Droplets, Gauge, Signal, Battery, Sun, Activity } from 'lucide-react';
 
 interface IntegrationCardProps {
     title: string;
@@ -30,6 +30,12 @@ interface IntegrationCardProps {
     // Toggle props for RuuviTags
     isEnabled?: boolean;
     onToggleEnabled?: (enabled: boolean) => void;
+    // Named instances of a sink, listed below the description
+    instances?: { name: string; enabled: boolean }[];
+    onAddInstance?: () => void;
+    onEditInstance?: (index: number) => void;
+    onToggleInstance?: (index: number, enabled: boolean) => void;
+    onRemoveInstance?: (index: number) => void;
 }
 
 export function IntegrationCard({
@@ -45,7 +51,12 @@ export function IntegrationCard({
     subtitle,
     lastSeen,
     isEnabled,
-    onToggleEnabled
+    onToggleEnabled,
+    instances,
+    onAddInstance,
+    onEditInstance,
+    onToggleInstance,
+    onRemoveInstance
 }: IntegrationCardProps) {
     const isRuuviTag = !!sensors;
     const buttonLabel = configureLabel || (status === 'new' ? 'Add' : 'Configure');
@@ -334,6 +345,48 @@ export function IntegrationCard({
                 <p className="text-sm text-ruuvi-text-muted mb-4 flex-grow z-10 relative">{description}</p>
             )}
 
+            {/* Named sink instances */}
+            {instances && instances.length > 0 && (
+                <ul className="flex flex-col gap-1.5 mb-4 z-10 relative">
+                    {instances.map((instance, index) => (
+                        <li key={instance.name || index} className="flex items-center gap-2 bg-ruuvi-dark/30 rounded-lg px-3 py-1.5">
+                            {onToggleInstance && (
+                                <button
+                                    onClick={() => onToggleInstance(index, !instance.enabled)}
+                                    className={`relative inline-flex h-4 w-7 shrink-0 items-center rounded-full transition-colors duration-200 ease-in-out ${instance.enabled ? 'bg-ruuvi-success' : 'bg-gray-600'}`}
+                                    role="switch"
+                                    aria-checked={instance.enabled}
+                                    title={instance.enabled ? 'Disable instance' : 'Enable instance'}
+                                >
+                                    <span
+                                        className={`inline-block h-3 w-3 transform rounded-full bg-white shadow-sm transition-transform duration-200 ease-in-out ${instance.enabled ? 'translate-x-3.5' : 'translate-x-0.5'}`}
+                                    />
+                                </button>
+                            )}
+                            <span className="flex-grow text-sm text-ruuvi-text font-mono truncate">{instance.name}</span>
+                            {onEditInstance && (
+                                <button
+                                    onClick={() => onEditInstance(index)}
+                                    className="p-1 text-ruuvi-text-muted hover:text-white hover:bg-ruuvi-dark/50 rounded transition-colors"
+                                    title="Configure instance"
+                                >
+                                    <Pencil className="w-3.5 h-3.5" />
+                                </button>
+                            )}
+                            {onRemoveInstance && (
+                                <button
+                                    onClick={() => onRemoveInstance(index)}
+                                    className="p-1 text-ruuvi-text-muted hover:text-red-400 hover:bg-ruuvi-dark/50 rounded transition-colors"
+                                    title="Remove instance"
+                                >
+                                    <Trash2 className="w-3.5 h-3.5" />
+                                </button>
+                            )}
+                        </li>
+                    ))}
+                </ul>
+            )}
+
             {/* Actions */}
             <div className="flex justify-end items-center gap-2 mt-auto pt-2 border-t border-ruuvi-dark/50 z-10 relative">
                 {onEdit && (
@@ -345,6 +398,16 @@ export function IntegrationCard({
                         <Pencil className="w-3.5 h-3.5" />
                     </button>
                 )}
+                {onAddInstance && (
+                    <button
+                        onClick={onAddInstance}
+                        className="flex items-center gap-1 text-sm font-medium text-ruuvi-text-muted hover:text-white transition-colors mr-auto"
+                        title="Add another instance"
+                    >
+                        <Plus className="w-3.5 h-3.5" />
+                        Add instance
+                    </button>
+                )}
                 {/* For sinks: text button (RuuviTags have edit in header now) */}
                 {onConfigure && !isRuuviTag && (
                     <button
@@ -1,4 +1,5 @@
 import { MQTTPublisherConfig } from '@/types';
+import { SecretInput } from '@/components/SecretInput';
 
 interface MQTTFormProps {
     initialConfig?: MQTTPublisherConfig;
@@ -85,15 +86,53 @@ export function MQTTForm({ initialConfig, onChange }: MQTTFormProps) {
                 </div>
                 <div className="space-y-1">
                     <label className={labelClasses}>Password</label>
-                    <input
-                        type="password"
-                        value={config.password || ''}
-                        onChange={(e) => handleChange('password', e.target.value)}
+                    <SecretInput
+                        value={config.password}
+                        onChange={(value) => handleChange('password', value)}
                         className={inputClasses}
                     />
                 </div>
             </div>
 
+            <div className="grid grid-cols-2 gap-4">
+                <div className="space-y-1">
+                    <label className={labelClasses}>Protocol Version</label>
+                    <select
+                        value={config.protocol_version || '3.1.1'}
+                        onChange={(e) => handleChange('protocol_version', e.target.value)}
+                        className={inputClasses}
+                    >
+                        <option value="3.1.1">MQTT 3.1.1</option>
+                        <option value="5">MQTT 5</option>
+                    </select>
+                </div>
+                <div className="space-y-1">
+                    <label className={labelClasses}>QoS</label>
+                    <select
+                        value={config.qos ?? 0}
+                        onChange={(e) => handleChange('qos', Number(e.target.value))}
+                        className={inputClasses}
+                    >
+                        <option value={0}>0 - At most once</option>
+                        <option value={1}>1 - At least once</option>
+                        <option value={2}>2 - Exactly once</option>
+                    </select>
+                </div>
+            </div>
+
+            {config.protocol_version === '5' && (
+                <div className="space-y-1">
+                    <label className={labelClasses}>Message Expiry</label>
+                    <input
+                        type="text"
+                        value={config.message_expiry || ''}
+                        onChange={(e) => handleChange('message_expiry', e.target.value)}
+                        placeholder="5m (leave empty to never expire)"
+                        className={inputClasses}
+                    />
+                </div>
+            )}
+
             <div className="space-y-1">
                 <label className={labelClasses}>Minimum Interval</label>
                 <input
@@ -127,6 +166,17 @@ export function MQTTForm({ initialConfig, onChange }: MQTTFormProps) {
                 />
                 <label htmlFor="retain" className="text-sm font-medium text-ruuvi-text-muted cursor-pointer select-none">Retain Messages (Recommended)</label>
             </div>
+
+            <div className="flex items-center gap-3">
+                <input
+                    type="checkbox"
+                    id="control"
+                    checked={config.control_enabled || false}
+                    onChange={(e) => handleChange('control_enabled', e.target.checked)}
+                    className="w-4 h-4 text-ruuvi-success rounded border-ruuvi-text-muted/30 focus:ring-ruuvi-success bg-ruuvi-dark"
+                />
+                <label htmlFor="control" className="text-sm font-medium text-ruuvi-text-muted cursor-pointer select-none">Accept Control Commands</label>
+            </div>
         </div>
     );
 }
@@ -114,8 +114,9 @@ export function MatterForm({ config, onChange }: MatterFormProps) {
                                 <label className="block text-xs font-medium text-ruuvi-text-muted mb-1">Passcode</label>
                                 <input
                                     type="number"
-                                    value={config.passcode}
+                                    value={config.passcode || ''}
                                     onChange={(e) => onChange({ ...config, passcode: parseInt(e.target.value) || 0 })}
+                                    placeholder="Stored (unchanged)"
                                     className="w-full bg-ruuvi-dark border border-ruuvi-text-muted/20 rounded px-3 py-2 text-white text-sm focus:border-ruuvi-success focus:outline-none"
                                 />
                             </div>
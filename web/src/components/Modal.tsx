@@ -1,5 +1,6 @@
 import { X } from 'lucide-react';
 import { ReactNode } from 'react';
+import { FieldError } from '@/types';
 
 interface ModalProps {
     isOpen: boolean;
@@ -9,9 +10,10 @@ interface ModalProps {
     onSubmit: () => void;
     isSaving?: boolean;
     isFormDirty?: boolean;
+    errors?: FieldError[];
 }
 
-export function Modal({ isOpen, onClose, title, children, onSubmit, isSaving, isFormDirty = true }: ModalProps) {
+export function Modal({ isOpen, onClose, title, children, onSubmit, isSaving, isFormDirty = true, errors = [] }: ModalProps) {
     if (!isOpen) return null;
 
     const canSave = isFormDirty && !isSaving;
@@ -28,6 +30,15 @@ export function Modal({ isOpen, onClose, title, children, onSubmit, isSaving, is
 
                 <div className="p-6 overflow-y-auto max-h-[70vh]">
                     {children}
+                    {errors.length > 0 && (
+                        <ul className="mt-4 p-3 space-y-1 bg-red-500/10 border border-red-500/30 rounded-lg text-sm text-red-400">
+                            {errors.map((error, i) => (
+                                <li key={i}>
+                                    {error.path && <code className="font-mono">{error.path}</code>}{error.path && ': '}{error.message}
+                                </li>
+                            ))}
+                        </ul>
+                    )}
                 </div>
 
                 <div className="p-6 bg-ruuvi-dark/30 flex justify-end gap-3 border-t border-ruuvi-dark/50">
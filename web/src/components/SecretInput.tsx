@@ -0,0 +1,25 @@
+// SECRET_MASK is sent by the gateway instead of stored secrets, sending it back keeps the secret unchanged
+export const SECRET_MASK = '********';
+
+interface SecretInputProps {
+    value?: string;
+    onChange: (value: string) => void;
+    className?: string;
+    placeholder?: string;
+}
+
+// SecretInput is a password input which shows a stored secret as a placeholder, the stored value
+// is never sent to the browser
+export function SecretInput({ value, onChange, className, placeholder }: SecretInputProps) {
+    const stored = value === SECRET_MASK;
+    return (
+        <input
+            type="password"
+            autoComplete="new-password"
+            value={stored ? '' : value || ''}
+            onChange={(e) => onChange(e.target.value)}
+            placeholder={stored ? 'Stored (unchanged)' : placeholder}
+            className={className}
+        />
+    );
+}
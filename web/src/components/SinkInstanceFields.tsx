@@ -0,0 +1,144 @@
+import { useState } from 'react';
+import { SinkFilter, SinkInstance } from '@/types';
+
+interface SinkInstanceFieldsProps {
+    config: SinkInstance;
+    // Instances in the lists must be named, the single object form may leave the name empty
+    named: boolean;
+    // Show the deadbands and the heartbeat, Prometheus is scraped and has neither
+    changeBased?: boolean;
+    onChange: (config: SinkInstance) => void;
+}
+
+const inputClasses = "w-full px-3 py-2 bg-ruuvi-dark border border-ruuvi-text-muted/20 rounded-lg focus:ring-2 focus:ring-ruuvi-success/50 focus:border-ruuvi-success text-sm text-white placeholder-ruuvi-text-muted/30";
+const labelClasses = "text-sm font-medium text-ruuvi-text-muted";
+
+interface ListInputProps {
+    label: string;
+    value?: string[];
+    placeholder: string;
+    upperCase?: boolean;
+    onChange: (value: string[] | undefined) => void;
+}
+
+// Comma separated list, the text is kept as typed and the list is parsed from it
+function ListInput({ label, value, placeholder, upperCase, onChange }: ListInputProps) {
+    const [text, setText] = useState(value?.join(', ') ?? '');
+
+    const handleChange = (next: string) => {
+        setText(next);
+        const list = next.split(',').map(t => upperCase ? t.trim().toUpperCase() : t.trim()).filter(t => t !== '');
+        onChange(list.length > 0 ? list : undefined);
+    };
+
+    return (
+        <div className="space-y-1">
+            <label className={labelClasses}>{label}</label>
+            <input
+                type="text"
+                value={text}
+                onChange={(e) => handleChange(e.target.value)}
+                placeholder={placeholder}
+                className={inputClasses}
+            />
+        </div>
+    );
+}
+
+// Deadbands as "temperature=0.1, humidity=1"
+function DeadbandsInput({ value, onChange }: { value?: Record<string, number>; onChange: (value: Record<string, number> | undefined) => void }) {
+    const [text, setText] = useState(Object.entries(value ?? {}).map(([field, delta]) => `${field}=${delta}`).join(', '));
+
+    const handleChange = (next: string) => {
+        setText(next);
+        const deadbands: Record<string, number> = {};
+        for (const item of next.split(',')) {
+            const [field, delta] = item.split('=').map(t => t.trim());
+            if (field && delta !== undefined && delta !== '' && !isNaN(Number(delta))) {
+                deadbands[field] = Number(delta);
+            }
+        }
+        onChange(Object.keys(deadbands).length > 0 ? deadbands : undefined);
+    };
+
+    return (
+        <div className="space-y-1">
+            <label className={labelClasses}>Deadbands</label>
+            <input
+                type="text"
+                value={text}
+                onChange={(e) => handleChange(e.target.value)}
+                placeholder="temperature=0.1, humidity=1"
+                className={inputClasses}
+            />
+        </div>
+    );
+}
+
+// Name, filter and change based publishing, shared by the sink forms
+export function SinkInstanceFields({ config, named, changeBased, onChange }: SinkInstanceFieldsProps) {
+    const filter = config.filter ?? {};
+
+    const handleFilterChange = (field: keyof SinkFilter, value: string[] | undefined) => {
+        onChange({ ...config, filter: { ...filter, [field]: value } });
+    };
+
+    return (
+        <div className="space-y-4 mb-4">
+            {named && (
+                <div className="space-y-1">
+                    <label className={labelClasses}>Instance Name</label>
+                    <input
+                        type="text"
+                        value={config.name ?? ''}
+                        onChange={(e) => onChange({ ...config, name: e.target.value })}
+                        placeholder="cloud"
+                        className={inputClasses}
+                    />
+                </div>
+            )}
+            <div className="grid grid-cols-2 gap-4">
+                <ListInput label="Tags" value={filter.tags} placeholder="All enabled tags" upperCase onChange={(v) => handleFilterChange('tags', v)} />
+                <ListInput label="Exclude Tags" value={filter.exclude_tags} placeholder="None" upperCase onChange={(v) => handleFilterChange('exclude_tags', v)} />
+                <ListInput label="Tag Groups" value={filter.groups} placeholder="air, outdoor" onChange={(v) => handleFilterChange('groups', v)} />
+                <ListInput label="Exclude Tag Groups" value={filter.exclude_groups} placeholder="None" onChange={(v) => handleFilterChange('exclude_groups', v)} />
+                <ListInput label="Fields" value={filter.fields} placeholder="All fields" onChange={(v) => handleFilterChange('fields', v)} />
+                <ListInput label="Exclude Fields" value={filter.exclude_fields} placeholder="None" onChange={(v) => handleFilterChange('exclude_fields', v)} />
+            </div>
+            <p className="text-xs text-ruuvi-text-muted/70">
+                Comma separated MAC addresses, tag_groups names and field names such as temperature or batteryVoltage. Empty lists select all enabled tags and all fields.
+            </p>
+            {changeBased && (
+                <>
+                    <div className="grid grid-cols-2 gap-4">
+                        <DeadbandsInput value={config.deadbands} onChange={(deadbands) => onChange({ ...config, deadbands })} />
+                        <div className="space-y-1">
+                            <label className={labelClasses}>Heartbeat</label>
+                            <input
+                                type="text"
+                                value={config.heartbeat ?? ''}
+                                onChange={(e) => onChange({ ...config, heartbeat: e.target.value || undefined })}
+                                placeholder="15m"
+                                className={inputClasses}
+                            />
+                        </div>
+                    </div>
+                    <p className="text-xs text-ruuvi-text-muted/70">
+                        With deadbands a tag is published only when a field changes by at least its deadband, or when the heartbeat has passed.
+                    </p>
+                    <div className="space-y-1">
+                        <label className={labelClasses}>Aggregation Window</label>
+                        <input
+                            type="text"
+                            value={config.aggregation_window ?? ''}
+                            onChange={(e) => onChange({ ...config, aggregation_window: e.target.value || undefined })}
+                            placeholder="Disabled, eg. 60s"
+                            className={inputClasses}
+                        />
+                        <p className="text-xs text-ruuvi-text-muted/70">Sends the mean, min, max and count of each field per tag once per window.</p>
+                    </div>
+                </>
+            )}
+        </div>
+    );
+}
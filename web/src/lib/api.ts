@@ -1,4 +1,4 @@
-import { Config, Tag } from '../types';
+import { Config, ConfigBackup, CurrentUser, EffectiveValue, Tag, ValidationResult } from '../types';
 
 const MOCK_CONFIG: Config = {
     gw_mac: "00:00:00:00:00:00",
@@ -20,6 +20,17 @@ const MOCK_CONFIG: Config = {
         minimum_interval: "1s",
         homeassistant_discovery_prefix: "homeassistant",
     },
+    mqtt_publishers: [
+        {
+            name: "cloud",
+            enabled: true,
+            broker_url: "ssl://broker.example.com:8883",
+            client_id: "",
+            topic_prefix: "ruuvi",
+            minimum_interval: "10s",
+            filter: { tags: ["AA:BB:CC:DD:EE:FF"] },
+        },
+    ],
     influxdb_publisher: {
         enabled: false,
         url: "http://localhost:8086",
@@ -86,6 +97,53 @@ const IS_DEV = process.env.NODE_ENV === 'development';
 let mockEnabledTags: string[] = [];
 let mockTagNames: Record<string, string> = {};
 
+function readCookie(name: string): string | undefined {
+    return document.cookie
+        .split('; ')
+        .find(c => c.startsWith(name + '='))
+        ?.substring(name.length + 1);
+}
+
+// apiFetch sends the CSRF token with state changing requests and redirects to the login page
+// when the session has expired
+async function apiFetch(input: string, init: RequestInit = {}): Promise<Response> {
+    const method = (init.method || 'GET').toUpperCase();
+    const headers = new Headers(init.headers);
+    if (method !== 'GET' && method !== 'HEAD') {
+        const csrf = readCookie('ruuvi_csrf');
+        if (csrf) headers.set('X-CSRF-Token', decodeURIComponent(csrf));
+    }
+    const res = await fetch(input, { ...init, headers, credentials: 'same-origin' });
+    if (res.status === 401 && !input.startsWith('/api/auth/') && window.location.pathname !== '/login') {
+        window.location.href = '/login';
+    }
+    return res;
+}
+
+export async function fetchCurrentUser(): Promise<CurrentUser> {
+    if (IS_DEV) return { auth_enabled: false, authenticated: true, username: '', role: 'admin', method: 'none' };
+    const res = await apiFetch('/api/auth/me');
+    if (!res.ok) throw new Error('Failed to fetch current user');
+    return res.json();
+}
+
+export async function login(username: string, password: string): Promise<void> {
+    if (IS_DEV) return;
+    const res = await apiFetch('/api/auth/login', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ username, password }),
+    });
+    if (res.status === 429) throw new Error('Too many failed logins, try again later');
+    if (!res.ok) throw new Error('Invalid username or password');
+}
+
+export async function logout(): Promise<void> {
+    if (IS_DEV) return;
+    await apiFetch('/api/auth/logout', { method: 'POST' });
+    window.location.href = '/login';
+}
+
 export async function fetchConfig(): Promise<Config> {
     if (IS_DEV) {
         // Include live mock state in the config
@@ -95,7 +153,7 @@ export async function fetchConfig(): Promise<Config> {
             enabled_tags: [...mockEnabledTags]
         };
     }
-    const res = await fetch('/api/config');
+    const res = await apiFetch('/api/config');
     if (!res.ok) throw new Error('Failed to fetch config');
     return res.json();
 }
@@ -105,21 +163,74 @@ export async function updateConfig(config: Config): Promise<void> {
         console.log("Mock update config:", config);
         return;
     }
-    const res = await fetch('/api/config', {
+    const res = await apiFetch('/api/config', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(config),
     });
-    if (!res.ok) throw new Error('Failed to update config');
+    if (!res.ok) throw new Error((await res.text()).trim() || 'Failed to update config');
+}
+
+// Checks the config without saving it, masked secrets are checked with the stored values
+export async function validateConfig(config: Config): Promise<ValidationResult> {
+    if (IS_DEV) return { valid: true, errors: [] };
+    const res = await apiFetch('/api/config/validate', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(config),
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || 'Failed to validate config');
+    return res.json();
+}
+
+// Values of the running config with the layer each came from, the secrets are masked
+export async function fetchEffectiveConfig(): Promise<EffectiveValue[]> {
+    if (IS_DEV) return [];
+    const res = await apiFetch('/api/config/effective');
+    if (!res.ok) throw new Error('Failed to fetch effective config');
+    return res.json();
+}
+
+export async function fetchConfigHistory(): Promise<ConfigBackup[]> {
+    if (IS_DEV) return [];
+    const res = await apiFetch('/api/config/history');
+    if (!res.ok) throw new Error('Failed to fetch config history');
+    return res.json();
+}
+
+export async function rollbackConfig(id: string): Promise<void> {
+    if (IS_DEV) {
+        console.log("Mock rollback config:", id);
+        return;
+    }
+    const res = await apiFetch('/api/config/rollback', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id }),
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || 'Failed to roll back config');
 }
 
 export async function fetchTags(): Promise<Tag[]> {
     if (IS_DEV) return MOCK_TAGS;
-    const res = await fetch('/api/tags');
+    const res = await apiFetch('/api/tags');
     if (!res.ok) throw new Error('Failed to fetch tags');
     return res.json();
 }
 
+// subscribeTags calls onTag with every tag update pushed by /api/stream and returns a function
+// which closes the stream. EventSource reconnects automatically, onError is called on every failure.
+export function subscribeTags(onTag: (tag: Tag) => void, onError?: (error: Event) => void): () => void {
+    if (IS_DEV) {
+        const interval = setInterval(() => MOCK_TAGS.forEach(tag => onTag({ ...tag, last_seen: Date.now() })), 2500);
+        return () => clearInterval(interval);
+    }
+    const source = new EventSource('/api/stream');
+    source.onmessage = (event) => onTag(JSON.parse(event.data) as Tag);
+    if (onError) source.onerror = onError;
+    return () => source.close();
+}
+
 export async function enableTag(mac: string, enabled: boolean): Promise<{ success: boolean; enabled_tags: string[] }> {
     if (IS_DEV) {
         console.log("Mock enable tag:", mac, enabled);
@@ -134,7 +245,7 @@ export async function enableTag(mac: string, enabled: boolean): Promise<{ succes
         }
         return { success: true, enabled_tags: [...mockEnabledTags] };
     }
-    const res = await fetch('/api/tags/enable', {
+    const res = await apiFetch('/api/tags/enable', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ mac, enabled }),
@@ -148,7 +259,7 @@ export async function restartGateway(): Promise<{ restarting: boolean }> {
         console.log("Mock restart gateway");
         return { restarting: true };
     }
-    const res = await fetch('/api/restart', {
+    const res = await apiFetch('/api/restart', {
         method: 'POST',
     });
     if (!res.ok) throw new Error('Failed to restart gateway');
@@ -169,7 +280,7 @@ export async function setTagName(mac: string, name: string): Promise<{ success:
         }
         return { success: true, tag_names: { ...mockTagNames } };
     }
-    const res = await fetch('/api/tags/name', {
+    const res = await apiFetch('/api/tags/name', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ mac, name }),
@@ -180,7 +291,7 @@ export async function setTagName(mac: string, name: string): Promise<{ success:
 
 export async function fetchMatterStatus(): Promise<{ pairing_code: string; qr_code: string }> {
     if (IS_DEV) return { pairing_code: "20202021", qr_code: "MT:Y.K9042C00KA0648G00" };
-    const res = await fetch('/api/matter');
+    const res = await apiFetch('/api/matter');
     if (!res.ok) throw new Error('Failed to fetch matter status');
     return res.json();
 }
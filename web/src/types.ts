@@ -1,3 +1,5 @@
+// Secrets are returned masked as '********' (0 for the Matter passcode). Sending the mask back
+// keeps the stored secret, *_file fields read the secret from a file.
 export interface Config {
     gw_mac: string;
     all_advertisements: boolean;
@@ -5,13 +7,37 @@ export interface Config {
     use_mock: boolean;
     mqtt?: MQTTConfig;
     http?: HTTPConfig;
+    http_listener?: HTTPListenerConfig;
+    grpc_listener?: GRPCListenerConfig;
+    auth?: AuthConfig;
+    config_backups?: ConfigBackupsConfig;
+    processing?: ProcessingConfig;
     mqtt_publisher?: MQTTPublisherConfig;
     influxdb_publisher?: InfluxDBPublisherConfig;
     influxdb3_publisher?: InfluxDB3PublisherConfig;
+    influxdb1_publisher?: InfluxDB1PublisherConfig;
+    postgres_publisher?: PostgresPublisherConfig;
+    sqlite_publisher?: SQLitePublisherConfig;
     prometheus?: PrometheusConfig;
+    prometheus_remote_write?: PrometheusRemoteWriteConfig;
+    otlp?: OTLPConfig;
+    kafka_publisher?: KafkaPublisherConfig;
+    nats_publisher?: NATSPublisherConfig;
+    // Additional named instances of the sinks, next to the single object form
+    mqtt_publishers?: MQTTPublisherConfig[];
+    influxdb_publishers?: InfluxDBPublisherConfig[];
+    influxdb3_publishers?: InfluxDB3PublisherConfig[];
+    influxdb1_publishers?: InfluxDB1PublisherConfig[];
+    postgres_publishers?: PostgresPublisherConfig[];
+    sqlite_publishers?: SQLitePublisherConfig[];
+    prometheus_remote_writes?: PrometheusRemoteWriteConfig[];
+    otlp_exporters?: OTLPConfig[];
+    kafka_publishers?: KafkaPublisherConfig[];
+    nats_publishers?: NATSPublisherConfig[];
     matter?: MatterConfig;
     enabled_tags?: string[];
     tag_names?: Record<string, string>;
+    tag_groups?: Record<string, string[]>;
 }
 
 export interface MQTTConfig {
@@ -20,6 +46,7 @@ export interface MQTTConfig {
     client_id: string;
     username?: string;
     password?: string;
+    password_file?: string;
     topic_prefix: string;
     lwt_topic?: string;
     lwt_online_payload?: string;
@@ -33,48 +60,326 @@ export interface HTTPConfig {
     interval: string;
     username?: string;
     password?: string;
+    password_file?: string;
 }
 
-export interface MQTTPublisherConfig {
+export interface HTTPTLSConfig {
+    enabled: boolean;
+    cert_file?: string;
+    key_file?: string;
+    cert_dir?: string;
+    hosts?: string[];
+    redirect_port?: number;
+    reload_interval?: string;
+}
+
+// Layer a value of the running config came from, name is the file, environment variable or flag
+export interface ConfigSource {
+    layer: 'default' | 'file' | 'env' | 'flag';
+    name?: string;
+}
+
+export interface EffectiveValue {
+    path: string;
+    value: unknown;
+    source: ConfigSource;
+}
+
+export interface SmoothingFilter {
+    type: 'moving_average' | 'ewma' | 'median';
+    // Number of samples of moving_average and median, defaults to 5
+    window?: number;
+    // Weight of the latest sample in ewma, defaults to 0.3
+    alpha?: number;
+}
+
+export interface SmoothingConfig {
+    publish_raw?: boolean;
+    // Filters of each field by its JSON name, applied in order
+    fields?: Record<string, SmoothingFilter[]>;
+}
+
+export interface ProcessingConfig {
+    smoothing?: SmoothingConfig;
+}
+
+export interface ConfigBackupsConfig {
+    count?: number;
+    dir?: string;
+}
+
+// Invalid config value, path is the YAML path of the value, eg. influxdb_publisher.url
+export interface FieldError {
+    path: string;
+    message: string;
+}
+
+export interface ValidationResult {
+    valid: boolean;
+    errors: FieldError[];
+}
+
+export interface ConfigBackup {
+    id: string;
+    time: string;
+    size: number;
+}
+
+export interface HTTPListenerConfig {
+    enabled?: boolean;
+    port: number;
+    tls?: HTTPTLSConfig;
+}
+
+export interface GRPCListenerConfig {
+    enabled: boolean;
+    port: number;
+}
+
+export type Role = 'admin' | 'read-only';
+
+export interface AuthUser {
+    username: string;
+    password_hash: string;
+    role?: Role;
+}
+
+export interface APIToken {
+    name: string;
+    token_sha256: string;
+    role?: Role;
+}
+
+export interface ProxyAuthConfig {
+    enabled: boolean;
+    header?: string;
+    trusted_proxies?: string[];
+    default_role?: Role;
+}
+
+export interface AuthConfig {
+    enabled: boolean;
+    users?: AuthUser[];
+    tokens?: APIToken[];
+    session_ttl?: string;
+    secure_cookies?: boolean;
+    proxy?: ProxyAuthConfig;
+}
+
+// CurrentUser is returned by /api/auth/me
+export interface CurrentUser {
+    auth_enabled: boolean;
+    authenticated: boolean;
+    username?: string;
+    role?: Role;
+    method?: 'session' | 'token' | 'proxy' | 'none';
+}
+
+// Tags and fields sent to a sink, empty lists select all enabled tags and all fields.
+// Groups are the names of tag_groups, fields the JSON names of the measurement values.
+export interface SinkFilter {
+    tags?: string[];
+    groups?: string[];
+    exclude_tags?: string[];
+    exclude_groups?: string[];
+    fields?: string[];
+    exclude_fields?: string[];
+}
+
+// Name, filter and change based publishing of a sink, the name is required for the instances in the lists
+export interface SinkInstance {
+    enabled?: boolean;
+    name?: string;
+    filter?: SinkFilter;
+    // Minimum change of a field by its JSON name before the tag is published again, 0 for any change
+    deadbands?: Record<string, number>;
+    // With deadbands, unchanged values are published at least this often, eg. '15m'
+    heartbeat?: string;
+    // Send the mean, min, max and count per tag once per window, eg. '60s'
+    aggregation_window?: string;
+}
+
+export interface MQTTPublisherConfig extends SinkInstance {
     enabled: boolean;
     broker_url: string;
     topic_prefix: string;
     client_id: string;
     username?: string;
     password?: string;
+    password_file?: string;
     minimum_interval: string;
     homeassistant_discovery_prefix?: string;
     retain_messages?: boolean;
+    protocol_version?: string;
+    qos?: number;
+    topic_qos?: Record<string, number>;
+    message_expiry?: string;
+    user_properties?: Record<string, string>;
+    publish_raw?: boolean;
+    topic_template?: string;
+    payload_template?: string;
+    field_topic_template?: string;
+    field_payload_template?: string;
+    // Older form of filter.fields
+    fields?: string[];
+    homie_base_topic?: string;
+    homie_device_id?: string;
+    homie_name?: string;
+    control_enabled?: boolean;
+    control_topic?: string;
 }
 
-export interface InfluxDBPublisherConfig {
+export interface InfluxDBPublisherConfig extends SinkInstance {
     enabled: boolean;
     url: string;
     auth_token: string;
+    auth_token_file?: string;
     org: string;
     bucket: string;
     measurement: string;
     minimum_interval: string;
 }
 
-export interface InfluxDB3PublisherConfig {
+export interface InfluxDB3PublisherConfig extends SinkInstance {
     enabled: boolean;
     url: string;
     auth_token: string;
+    auth_token_file?: string;
     database: string;
     measurement: string;
     minimum_interval: string;
 }
 
+export interface InfluxDB1PublisherConfig extends SinkInstance {
+    enabled: boolean;
+    protocol?: 'http' | 'udp' | 'tcp';
+    url: string;
+    database?: string;
+    retention_policy?: string;
+    username?: string;
+    password?: string;
+    password_file?: string;
+    measurement: string;
+    additional_tags?: Record<string, string>;
+    minimum_interval?: string;
+    timeout?: string;
+}
+
+export interface PostgresPublisherConfig extends SinkInstance {
+    enabled: boolean;
+    connection_string: string;
+    connection_string_file?: string;
+    table?: string;
+    layout?: 'wide' | 'narrow';
+    timescale?: boolean;
+    tags_table?: string;
+    batch_size?: number;
+    flush_interval?: string;
+    minimum_interval?: string;
+}
+
+export interface SQLitePublisherConfig extends SinkInstance {
+    enabled: boolean;
+    path: string;
+    table?: string;
+    retention?: string;
+    vacuum_interval?: string;
+    batch_size?: number;
+    flush_interval?: string;
+    minimum_interval?: string;
+}
+
 export interface PrometheusConfig {
     enabled: boolean;
+    filter?: SinkFilter;
     port: number;
     measurement_metric_prefix: string;
+    use_http_listener?: boolean;
+    series_ttl?: string;
+    aggregation_window?: string;
+}
+
+export interface PrometheusRemoteWriteConfig extends SinkInstance {
+    enabled: boolean;
+    url: string;
+    username?: string;
+    password?: string;
+    password_file?: string;
+    bearer_token?: string;
+    bearer_token_file?: string;
+    external_labels?: Record<string, string>;
+    measurement_metric_prefix?: string;
+    minimum_interval?: string;
+    batch_size?: number;
+    flush_interval?: string;
+    max_retries?: number;
+    timeout?: string;
+}
+
+export interface OTLPConfig extends SinkInstance {
+    enabled: boolean;
+    protocol?: 'http' | 'grpc';
+    url: string;
+    headers?: Record<string, string>;
+    metric_prefix?: string;
+    temporality?: 'cumulative' | 'delta';
+    export_interval?: string;
+    timeout?: string;
+    resource_attributes?: Record<string, string>;
+    series_ttl?: string;
+    minimum_interval?: string;
+}
+
+export interface TLSConfig {
+    enabled: boolean;
+    ca_file?: string;
+    cert_file?: string;
+    key_file?: string;
+    server_name?: string;
+    insecure_skip_verify?: boolean;
+}
+
+export interface KafkaPublisherConfig extends SinkInstance {
+    enabled: boolean;
+    brokers: string[];
+    client_id?: string;
+    topic_template?: string;
+    acks?: 'all' | 'leader' | 'none';
+    compression?: 'none' | 'gzip' | 'snappy' | 'lz4' | 'zstd';
+    timeout?: string;
+    tls?: TLSConfig;
+    sasl?: {
+        mechanism: 'plain' | 'scram-sha-256' | 'scram-sha-512';
+        username: string;
+        password: string;
+        password_file?: string;
+    };
+    minimum_interval?: string;
+}
+
+export interface NATSPublisherConfig extends SinkInstance {
+    enabled: boolean;
+    url: string;
+    subject_template?: string;
+    acks?: 'jetstream' | 'none';
+    stream?: string;
+    stream_subjects?: string[];
+    stream_max_age?: string;
+    username?: string;
+    password?: string;
+    password_file?: string;
+    token?: string;
+    token_file?: string;
+    credentials_file?: string;
+    timeout?: string;
+    tls?: TLSConfig;
+    minimum_interval?: string;
 }
 
 export interface MatterConfig {
     enabled: boolean;
     passcode: number;
+    passcode_file?: string;
     discriminator: number;
     vendor_id: number;
     product_id: number;